@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
 	"golang.org/x/crypto/pbkdf2"
@@ -35,6 +36,48 @@ type Config struct {
 	OTLPEndpoint             string
 	InitialAdminUserPassword string
 	Debug                    bool
+	// DynamicTalkgroupTimeout is how long a dynamically linked talkgroup stays linked without local activity, 0 to never unlink
+	DynamicTalkgroupTimeout time.Duration
+	// HangTime is how long a timeslot stays reserved for the last talkgroup after a transmission ends
+	HangTime time.Duration
+	// TalkgroupHangTime is how long a talkgroup stays reserved for the stream that just ended
+	TalkgroupHangTime time.Duration
+	// TalkgroupBusySignal tells a rejected station on air who is holding the talkgroup
+	TalkgroupBusySignal bool
+	// TransmitTimeout is the longest a single transmission is routed for, 0 for no limit
+	TransmitTimeout time.Duration
+	// TransmitTimeoutPenalty is how long a source ID is ignored after timing out
+	TransmitTimeoutPenalty time.Duration
+	// RepeaterPingTimeout is how long a connected repeater can go without pinging before it's marked offline
+	RepeaterPingTimeout time.Duration
+	// RepeaterFlapThreshold is how many drops within RepeaterFlapWindow mark a repeater as flapping, 0 to never
+	RepeaterFlapThreshold int
+	RepeaterFlapWindow    time.Duration
+	// RepeaterWebhookURL is sent repeater offline and flapping notifications when set
+	RepeaterWebhookURL string
+	// OIDCIssuerURL turns on single sign-on through the OpenID Connect provider at this issuer when set
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is where the provider sends users back to, the /api/v1/auth/oidc/callback route
+	OIDCRedirectURL string
+	// OIDCCallsignClaim and OIDCDMRIDClaim are the ID token claims used to link and create accounts
+	OIDCCallsignClaim string
+	OIDCDMRIDClaim    string
+	// OIDCGroupsClaim lists the user's groups, members of any of OIDCAdminGroups are made admins.
+	// Admin is left alone when OIDCAdminGroups is empty.
+	OIDCGroupsClaim string
+	OIDCAdminGroups []string
+	// PublicURL is where users reach this server, used for links in emails
+	PublicURL string
+	// SMTPHost turns on email when set, SMTPFrom is the sender address
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// SMTPImplicitTLS connects to the SMTP server over TLS, as on port 465, instead of using STARTTLS
+	SMTPImplicitTLS bool
 }
 
 var currentConfig Config
@@ -63,6 +106,89 @@ func GetConfig() *Config {
 		httpPort = 0
 	}
 
+	// DYNAMIC_TALKGROUP_TIMEOUT is in minutes
+	dynamicTalkgroupTimeout := int64(15)
+	if timeoutStr := os.Getenv("DYNAMIC_TALKGROUP_TIMEOUT"); timeoutStr != "" {
+		dynamicTalkgroupTimeout, err = strconv.ParseInt(timeoutStr, 10, 0)
+		if err != nil || dynamicTalkgroupTimeout < 0 {
+			klog.Errorf("Invalid DYNAMIC_TALKGROUP_TIMEOUT, using default of 15 minutes")
+			dynamicTalkgroupTimeout = 15
+		}
+	}
+
+	// HANG_TIME is in seconds
+	hangTime := int64(3)
+	if hangTimeStr := os.Getenv("HANG_TIME"); hangTimeStr != "" {
+		hangTime, err = strconv.ParseInt(hangTimeStr, 10, 0)
+		if err != nil || hangTime < 0 {
+			klog.Errorf("Invalid HANG_TIME, using default of 3 seconds")
+			hangTime = 3
+		}
+	}
+
+	// TALKGROUP_HANG_TIME is in seconds
+	talkgroupHangTime := int64(1)
+	if hangTimeStr := os.Getenv("TALKGROUP_HANG_TIME"); hangTimeStr != "" {
+		talkgroupHangTime, err = strconv.ParseInt(hangTimeStr, 10, 0)
+		if err != nil || talkgroupHangTime < 0 {
+			klog.Errorf("Invalid TALKGROUP_HANG_TIME, using default of 1 second")
+			talkgroupHangTime = 1
+		}
+	}
+
+	// TRANSMIT_TIMEOUT and TRANSMIT_TIMEOUT_PENALTY are in seconds
+	transmitTimeout := int64(180)
+	if timeoutStr := os.Getenv("TRANSMIT_TIMEOUT"); timeoutStr != "" {
+		transmitTimeout, err = strconv.ParseInt(timeoutStr, 10, 0)
+		if err != nil || transmitTimeout < 0 {
+			klog.Errorf("Invalid TRANSMIT_TIMEOUT, using default of 180 seconds")
+			transmitTimeout = 180
+		}
+	}
+	transmitTimeoutPenalty := int64(60)
+	if penaltyStr := os.Getenv("TRANSMIT_TIMEOUT_PENALTY"); penaltyStr != "" {
+		transmitTimeoutPenalty, err = strconv.ParseInt(penaltyStr, 10, 0)
+		if err != nil || transmitTimeoutPenalty < 0 {
+			klog.Errorf("Invalid TRANSMIT_TIMEOUT_PENALTY, using default of 60 seconds")
+			transmitTimeoutPenalty = 60
+		}
+	}
+
+	// REPEATER_PING_TIMEOUT is in seconds, REPEATER_FLAP_WINDOW is in minutes
+	repeaterPingTimeout := int64(30)
+	if timeoutStr := os.Getenv("REPEATER_PING_TIMEOUT"); timeoutStr != "" {
+		repeaterPingTimeout, err = strconv.ParseInt(timeoutStr, 10, 0)
+		if err != nil || repeaterPingTimeout <= 0 {
+			klog.Errorf("Invalid REPEATER_PING_TIMEOUT, using default of 30 seconds")
+			repeaterPingTimeout = 30
+		}
+	}
+	repeaterFlapThreshold := int64(3)
+	if thresholdStr := os.Getenv("REPEATER_FLAP_THRESHOLD"); thresholdStr != "" {
+		repeaterFlapThreshold, err = strconv.ParseInt(thresholdStr, 10, 0)
+		if err != nil || repeaterFlapThreshold < 0 {
+			klog.Errorf("Invalid REPEATER_FLAP_THRESHOLD, using default of 3")
+			repeaterFlapThreshold = 3
+		}
+	}
+	repeaterFlapWindow := int64(15)
+	if windowStr := os.Getenv("REPEATER_FLAP_WINDOW"); windowStr != "" {
+		repeaterFlapWindow, err = strconv.ParseInt(windowStr, 10, 0)
+		if err != nil || repeaterFlapWindow <= 0 {
+			klog.Errorf("Invalid REPEATER_FLAP_WINDOW, using default of 15 minutes")
+			repeaterFlapWindow = 15
+		}
+	}
+
+	var smtpPort int64 = 587
+	if portStr := os.Getenv("SMTP_PORT"); portStr != "" {
+		smtpPort, err = strconv.ParseInt(portStr, 10, 0)
+		if err != nil || smtpPort <= 0 {
+			klog.Errorf("Invalid SMTP_PORT, using default of 587")
+			smtpPort = 587
+		}
+	}
+
 	currentConfig = Config{
 		loaded:                   false,
 		RedisHost:                os.Getenv("REDIS_HOST"),
@@ -81,6 +207,30 @@ func GetConfig() *Config {
 		InitialAdminUserPassword: os.Getenv("INIT_ADMIN_USER_PASSWORD"),
 		RedisPassword:            os.Getenv("REDIS_PASSWORD"),
 		Debug:                    os.Getenv("DEBUG") != "",
+		DynamicTalkgroupTimeout:  time.Duration(dynamicTalkgroupTimeout) * time.Minute,
+		HangTime:                 time.Duration(hangTime) * time.Second,
+		TalkgroupHangTime:        time.Duration(talkgroupHangTime) * time.Second,
+		TalkgroupBusySignal:      os.Getenv("TALKGROUP_BUSY_SIGNAL") != "",
+		TransmitTimeout:          time.Duration(transmitTimeout) * time.Second,
+		TransmitTimeoutPenalty:   time.Duration(transmitTimeoutPenalty) * time.Second,
+		RepeaterPingTimeout:      time.Duration(repeaterPingTimeout) * time.Second,
+		RepeaterFlapThreshold:    int(repeaterFlapThreshold),
+		RepeaterFlapWindow:       time.Duration(repeaterFlapWindow) * time.Minute,
+		RepeaterWebhookURL:       os.Getenv("REPEATER_WEBHOOK_URL"),
+		OIDCIssuerURL:            strings.TrimSuffix(os.Getenv("OIDC_ISSUER_URL"), "/"),
+		OIDCClientID:             os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:         os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:          os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCCallsignClaim:        os.Getenv("OIDC_CALLSIGN_CLAIM"),
+		OIDCDMRIDClaim:           os.Getenv("OIDC_DMR_ID_CLAIM"),
+		OIDCGroupsClaim:          os.Getenv("OIDC_GROUPS_CLAIM"),
+		PublicURL:                strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/"),
+		SMTPHost:                 os.Getenv("SMTP_HOST"),
+		SMTPPort:                 int(smtpPort),
+		SMTPUsername:             os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:             os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:                 os.Getenv("SMTP_FROM"),
+		SMTPImplicitTLS:          os.Getenv("SMTP_IMPLICIT_TLS") != "",
 	}
 	if currentConfig.RedisHost == "" {
 		currentConfig.RedisHost = "localhost:6379"
@@ -139,6 +289,30 @@ func GetConfig() *Config {
 	} else {
 		currentConfig.CORSHosts = strings.Split(corsHosts, ",")
 	}
+	if currentConfig.PublicURL == "" {
+		currentConfig.PublicURL = fmt.Sprintf("http://localhost:%d", currentConfig.HTTPPort)
+	}
+	if currentConfig.SMTPHost != "" && currentConfig.SMTPFrom == "" {
+		klog.Errorf("SMTP_HOST is set without SMTP_FROM, email is disabled")
+		currentConfig.SMTPHost = ""
+	}
+	if currentConfig.OIDCCallsignClaim == "" {
+		currentConfig.OIDCCallsignClaim = "callsign"
+	}
+	if currentConfig.OIDCDMRIDClaim == "" {
+		currentConfig.OIDCDMRIDClaim = "dmr_id"
+	}
+	if currentConfig.OIDCGroupsClaim == "" {
+		currentConfig.OIDCGroupsClaim = "groups"
+	}
+	// OIDC_ADMIN_GROUPS is a comma separated list of provider groups whose members are admins
+	if adminGroups := os.Getenv("OIDC_ADMIN_GROUPS"); adminGroups != "" {
+		currentConfig.OIDCAdminGroups = strings.Split(adminGroups, ",")
+	}
+	if currentConfig.OIDCIssuerURL != "" && (currentConfig.OIDCClientID == "" || currentConfig.OIDCRedirectURL == "") {
+		klog.Errorf("OIDC_ISSUER_URL is set without OIDC_CLIENT_ID and OIDC_REDIRECT_URL, single sign-on is disabled")
+		currentConfig.OIDCIssuerURL = ""
+	}
 	trustedProxies := os.Getenv("TRUSTED_PROXIES")
 	if trustedProxies == "" {
 		currentConfig.TrustedProxies = []string{}
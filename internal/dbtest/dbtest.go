@@ -0,0 +1,212 @@
+// Package dbtest provides a gorm database on top of a fake SQL driver that records the statements
+// it's sent, for tests. Nothing is stored: queries return no rows unless a test supplies them,
+// and inserts return generated IDs for their RETURNING columns.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const driverName = "dbtest"
+
+// Statement is a statement the database was sent
+type Statement struct {
+	SQL  string
+	Args []driver.NamedValue
+}
+
+// DB records what a gorm database does
+type DB struct {
+	// Fail lets a test reject statements the way Postgres would, returning nil to let them through
+	Fail func(query string) error
+	// Rows lets a test answer queries, returning nil to answer with no rows
+	Rows func(query string) (columns []string, rows [][]driver.Value)
+
+	mu         sync.Mutex
+	statements []Statement
+	nextID     int64
+}
+
+var (
+	registerOnce sync.Once
+	databasesMu  sync.Mutex
+	databases    = make(map[string]*DB)
+	opened       int64
+)
+
+// Open returns a gorm database using the Postgres dialect backed by a new recorder
+func Open() (*gorm.DB, *DB, error) {
+	registerOnce.Do(func() {
+		sql.Register(driverName, fakeDriver{})
+	})
+	recorder := &DB{}
+	dsn := fmt.Sprintf("dbtest-%d", atomic.AddInt64(&opened, 1))
+	databasesMu.Lock()
+	databases[dsn] = recorder
+	databasesMu.Unlock()
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DriverName: driverName, DSN: dsn}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, recorder, nil
+}
+
+// Statements returns everything sent to the database so far, transaction control included
+func (d *DB) Statements() []Statement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Statement(nil), d.statements...)
+}
+
+// Matching returns the statements containing all of the given substrings
+func (d *DB) Matching(substrings ...string) []Statement {
+	var matched []Statement
+	for _, statement := range d.Statements() {
+		ok := true
+		for _, s := range substrings {
+			if !strings.Contains(statement.SQL, s) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, statement)
+		}
+	}
+	return matched
+}
+
+// Reset forgets the statements recorded so far
+func (d *DB) Reset() {
+	d.mu.Lock()
+	d.statements = nil
+	d.mu.Unlock()
+}
+
+func (d *DB) record(query string, args []driver.NamedValue) error {
+	d.mu.Lock()
+	d.statements = append(d.statements, Statement{SQL: query, Args: args})
+	d.mu.Unlock()
+	if d.Fail != nil {
+		return d.Fail(query)
+	}
+	return nil
+}
+
+var returningRegex = regexp.MustCompile(`RETURNING (.+)$`)
+
+func (d *DB) query(query string) *rows {
+	if match := returningRegex.FindStringSubmatch(query); match != nil {
+		var columns []string
+		var values []driver.Value
+		for _, column := range strings.Split(match[1], ",") {
+			columns = append(columns, strings.Trim(strings.TrimSpace(column), `"`))
+			values = append(values, atomic.AddInt64(&d.nextID, 1))
+		}
+		return &rows{columns: columns, rows: [][]driver.Value{values}}
+	}
+	if d.Rows != nil {
+		columns, values := d.Rows(query)
+		return &rows{columns: columns, rows: values}
+	}
+	return &rows{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	db, ok := databases[dsn]
+	if !ok {
+		return nil, fmt.Errorf("dbtest: unknown database %s", dsn)
+	}
+	return &conn{db: db}, nil
+}
+
+type conn struct {
+	db *DB
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("dbtest: prepared statements are not supported")
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.db.record("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return tx{db: c.db}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.db.record(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.db.record(query, args); err != nil {
+		return nil, err
+	}
+	return c.db.query(query), nil
+}
+
+type tx struct {
+	db *DB
+}
+
+func (t tx) Commit() error {
+	return t.db.record("COMMIT", nil)
+}
+
+func (t tx) Rollback() error {
+	return t.db.record("ROLLBACK", nil)
+}
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,215 @@
+package dmr
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// captureAnnouncement saves a parrot stream into an announcement if the user armed a recording
+func (s *Server) captureAnnouncement(ctx context.Context, userID uint, packets []models.Packet) {
+	if len(packets) == 0 {
+		return
+	}
+	announcementIDStr, err := s.Redis.Redis.GetDel(ctx, models.AnnouncementRecordKey(userID)).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			klog.Errorf("Error checking for announcement recording: %v", err)
+		}
+		return
+	}
+	announcementID, err := strconv.ParseUint(announcementIDStr, 10, 32)
+	if err != nil {
+		klog.Errorf("Invalid announcement ID %s: %v", announcementIDStr, err)
+		return
+	}
+
+	frames := make([]models.AnnouncementFrame, 0, len(packets))
+	for _, pkt := range packets {
+		frames = append(frames, models.AnnouncementFrame{
+			FrameType:   pkt.FrameType,
+			DTypeOrVSeq: pkt.DTypeOrVSeq,
+			DMRData:     pkt.DMRData,
+		})
+	}
+	err = s.DB.Model(&models.Announcement{ID: uint(announcementID)}).Updates(map[string]interface{}{
+		"frames":      models.EncodeAnnouncementFrames(frames),
+		"frame_count": len(frames),
+	}).Error
+	if err != nil {
+		klog.Errorf("Error saving recording for announcement %d: %v", announcementID, err)
+		return
+	}
+	klog.Infof("Recorded %d frames from %d into announcement %d", len(frames), userID, announcementID)
+}
+
+// announcementPackets builds a fresh stream for an announcement, with the link
+// control re-encoded for the playback source and destination
+func announcementPackets(announcement models.Announcement, playback models.AnnouncementPlayback) ([]models.Packet, error) {
+	streamID, err := rand.Int(rand.Reader, big.NewInt(0xFFFFFFFF))
+	if err != nil {
+		return nil, err
+	}
+	frames := models.DecodeAnnouncementFrames(announcement.Frames)
+	packets := make([]models.Packet, 0, len(frames))
+	for i, frame := range frames {
+		pkt := models.Packet{
+			Signature:   "DMRD",
+			Seq:         uint(i % 256),
+			Src:         playback.SourceID,
+			Dst:         playback.TargetID,
+			Slot:        playback.TimeSlot,
+			GroupCall:   true,
+			FrameType:   frame.FrameType,
+			DTypeOrVSeq: frame.DTypeOrVSeq,
+			StreamID:    uint(streamID.Uint64()),
+			DMRData:     frame.DMRData,
+			BER:         -1,
+			RSSI:        -1,
+		}
+		pkt.UpdateLC()
+		packets = append(packets, pkt)
+	}
+	return packets, nil
+}
+
+func (s *Server) playAnnouncement(ctx context.Context, playback models.AnnouncementPlayback) {
+	announcement := models.FindAnnouncementByID(s.DB, playback.AnnouncementID)
+	if announcement.ID == 0 {
+		klog.Errorf("Announcement %d does not exist", playback.AnnouncementID)
+		return
+	}
+	if playback.SourceID == 0 {
+		playback.SourceID = announcement.OwnerID
+	}
+	packets, err := announcementPackets(announcement, playback)
+	if err != nil {
+		klog.Errorf("Error building announcement %d: %v", announcement.ID, err)
+		return
+	}
+	if len(packets) == 0 {
+		klog.Warningf("Announcement %d has no recording", announcement.ID)
+		return
+	}
+
+	var send func(models.Packet)
+	switch playback.TargetType {
+	case models.AnnouncementTargetTalkgroup:
+		if !models.ClaimTalkgroupCopy(ctx, s.Redis.Redis, packets[0]) {
+			klog.Infof("Talkgroup %d is busy, not playing announcement %d", playback.TargetID, announcement.ID)
+			return
+		}
+		send = func(pkt models.Packet) {
+			if !models.ClaimTalkgroupCopy(ctx, s.Redis.Redis, pkt) {
+				return
+			}
+			rawPacket := models.RawDMRPacket{
+				Data: pkt.Encode(),
+			}
+			packedBytes, err := rawPacket.MarshalMsg(nil)
+			if err != nil {
+				klog.Errorf("Error marshalling raw packet: %v", err)
+				return
+			}
+			s.Redis.Redis.Publish(ctx, fmt.Sprintf("packets:talkgroup:%d", playback.TargetID), packedBytes)
+		}
+	case models.AnnouncementTargetRepeater:
+		send = func(pkt models.Packet) {
+			pkt.Repeater = playback.TargetID
+			s.sendPacket(ctx, playback.TargetID, pkt)
+		}
+	default:
+		klog.Errorf("Unknown announcement target type %s", playback.TargetType)
+		return
+	}
+
+	klog.Infof("Playing announcement %d to %s %d", announcement.ID, playback.TargetType, playback.TargetID)
+	s.playStream(ctx, packets, send)
+
+	if playback.ScheduleID != 0 {
+		s.DB.Model(&models.AnnouncementSchedule{ID: playback.ScheduleID}).Update("last_played", time.Now())
+	}
+}
+
+// listenAnnouncementQueue plays announcements queued through the API. Each
+// queued announcement is popped, and so played, by exactly one server instance.
+func (s *Server) listenAnnouncementQueue(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		result, err := s.Redis.Redis.BLPop(ctx, 5*time.Second, models.AnnouncementsQueue).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && !errors.Is(err, context.Canceled) {
+				klog.Errorf("Error reading announcement queue: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		var playback models.AnnouncementPlayback
+		err = json.Unmarshal([]byte(result[1]), &playback)
+		if err != nil {
+			klog.Errorf("Error unmarshalling announcement playback: %v", err)
+			continue
+		}
+		go s.playAnnouncement(ctx, playback)
+	}
+}
+
+// reloadAnnouncementSchedules replaces the scheduled jobs with the enabled schedules in the database
+func (s *Server) reloadAnnouncementSchedules(ctx context.Context) {
+	s.announcementScheduler.Clear()
+	schedules := models.ListEnabledAnnouncementSchedules(s.DB)
+	for _, schedule := range schedules {
+		schedule := schedule
+		_, err := s.announcementScheduler.Cron(schedule.Cron).Do(func() {
+			// Every instance fires the job, the first to take the lock plays it
+			lockKey := fmt.Sprintf("announcements:lock:%d:%d", schedule.ID, time.Now().Unix()/60)
+			acquired, err := s.Redis.Redis.SetNX(ctx, lockKey, 1, 2*time.Minute).Result()
+			if err != nil {
+				klog.Errorf("Error locking announcement schedule %d: %v", schedule.ID, err)
+				return
+			}
+			if !acquired {
+				return
+			}
+			s.playAnnouncement(ctx, models.AnnouncementPlayback{
+				AnnouncementID: schedule.AnnouncementID,
+				ScheduleID:     schedule.ID,
+				TargetType:     schedule.TargetType,
+				TargetID:       schedule.TargetID,
+				TimeSlot:       schedule.TimeSlot,
+				SourceID:       schedule.SourceID,
+			})
+		})
+		if err != nil {
+			klog.Errorf("Error scheduling announcement schedule %d: %v", schedule.ID, err)
+		}
+	}
+	if config.GetConfig().Debug {
+		klog.Infof("Loaded %d announcement schedules", len(schedules))
+	}
+}
+
+// listenAnnouncementSchedules keeps the scheduled jobs in sync with the database
+func (s *Server) listenAnnouncementSchedules(ctx context.Context) {
+	s.reloadAnnouncementSchedules(ctx)
+	s.announcementScheduler.StartAsync()
+	defer s.announcementScheduler.Stop()
+
+	models.WatchReload(ctx, s.Redis.Redis, models.AnnouncementsReloadChannel, models.ReloadInterval, func() {
+		s.reloadAnnouncementSchedules(ctx)
+	})
+}
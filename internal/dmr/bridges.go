@@ -0,0 +1,67 @@
+package dmr
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// BridgeManager holds an in-memory copy of the bridge rules for the packet path
+type BridgeManager struct {
+	DB      *gorm.DB
+	Redis   *redis.Client
+	mu      sync.RWMutex
+	bridges []models.Bridge
+}
+
+// NewBridgeManager creates a new BridgeManager
+func NewBridgeManager(db *gorm.DB, redis *redis.Client) *BridgeManager {
+	return &BridgeManager{
+		DB:    db,
+		Redis: redis,
+	}
+}
+
+// Reload reads the enabled bridge rules from the database
+func (b *BridgeManager) Reload() {
+	bridges := models.ListEnabledBridges(b.DB)
+	b.mu.Lock()
+	b.bridges = bridges
+	b.mu.Unlock()
+	if config.GetConfig().Debug {
+		klog.Infof("Loaded %d talkgroup bridges", len(bridges))
+	}
+}
+
+// Listen reloads the bridge rules whenever they change
+func (b *BridgeManager) Listen(ctx context.Context) {
+	b.Reload()
+	models.WatchReload(ctx, b.Redis, models.BridgesReloadChannel, models.ReloadInterval, b.Reload)
+}
+
+// Targets returns the talkgroups that traffic on talkgroupID is bridged to right now
+func (b *BridgeManager) Targets(talkgroupID uint) []uint {
+	now := time.Now()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var targets []uint
+	seen := make(map[uint]bool)
+	for _, bridge := range b.bridges {
+		if !bridge.ActiveAt(now) {
+			continue
+		}
+		target, ok := bridge.Target(talkgroupID)
+		if !ok || seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	return targets
+}
@@ -0,0 +1,306 @@
+package dmr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// callTrackerShards is the number of independently locked shards calls are spread across by stream ID
+const callTrackerShards = 32
+
+// persistCallEvery is how many packets go by between saves of a call's in-flight state to Redis
+const persistCallEvery = 6
+
+const inFlightCallPrefix = "call-tracker:in-flight:"
+
+// inFlightCallExpiry only matters if every instance goes away mid-call, persisting refreshes it
+const inFlightCallExpiry = 10 * time.Minute
+
+const orphanedCallCheckInterval = 30 * time.Second
+
+// orphanedCallAge is how long a persisted call can go without an update before we assume
+// the instance tracking it has gone away
+const orphanedCallAge = 5 * timerDelay
+
+// orphanedCallLock keeps multiple instances from sweeping at the same time
+const orphanedCallLock = "call-tracker:lock"
+
+// callKey identifies a call. Bridged copies of a stream share its stream ID,
+// so the destination is needed to tell them apart.
+type callKey struct {
+	StreamID  uint `json:"stream_id"`
+	Src       uint `json:"src"`
+	Dst       uint `json:"dst"`
+	Slot      bool `json:"slot"`
+	GroupCall bool `json:"group_call"`
+}
+
+func callKeyFor(packet models.Packet) callKey {
+	return callKey{
+		StreamID:  packet.StreamID,
+		Src:       packet.Src,
+		Dst:       packet.Dst,
+		Slot:      packet.Slot,
+		GroupCall: packet.GroupCall,
+	}
+}
+
+func (k callKey) redisKey() string {
+	return fmt.Sprintf("%s%d:%d:%d:%t:%t", inFlightCallPrefix, k.StreamID, k.Src, k.Dst, k.Slot, k.GroupCall)
+}
+
+// packet rebuilds enough of a packet to route the call's final update
+func (k callKey) packet() models.Packet {
+	return models.Packet{
+		StreamID:  k.StreamID,
+		Src:       k.Src,
+		Dst:       k.Dst,
+		Slot:      k.Slot,
+		GroupCall: k.GroupCall,
+	}
+}
+
+// trackedCall is a call in progress. mu guards everything in it, and is held
+// while the call is being set up so packets that race the first one wait for it.
+type trackedCall struct {
+	mu      sync.Mutex
+	call    *models.Call
+	timer   *time.Timer
+	packets uint
+	done    bool
+	// watchers are the users whose call history shows the call, looked up once when it starts
+	watchers []uint
+}
+
+type callShard struct {
+	mu    sync.Mutex
+	calls map[callKey]*trackedCall
+}
+
+// callTable holds the calls this instance is tracking, sharded by stream ID
+// so busy streams don't contend on a single lock
+type callTable struct {
+	shards [callTrackerShards]callShard
+}
+
+func newCallTable() *callTable {
+	table := &callTable{}
+	for i := range table.shards {
+		table.shards[i].calls = make(map[callKey]*trackedCall)
+	}
+	return table
+}
+
+func (t *callTable) shard(key callKey) *callShard {
+	return &t.shards[key.StreamID%callTrackerShards]
+}
+
+// reserve returns the call for key, adding it if it isn't tracked yet.
+// A newly added call is returned locked and created is true.
+func (t *callTable) reserve(key callKey) (tracked *trackedCall, created bool) {
+	shard := t.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if existing, ok := shard.calls[key]; ok {
+		return existing, false
+	}
+	tracked = &trackedCall{}
+	tracked.mu.Lock()
+	shard.calls[key] = tracked
+	return tracked, true
+}
+
+func (t *callTable) lookup(key callKey) *trackedCall {
+	shard := t.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.calls[key]
+}
+
+// remove drops key from the table, as long as it still belongs to tracked
+func (t *callTable) remove(key callKey, tracked *trackedCall) {
+	shard := t.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.calls[key] == tracked {
+		delete(shard.calls, key)
+	}
+}
+
+func (t *callTable) len() int {
+	count := 0
+	for i := range t.shards {
+		t.shards[i].mu.Lock()
+		count += len(t.shards[i].calls)
+		t.shards[i].mu.Unlock()
+	}
+	return count
+}
+
+// inFlightCall is the part of a call's state that isn't in the database until the call ends.
+// It's kept in Redis so a restarted or different instance can pick the call back up.
+type inFlightCall struct {
+	Key            callKey            `json:"key"`
+	CallID         uint               `json:"call_id"`
+	TotalPackets   uint               `json:"total_packets"`
+	LostSequences  uint               `json:"lost_sequences"`
+	LastFrameNum   uint               `json:"last_frame_num"`
+	LastPacketTime time.Time          `json:"last_packet_time"`
+	HasHeader      bool               `json:"has_header"`
+	HasTerm        bool               `json:"has_term"`
+	Quality        models.CallQuality `json:"quality"`
+}
+
+func snapshotInFlightCall(key callKey, call *models.Call) inFlightCall {
+	return inFlightCall{
+		Key:            key,
+		CallID:         call.ID,
+		TotalPackets:   call.TotalPackets,
+		LostSequences:  call.LostSequences,
+		LastFrameNum:   call.LastFrameNum,
+		LastPacketTime: call.LastPacketTime,
+		HasHeader:      call.HasHeader,
+		HasTerm:        call.HasTerm,
+		Quality:        call.Quality,
+	}
+}
+
+func (s inFlightCall) apply(call *models.Call) {
+	call.TotalPackets = s.TotalPackets
+	call.LostSequences = s.LostSequences
+	call.LastFrameNum = s.LastFrameNum
+	call.LastPacketTime = s.LastPacketTime
+	call.HasHeader = s.HasHeader
+	call.HasTerm = s.HasTerm
+	call.Quality = s.Quality
+	call.Summarize()
+}
+
+func (c *CallTracker) persistCall(ctx context.Context, key callKey, call *models.Call) {
+	stateJSON, err := json.Marshal(snapshotInFlightCall(key, call))
+	if err != nil {
+		klog.Errorf("Error marshalling in-flight call %d: %v", call.StreamID, err)
+		return
+	}
+	if err := c.Redis.Set(ctx, key.redisKey(), stateJSON, inFlightCallExpiry).Err(); err != nil {
+		klog.Errorf("Error persisting in-flight call %d: %v", call.StreamID, err)
+	}
+}
+
+func (c *CallTracker) clearInFlightCall(ctx context.Context, key callKey) {
+	if err := c.Redis.Del(ctx, key.redisKey()).Err(); err != nil {
+		klog.Errorf("Error clearing in-flight call %d: %v", key.StreamID, err)
+	}
+}
+
+func (c *CallTracker) loadInFlightCall(ctx context.Context, redisKey string) (inFlightCall, bool) {
+	var state inFlightCall
+	stateJSON, err := c.Redis.Get(ctx, redisKey).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			klog.Errorf("Error loading in-flight call %s: %v", redisKey, err)
+		}
+		return state, false
+	}
+	if err := json.Unmarshal(stateJSON, &state); err != nil {
+		klog.Errorf("Error unmarshalling in-flight call %s: %v", redisKey, err)
+		return state, false
+	}
+	return state, true
+}
+
+// resumeCall picks up a call another instance, or this one before a restart, was tracking.
+// tracked must be locked by the caller.
+func (c *CallTracker) resumeCall(ctx context.Context, key callKey, tracked *trackedCall, packet models.Packet) bool {
+	state, ok := c.loadInFlightCall(ctx, key.redisKey())
+	if !ok {
+		return false
+	}
+	call, err := models.FindCallByID(c.DB, state.CallID)
+	if err != nil || !call.Active {
+		c.clearInFlightCall(ctx, key)
+		return false
+	}
+	state.apply(&call)
+	// Don't count the handover as jitter
+	call.LastPacketTime = time.Now()
+
+	tracked.call = &call
+	tracked.watchers = c.callWatchers(packet, call.UserID)
+	tracked.timer = time.AfterFunc(timerDelay, endCallHandler(ctx, c, packet))
+	c.persistCall(ctx, key, &call)
+
+	klog.Infof("Resumed tracking call %d", call.StreamID)
+	return true
+}
+
+// endOrphanedCalls finishes calls whose tracking instance stopped updating them without ending them
+func (c *CallTracker) endOrphanedCalls(ctx context.Context) {
+	locked, err := c.Redis.SetNX(ctx, orphanedCallLock, 1, orphanedCallCheckInterval-time.Second).Result()
+	if err != nil {
+		klog.Errorf("Error locking orphaned call check: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+
+	iter := c.Redis.Scan(ctx, 0, inFlightCallPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		state, ok := c.loadInFlightCall(ctx, iter.Val())
+		if !ok || time.Since(state.LastPacketTime) < orphanedCallAge {
+			continue
+		}
+		if c.calls.lookup(state.Key) != nil {
+			continue
+		}
+		c.clearInFlightCall(ctx, state.Key)
+
+		call, err := models.FindCallByID(c.DB, state.CallID)
+		if err != nil || !call.Active {
+			continue
+		}
+		state.apply(&call)
+		packet := state.Key.packet()
+		if call.RepeaterID != nil {
+			packet.Repeater = *call.RepeaterID
+		}
+		klog.Warningf("Ending orphaned call %d", call.StreamID)
+		c.finishCall(ctx, &call, c.callWatchers(packet, call.UserID), packet, state.LastPacketTime)
+	}
+	if err := iter.Err(); err != nil {
+		klog.Errorf("Error scanning in-flight calls: %v", err)
+	}
+}
+
+// Listen periodically saves the stats of calls in progress and cleans up calls
+// left behind by instances that went away
+func (c *CallTracker) Listen(ctx context.Context) {
+	orphanTicker := time.NewTicker(orphanedCallCheckInterval)
+	defer orphanTicker.Stop()
+	statsTicker := time.NewTicker(callStatsFlushInterval)
+	defer statsTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.stats.flush()
+			return
+		case <-statsTicker.C:
+			c.stats.flush()
+		case <-orphanTicker.C:
+			if config.GetConfig().Debug {
+				klog.Info("Checking for orphaned calls")
+			}
+			c.endOrphanedCalls(ctx)
+		}
+	}
+}
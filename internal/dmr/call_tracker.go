@@ -18,42 +18,86 @@ import (
 // This equates out to about 30 lost voice packets
 const timerDelay = 2 * time.Second
 
-// CallTracker is a struct that holds the state of the calls that are currently in progress
+// CallTracker is a struct that holds the state of the calls that are currently in progress.
+// It is safe for concurrent use, and persists in-flight calls to Redis so they survive
+// a restart or move to another instance.
 type CallTracker struct {
-	DB            *gorm.DB
-	Redis         *redis.Client
-	CallEndTimers map[uint]*time.Timer
-	InFlightCalls map[uint]*models.Call
+	DB    *gorm.DB
+	Redis *redis.Client
+	calls *callTable
+	stats *callStatsBatcher
+	cache *lookupCache
 }
 
 // NewCallTracker creates a new CallTracker
-func NewCallTracker(db *gorm.DB, redis *redis.Client) *CallTracker {
+func NewCallTracker(db *gorm.DB, redis *redis.Client, cache *lookupCache) *CallTracker {
 	return &CallTracker{
-		DB:            db,
-		Redis:         redis,
-		CallEndTimers: make(map[uint]*time.Timer),
-		InFlightCalls: make(map[uint]*models.Call),
+		DB:    db,
+		Redis: redis,
+		calls: newCallTable(),
+		stats: newCallStatsBatcher(db),
+		cache: cache,
 	}
 }
 
 // StartCall starts tracking a new call
 func (c *CallTracker) StartCall(ctx context.Context, packet models.Packet) {
-	var sourceUser models.User
-	var sourceRepeater models.Repeater
+	key := callKeyFor(packet)
+	tracked, created := c.calls.reserve(key)
+	if !created {
+		return
+	}
+	defer tracked.mu.Unlock()
+
+	if c.resumeCall(ctx, key, tracked, packet) {
+		return
+	}
 
-	if !models.UserIDExists(c.DB, packet.Src) {
+	call, ok := c.newCall(packet)
+	if !ok {
+		c.calls.remove(key, tracked)
+		tracked.done = true
+		return
+	}
+	tracked.call = call
+	tracked.watchers = c.callWatchers(packet, call.UserID)
+
+	if config.GetConfig().Debug {
+		klog.Infof("Started call %d", call.StreamID)
+	}
+
+	// Add a timer that will end the call if we haven't seen a packet in 1 second.
+	tracked.timer = time.AfterFunc(timerDelay, endCallHandler(ctx, c, packet))
+	c.persistCall(ctx, key, call)
+
+	c.publishTXEvent(ctx, models.RepeaterEventTXStart, call)
+
+	if call.IsToTalkgroup {
+		c.logNetCheckIn(ctx, call)
+	}
+}
+
+// newCall looks up the source and destination of a packet and creates its call in the database
+func (c *CallTracker) newCall(packet models.Packet) (*models.Call, bool) {
+	sourceUser, ok := c.cache.user(packet.Src)
+	if !ok {
 		if config.GetConfig().Debug {
 			klog.Errorf("User %d does not exist", packet.Src)
 		}
-		return
+		return nil, false
 	}
-	sourceUser = models.FindUserByID(c.DB, packet.Src)
 
-	if !models.RepeaterIDExists(c.DB, packet.Repeater) {
-		klog.Errorf("Repeater %d does not exist", packet.Repeater)
-		return
+	// Calls generated by the server itself, such as announcements, have no source repeater
+	var sourceRepeater models.Repeater
+	var sourceRepeaterID *uint
+	if packet.Repeater != 0 {
+		sourceRepeater, ok = c.cache.repeater(packet.Repeater)
+		if !ok {
+			klog.Errorf("Repeater %d does not exist", packet.Repeater)
+			return nil, false
+		}
+		sourceRepeaterID = &sourceRepeater.RadioID
 	}
-	sourceRepeater = models.FindRepeaterByID(c.DB, packet.Repeater)
 
 	isToRepeater, isToTalkgroup, isToUser := false, false, false
 	var destUser models.User
@@ -65,25 +109,21 @@ func (c *CallTracker) StartCall(ctx context.Context, packet models.Packet) {
 	// if packet.GroupCall is false, then packet.Dst is a user
 	if packet.GroupCall {
 		// Decide between talkgroup and repeater
-		if !models.TalkgroupIDExists(c.DB, packet.Dst) {
-			if !models.RepeaterIDExists(c.DB, packet.Dst) {
+		destTalkgroup, isToTalkgroup = c.cache.talkgroup(packet.Dst)
+		if !isToTalkgroup {
+			destRepeater, isToRepeater = c.cache.repeater(packet.Dst)
+			if !isToRepeater {
 				klog.Errorf("Cannot find packet destination %d", packet.Dst)
-				return
+				return nil, false
 			}
-			isToRepeater = true
-			destRepeater = models.FindRepeaterByID(c.DB, packet.Dst)
-		} else {
-			isToTalkgroup = true
-			destTalkgroup = models.FindTalkgroupByID(c.DB, packet.Dst)
 		}
 	} else {
 		// Find the user
-		if !models.UserIDExists(c.DB, packet.Dst) {
+		destUser, isToUser = c.cache.user(packet.Dst)
+		if !isToUser {
 			klog.Errorf("Cannot find packet destination %d", packet.Dst)
-			return
+			return nil, false
 		}
-		isToUser = true
-		destUser = models.FindUserByID(c.DB, packet.Dst)
 	}
 
 	call := models.Call{
@@ -93,7 +133,7 @@ func (c *CallTracker) StartCall(ctx context.Context, packet models.Packet) {
 		User:           sourceUser,
 		UserID:         sourceUser.ID,
 		Repeater:       sourceRepeater,
-		RepeaterID:     sourceRepeater.RadioID,
+		RepeaterID:     sourceRepeaterID,
 		TimeSlot:       packet.Slot,
 		GroupCall:      packet.GroupCall,
 		DestinationID:  packet.Dst,
@@ -125,28 +165,15 @@ func (c *CallTracker) StartCall(ctx context.Context, packet models.Packet) {
 	c.DB.Create(&call)
 	if c.DB.Error != nil {
 		klog.Errorf("Error creating call: %v", c.DB.Error)
-		return
-	}
-
-	// Add the call to the active calls map
-	c.InFlightCalls[call.ID] = &call
-
-	if config.GetConfig().Debug {
-		klog.Infof("Started call %d", call.StreamID)
+		return nil, false
 	}
 
-	// Add a timer that will end the call if we haven't seen a packet in 1 second.
-	c.CallEndTimers[call.ID] = time.AfterFunc(timerDelay, endCallHandler(ctx, c, packet))
+	return &call, true
 }
 
 // IsCallActive checks if a call is active
 func (c *CallTracker) IsCallActive(packet models.Packet) bool {
-	for _, call := range c.InFlightCalls {
-		if call.Active && call.StreamID == packet.StreamID && call.UserID == packet.Src && call.DestinationID == packet.Dst && call.TimeSlot == packet.Slot && call.GroupCall == packet.GroupCall {
-			return true
-		}
-	}
-	return false
+	return c.calls.lookup(callKeyFor(packet)) != nil
 }
 
 type jsonCallResponseUser struct {
@@ -181,11 +208,34 @@ type jsonCallResponse struct {
 	ToRepeater    jsonCallResponseRepeater  `json:"to_repeater"`
 	Loss          float32                   `json:"loss"`
 	Jitter        float32                   `json:"jitter"`
+	JitterP95     float32                   `json:"jitter_p95"`
+	JitterMax     float32                   `json:"jitter_max"`
 	BER           float32                   `json:"ber"`
 	RSSI          float32                   `json:"rssi"`
+	RSSIMin       float32                   `json:"rssi_min"`
 }
 
-func (c *CallTracker) publishCall(ctx context.Context, call *models.Call, packet models.Packet) {
+// callWatchers finds the owners of the repeaters that receive the call, along with the caller
+// if they own a repeater. It hits the database, so it's only run when a call starts.
+func (c *CallTracker) callWatchers(packet models.Packet, callerID uint) []uint {
+	var repeaters []models.Repeater
+	c.DB.Select("radio_id", "owner_id", "ts1_dynamic_talkgroup_id", "ts2_dynamic_talkgroup_id").
+		Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Find(&repeaters)
+	var watchers []uint
+	seen := make(map[uint]bool)
+	for _, repeater := range repeaters {
+		if seen[repeater.OwnerID] {
+			continue
+		}
+		if want, _ := repeater.WantRX(packet); want || repeater.OwnerID == callerID {
+			watchers = append(watchers, repeater.OwnerID)
+			seen[repeater.OwnerID] = true
+		}
+	}
+	return watchers
+}
+
+func (c *CallTracker) publishCall(ctx context.Context, call *models.Call, watchers []uint) {
 	// copy call into a jsonCallResponse
 	var jsonCall jsonCallResponse
 	jsonCall.ID = call.ID
@@ -208,8 +258,11 @@ func (c *CallTracker) publishCall(ctx context.Context, call *models.Call, packet
 	jsonCall.ToRepeater.Callsign = call.ToRepeater.Callsign
 	jsonCall.Loss = call.Loss
 	jsonCall.Jitter = call.Jitter
+	jsonCall.JitterP95 = call.JitterP95
+	jsonCall.JitterMax = call.JitterMax
 	jsonCall.BER = call.BER
 	jsonCall.RSSI = call.RSSI
+	jsonCall.RSSIMin = call.RSSIMin
 	// Publish the call JSON to Redis
 	var callJSON []byte
 	callJSON, err := json.Marshal(jsonCall)
@@ -226,57 +279,36 @@ func (c *CallTracker) publishCall(ctx context.Context, call *models.Call, packet
 		}
 	}
 
-	go func() {
-		// Iterate all repeaters to see if they want the call
-		var repeaters []models.Repeater
-		alreadyPublished := make(map[uint]bool)
-		c.DB.Preload("Owner").Find(&repeaters)
-		for _, repeater := range repeaters {
-			want, _ := repeater.WantRX(packet)
-			if want && !alreadyPublished[repeater.OwnerID] {
-				// Publish the call to the repeater owner's call history
-				c.Redis.Publish(ctx, fmt.Sprintf("calls:%d", repeater.OwnerID), callJSON)
-				alreadyPublished[repeater.OwnerID] = true
-				continue
-			}
-			if repeater.OwnerID == call.UserID {
-				c.Redis.Publish(ctx, fmt.Sprintf("calls:%d", repeater.OwnerID), callJSON)
-				alreadyPublished[repeater.OwnerID] = true
-			}
-		}
-	}()
+	// Publish the call to the call history of everyone watching it
+	for _, watcher := range watchers {
+		c.Redis.Publish(ctx, fmt.Sprintf("calls:%d", watcher), callJSON)
+	}
 }
 
-func (c *CallTracker) updateCall(ctx context.Context, call *models.Call, packet models.Packet) {
+// updateCall folds a packet into the call's stats. The caller must hold tracked.mu.
+func (c *CallTracker) updateCall(ctx context.Context, tracked *trackedCall, packet models.Packet) {
+	call := tracked.call
+
 	// Reset call end timer
-	c.CallEndTimers[call.ID].Reset(2 * time.Second)
+	tracked.timer.Reset(timerDelay)
 
-	elapsed := time.Since(call.LastPacketTime)
-	call.LastPacketTime = time.Now()
-	// call.Jitter is a float32 that represents how many ms off from 60ms elapsed
-	// time the last packet was. We'll use this to calculate the average jitter.
-	call.Jitter = (call.Jitter + float32(elapsed.Milliseconds()-60)) / 2
+	now := time.Now()
+	elapsed := now.Sub(call.LastPacketTime)
+	call.LastPacketTime = now
+	// The first packet has nothing to measure its timing against
+	measureJitter := call.TotalPackets > 0
 
 	if call.LastFrameNum != 0 && call.LastFrameNum == packet.DTypeOrVSeq {
 		// We've already seen this packet, so it's either a duplicate or we've lost 6 packets
-		if time.Since(call.LastPacketTime) > 60*time.Millisecond {
+		if elapsed > 60*time.Millisecond {
 			// We've lost 6 packets
-			call.LostSequences++
-			call.TotalPackets += 6
+			call.LostSequences += 6
+			call.TotalPackets += 7
 		} else {
 			// We've received a duplicate packet
 			call.TotalPackets++
 		}
-		call.Duration = time.Since(call.StartTime)
-		call.Loss = float32(call.LostSequences) / float32(call.TotalPackets)
-		call.Active = true
-		if packet.RSSI > 0 {
-			call.RSSI = (call.RSSI + float32(packet.RSSI)) / 2
-		}
-
-		if call.TotalPackets%2 == 0 {
-			go c.publishCall(ctx, call, packet)
-		}
+		c.summarizeCall(ctx, tracked, now)
 		return
 	}
 
@@ -299,10 +331,6 @@ func (c *CallTracker) updateCall(ctx context.Context, call *models.Call, packet
 			lost += 5 - call.LastFrameNum
 		}
 
-		if packet.BER > 0 {
-			call.TotalBits += 141
-			call.BER = ((call.BER + float32(packet.BER)) / float32(call.TotalBits)) / 2
-		}
 		call.LastFrameNum = packet.DTypeOrVSeq
 		call.LostSequences += lost
 		call.TotalPackets += 1 + lost
@@ -339,10 +367,6 @@ func (c *CallTracker) updateCall(ctx context.Context, call *models.Call, packet
 			}
 		}
 
-		if packet.BER > 0 {
-			call.TotalBits += 141
-			call.BER = ((call.BER + float32(packet.BER)) / float32(call.TotalBits)) / 2
-		}
 		call.LastFrameNum = packet.DTypeOrVSeq
 		call.LostSequences += lost
 		call.TotalPackets += 1 + lost
@@ -358,10 +382,6 @@ func (c *CallTracker) updateCall(ctx context.Context, call *models.Call, packet
 		if call.LastFrameNum != 4 {
 			lost += 4 - call.LastFrameNum
 		}
-		if packet.BER > 0 {
-			call.TotalBits += 141
-			call.BER = ((call.BER + float32(packet.BER)) / float32(call.TotalBits)) / 2
-		}
 		call.LastFrameNum = packet.DTypeOrVSeq
 		call.LostSequences += lost
 		call.TotalPackets += 1 + lost
@@ -383,28 +403,71 @@ func (c *CallTracker) updateCall(ctx context.Context, call *models.Call, packet
 		}
 	}
 
-	call.Duration = time.Since(call.StartTime)
-	call.Loss = float32(call.LostSequences) / float32(call.TotalPackets)
-	call.Active = true
+	if measureJitter {
+		// Lost packets stretch the gap, so only count the time past where this packet was due
+		call.Quality.AddJitter(elapsed - time.Duration(lost)*60*time.Millisecond)
+	}
+	isVoiceFrame := packet.FrameType == dmrconst.FrameVoice || packet.FrameType == dmrconst.FrameVoiceSync
+	if isVoiceFrame && packet.BER >= 0 {
+		call.Quality.AddBits(uint(packet.BER))
+	}
 	if packet.RSSI > 0 {
-		call.RSSI = (call.RSSI + float32(packet.RSSI)) / 2
+		call.Quality.AddRSSI(packet.RSSI)
 	}
 
+	c.summarizeCall(ctx, tracked, now)
+}
+
+// summarizeCall brings the call's stored metrics up to date and publishes them every other packet.
+// The caller must hold tracked.mu.
+func (c *CallTracker) summarizeCall(ctx context.Context, tracked *trackedCall, now time.Time) {
+	call := tracked.call
+	call.Duration = now.Sub(call.StartTime)
+	call.Active = true
+	call.Sample(now, false)
+	call.Summarize()
+
 	if call.TotalPackets%2 == 0 {
-		go c.publishCall(ctx, call, packet)
+		// Publish a copy, the call keeps changing underneath the goroutine
+		snapshot := *call
+		go c.publishCall(ctx, &snapshot, tracked.watchers)
 	}
 }
 
 // ProcessCallPacket processes a packet and updates the call
 func (c *CallTracker) ProcessCallPacket(ctx context.Context, packet models.Packet) {
-	// Querying on packet.StreamId and call.Active should be enough to find the call, but in the event that there are multiple calls
-	// active that somehow have the same StreamId, we'll also query on the other fields.
-	for _, lcall := range c.InFlightCalls {
-		if lcall.StreamID == packet.StreamID && lcall.Active && lcall.TimeSlot == packet.Slot && lcall.GroupCall == packet.GroupCall && lcall.UserID == packet.Src {
-			c.updateCall(ctx, lcall, packet)
-			return
-		}
+	key := callKeyFor(packet)
+	tracked := c.calls.lookup(key)
+	if tracked == nil {
+		return
+	}
+	tracked.mu.Lock()
+	defer tracked.mu.Unlock()
+	if tracked.done || tracked.call == nil {
+		return
+	}
+
+	c.updateCall(ctx, tracked, packet)
+	c.stats.record(tracked.call)
+
+	tracked.packets++
+	if tracked.packets%persistCallEvery == 0 {
+		c.persistCall(ctx, key, tracked.call)
+	}
+}
+
+// publishTXEvent notifies the source repeater's event stream of activity on one of its slots
+func (c *CallTracker) publishTXEvent(ctx context.Context, eventType string, call *models.Call) {
+	if call.RepeaterID == nil {
+		return
 	}
+	models.PublishRepeaterEvent(ctx, c.Redis, models.RepeaterEvent{
+		Type:          eventType,
+		RepeaterID:    *call.RepeaterID,
+		Slot:          models.SlotNumber(call.TimeSlot),
+		SourceID:      call.UserID,
+		DestinationID: call.DestinationID,
+	})
 }
 
 func endCallHandler(ctx context.Context, c *CallTracker, packet models.Packet) func() {
@@ -416,48 +479,70 @@ func endCallHandler(ctx context.Context, c *CallTracker, packet models.Packet) f
 
 // EndCall ends a call
 func (c *CallTracker) EndCall(ctx context.Context, packet models.Packet) {
-	// Querying on packet.StreamId and call.Active should be enough to find the call, but in the event that there are multiple calls
-	// active that somehow have the same StreamId, we'll also query on the other fields.
-	for _, call := range c.InFlightCalls {
-		if call.StreamID == packet.StreamID && call.Active && call.TimeSlot == packet.Slot && call.GroupCall == packet.GroupCall && call.UserID == packet.Src {
-			// Delete the call end timer
-			timer := c.CallEndTimers[call.ID]
-			timer.Stop()
-			delete(c.CallEndTimers, call.ID)
-
-			if time.Since(call.StartTime) < 100*time.Millisecond {
-				// This is probably a key-up, so delete the call from the db
-				call := call
-				c.DB.Delete(&call)
-				return
-			}
+	key := callKeyFor(packet)
+	tracked := c.calls.lookup(key)
+	if tracked == nil {
+		return
+	}
+	tracked.mu.Lock()
+	defer tracked.mu.Unlock()
+	if tracked.done || tracked.call == nil {
+		return
+	}
+	tracked.done = true
+	c.calls.remove(key, tracked)
+	tracked.timer.Stop()
+	c.clearInFlightCall(ctx, key)
+
+	call := tracked.call
+	if time.Since(call.StartTime) < 100*time.Millisecond {
+		// This is probably a key-up, so delete the call from the db
+		c.stats.forget(call.ID)
+		c.DB.Delete(call)
+		c.publishTXEvent(ctx, models.RepeaterEventTXEnd, call)
+		return
+	}
 
-			// If the call doesn't have a term, we lost that packet
-			if !call.HasTerm {
-				call.LostSequences++
-				call.TotalPackets++
-				if config.GetConfig().Debug {
-					klog.Errorf("Call %d ended without a term", packet.StreamID)
-				}
-			}
+	c.finishCall(ctx, call, tracked.watchers, packet, time.Now())
+}
 
-			// If lastFrameNum != 5, Calculate the number of lost packets by subtracting the last frame number from 5 and adding it to the lost sequences
-			if call.LastFrameNum != 5 {
-				call.LostSequences += 5 - call.LastFrameNum
-				call.TotalPackets += 5 - call.LastFrameNum
-				if config.GetConfig().Debug {
-					klog.Errorf("Call %d ended with %d lost packets", packet.StreamID, 5-call.LastFrameNum)
-				}
-			}
+// finishCall accounts for any packets lost at the end of a call and saves it as ended
+func (c *CallTracker) finishCall(ctx context.Context, call *models.Call, watchers []uint, packet models.Packet, endTime time.Time) {
+	c.stats.forget(call.ID)
 
-			call.Active = false
-			call.Duration = time.Since(call.StartTime)
-			call.Loss = float32(call.LostSequences / call.TotalPackets)
-			c.DB.Save(call)
-			c.publishCall(ctx, call, packet)
-			delete(c.InFlightCalls, call.ID)
+	// If the call doesn't have a term, we lost that packet
+	if !call.HasTerm {
+		call.LostSequences++
+		call.TotalPackets++
+		if config.GetConfig().Debug {
+			klog.Errorf("Call %d ended without a term", packet.StreamID)
+		}
+	}
 
-			klog.Infof("Call %d from %d to %d via %d ended with duration %v, %f%% Loss, %f%% BER, %fdBm RSSI, and %fms Jitter", packet.StreamID, packet.Src, packet.Dst, packet.Repeater, call.Duration, call.Loss*100, call.BER*100, call.RSSI, call.Jitter)
+	// If lastFrameNum != 5, Calculate the number of lost packets by subtracting the last frame number from 5 and adding it to the lost sequences
+	if call.LastFrameNum != 5 {
+		call.LostSequences += 5 - call.LastFrameNum
+		call.TotalPackets += 5 - call.LastFrameNum
+		if config.GetConfig().Debug {
+			klog.Errorf("Call %d ended with %d lost packets", packet.StreamID, 5-call.LastFrameNum)
 		}
 	}
+
+	call.Active = false
+	call.Blocked, call.Preempted = models.StreamContention(ctx, c.Redis, call.StreamID)
+	call.Rejected = models.StreamRejected(ctx, c.Redis, call.StreamID)
+	call.TimedOut = streamTimedOut(ctx, c.Redis, call.StreamID)
+	call.Duration = endTime.Sub(call.StartTime)
+	call.Sample(endTime, true)
+	call.Summarize()
+	c.DB.Save(call)
+	if len(call.Quality.Samples) > 0 {
+		if err := c.DB.Create(&call.Quality.Samples).Error; err != nil {
+			klog.Errorf("Error saving quality samples for call %d: %v", call.StreamID, err)
+		}
+	}
+	c.publishCall(ctx, call, watchers)
+	c.publishTXEvent(ctx, models.RepeaterEventTXEnd, call)
+
+	klog.Infof("Call %d from %d to %d via %d ended with duration %v, %f%% Loss, %f%% BER, %fdBm RSSI, and %fms Jitter", packet.StreamID, packet.Src, packet.Dst, packet.Repeater, call.Duration, call.Loss*100, call.BER*100, call.RSSI, call.Jitter)
 }
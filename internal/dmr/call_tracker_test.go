@@ -0,0 +1,286 @@
+package dmr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/dbtest"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/USA-RedDragon/DMRHub/internal/redistest"
+)
+
+func TestCallTableConcurrentStreams(t *testing.T) {
+	const streams = 200
+	const packetsPerStream = 50
+
+	table := newCallTable()
+	var creates sync.Map
+	var wg sync.WaitGroup
+	for stream := uint(1); stream <= streams; stream++ {
+		for i := 0; i < packetsPerStream; i++ {
+			wg.Add(1)
+			go func(stream uint) {
+				defer wg.Done()
+				key := callKeyFor(models.Packet{StreamID: stream, Src: 1, Dst: 91, GroupCall: true})
+				tracked, created := table.reserve(key)
+				if created {
+					tracked.call = &models.Call{StreamID: stream}
+					creates.Store(stream, true)
+					tracked.mu.Unlock()
+				}
+				tracked.mu.Lock()
+				tracked.call.TotalPackets++
+				tracked.mu.Unlock()
+			}(stream)
+		}
+	}
+	wg.Wait()
+
+	if table.len() != streams {
+		t.Fatalf("Expected %d calls, got %d", streams, table.len())
+	}
+	for stream := uint(1); stream <= streams; stream++ {
+		if _, ok := creates.Load(stream); !ok {
+			t.Errorf("Stream %d was never created", stream)
+		}
+		tracked := table.lookup(callKeyFor(models.Packet{StreamID: stream, Src: 1, Dst: 91, GroupCall: true}))
+		if tracked == nil {
+			t.Fatalf("Stream %d is not tracked", stream)
+		}
+		if tracked.call.TotalPackets != packetsPerStream {
+			t.Errorf("Stream %d counted %d packets, expected %d", stream, tracked.call.TotalPackets, packetsPerStream)
+		}
+	}
+}
+
+// newTestCallTracker builds a tracker on a recording database and an in-memory Redis,
+// with a user, repeater and talkgroup for every ID
+func newTestCallTracker(t testing.TB) (*CallTracker, *dbtest.DB, *redistest.Server) {
+	t.Helper()
+	// Load the config before goroutines race to
+	config.GetConfig()
+	db, recorder, err := dbtest.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisServer, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisClient := redisServer.Client()
+	t.Cleanup(func() {
+		_ = redisClient.Close()
+		redisServer.Close()
+	})
+	cache := newLookupCache(db, redisClient)
+	cache.loadUser = func(id uint) models.User {
+		return models.User{ID: id, Callsign: fmt.Sprintf("N%dTEST", id), Approved: true}
+	}
+	cache.loadRepeater = func(id uint) models.Repeater {
+		return models.Repeater{RadioID: id, Callsign: "W1AW", OwnerID: 3191868}
+	}
+	cache.loadTalkgroup = func(id uint) models.Talkgroup {
+		return models.Talkgroup{ID: id, Name: fmt.Sprintf("TG %d", id)}
+	}
+	return NewCallTracker(db, redisClient, cache), recorder, redisServer
+}
+
+func voicePacket(stream uint, frameType dmrconst.FrameType, dtypeOrVSeq uint) models.Packet {
+	return models.Packet{
+		Signature:   "DMRD",
+		StreamID:    stream,
+		Src:         3191868,
+		Dst:         91,
+		Repeater:    311860,
+		Slot:        stream%2 == 0,
+		GroupCall:   true,
+		FrameType:   frameType,
+		DTypeOrVSeq: dtypeOrVSeq,
+		BER:         -1,
+		RSSI:        -1,
+	}
+}
+
+// ageCall moves a call's start back so ending it isn't mistaken for a key-up
+func ageCall(t *testing.T, tracker *CallTracker, packet models.Packet) {
+	t.Helper()
+	tracked := tracker.calls.lookup(callKeyFor(packet))
+	if tracked == nil {
+		t.Fatalf("Stream %d is not tracked", packet.StreamID)
+	}
+	tracked.mu.Lock()
+	tracked.call.StartTime = tracked.call.StartTime.Add(-time.Second)
+	tracked.mu.Unlock()
+}
+
+func TestCallTrackerConcurrentStreams(t *testing.T) {
+	const streams = 20
+	const superframes = 5
+
+	tracker, recorder, redisServer := newTestCallTracker(t)
+	server := &Server{CallTracker: tracker}
+	ctx := context.Background()
+
+	// The packet handler tracks every frame in its own goroutine, so frames of a stream race each other
+	var wg sync.WaitGroup
+	for stream := uint(1); stream <= streams; stream++ {
+		frames := []models.Packet{voicePacket(stream, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceHead))}
+		for i := 0; i < superframes; i++ {
+			frames = append(frames, voicePacket(stream, dmrconst.FrameVoiceSync, 0))
+			for seq := uint(1); seq <= 5; seq++ {
+				frames = append(frames, voicePacket(stream, dmrconst.FrameVoice, seq))
+			}
+		}
+		for _, frame := range frames {
+			wg.Add(1)
+			go func(frame models.Packet) {
+				defer wg.Done()
+				server.trackCall(ctx, frame)
+			}(frame)
+		}
+	}
+	wg.Wait()
+
+	if n := len(recorder.Matching(`INSERT INTO "calls"`)); n != streams {
+		t.Fatalf("Expected %d calls created, got %d", streams, n)
+	}
+	if n := tracker.calls.len(); n != streams {
+		t.Fatalf("Expected %d calls tracked, got %d", streams, n)
+	}
+	if n := len(redisServer.Keys(inFlightCallPrefix + "*")); n != streams {
+		t.Errorf("Expected %d calls persisted, got %d", streams, n)
+	}
+	for stream := uint(1); stream <= streams; stream++ {
+		tracked := tracker.calls.lookup(callKeyFor(voicePacket(stream, 0, 0)))
+		tracked.mu.Lock()
+		total := tracked.call.TotalPackets
+		tracked.mu.Unlock()
+		// Frames that overtake each other can be counted as lost, but never go missing
+		if total < 1+superframes*6 {
+			t.Errorf("Stream %d counted %d packets, expected at least %d", stream, total, 1+superframes*6)
+		}
+		ageCall(t, tracker, voicePacket(stream, 0, 0))
+	}
+
+	// Terminators are often repeated, and every copy races to end the call
+	for stream := uint(1); stream <= streams; stream++ {
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(stream uint) {
+				defer wg.Done()
+				server.trackCall(ctx, voicePacket(stream, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceTerm)))
+			}(stream)
+		}
+	}
+	wg.Wait()
+
+	if n := tracker.calls.len(); n != 0 {
+		t.Errorf("Expected every call to end, %d still tracked", n)
+	}
+	if n := len(redisServer.Keys(inFlightCallPrefix + "*")); n != 0 {
+		t.Errorf("Expected in-flight state to be cleared, %d left", n)
+	}
+	if n := len(recorder.Matching(`UPDATE "calls"`, `"active"=`)); n != streams {
+		t.Errorf("Expected each call to be saved as ended once, got %d saves", n)
+	}
+}
+
+func TestCallTrackerConcurrentEnd(t *testing.T) {
+	tracker, recorder, _ := newTestCallTracker(t)
+	ctx := context.Background()
+	header := voicePacket(42, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceHead))
+	tracker.StartCall(ctx, header)
+	tracker.ProcessCallPacket(ctx, header)
+	ageCall(t, tracker, header)
+
+	// The end timer and terminators can race to end the same call
+	term := voicePacket(42, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceTerm))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			tracker.EndCall(ctx, term)
+		}()
+		go func() {
+			defer wg.Done()
+			endCallHandler(ctx, tracker, header)()
+		}()
+	}
+	wg.Wait()
+
+	if tracker.IsCallActive(header) {
+		t.Error("Ended call is still tracked")
+	}
+	if n := len(recorder.Matching(`UPDATE "calls"`, `"active"=`)); n != 1 {
+		t.Errorf("Call was ended %d times", n)
+	}
+}
+
+func TestCallTableBridgedCopies(t *testing.T) {
+	table := newCallTable()
+	original := callKeyFor(models.Packet{StreamID: 42, Src: 1, Dst: 91, GroupCall: true})
+	bridged := callKeyFor(models.Packet{StreamID: 42, Src: 1, Dst: 3100, GroupCall: true})
+	first, created := table.reserve(original)
+	if !created {
+		t.Fatal("Expected the original stream to be created")
+	}
+	first.mu.Unlock()
+	second, created := table.reserve(bridged)
+	if !created {
+		t.Fatal("Expected the bridged copy to be tracked separately")
+	}
+	second.mu.Unlock()
+
+	// Removing a stale entry must not drop the current one
+	table.remove(original, second)
+	if table.lookup(original) != first {
+		t.Error("Removed the wrong call")
+	}
+}
+
+func TestInFlightCallRoundTrip(t *testing.T) {
+	key := callKeyFor(models.Packet{StreamID: 42, Src: 1, Dst: 91, Slot: true, GroupCall: true})
+	call := models.Call{
+		ID:             7,
+		TotalPackets:   120,
+		LostSequences:  3,
+		LastFrameNum:   4,
+		LastPacketTime: time.Now().Truncate(time.Millisecond),
+		HasHeader:      true,
+	}
+	for i := 0; i < 10; i++ {
+		call.Quality.AddJitter(time.Duration(58+i) * time.Millisecond)
+		call.Quality.AddBits(uint(i))
+		call.Quality.AddRSSI(80 + i)
+	}
+	call.Summarize()
+
+	stateJSON, err := json.Marshal(snapshotInFlightCall(key, &call))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state inFlightCall
+	if err := json.Unmarshal(stateJSON, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Key != key || state.CallID != call.ID {
+		t.Fatalf("Expected key %v and call %d, got %v and %d", key, call.ID, state.Key, state.CallID)
+	}
+
+	var resumed models.Call
+	state.apply(&resumed)
+	if resumed.TotalPackets != call.TotalPackets || resumed.LostSequences != call.LostSequences ||
+		resumed.LastFrameNum != call.LastFrameNum || resumed.TotalBits != call.TotalBits ||
+		resumed.Jitter != call.Jitter || resumed.JitterP95 != call.JitterP95 || resumed.BER != call.BER ||
+		resumed.RSSI != call.RSSI || resumed.RSSIMin != call.RSSIMin || resumed.Loss != call.Loss ||
+		!resumed.LastPacketTime.Equal(call.LastPacketTime) || resumed.HasHeader != call.HasHeader || resumed.HasTerm != call.HasTerm {
+		t.Errorf("Resumed call %+v does not match %+v", resumed, call)
+	}
+}
@@ -0,0 +1,151 @@
+package dmr
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"k8s.io/klog/v2"
+)
+
+const dynamicTalkgroupCheckInterval = 30 * time.Second
+
+// dynamicTalkgroupLock keeps multiple instances from sweeping at the same time
+const dynamicTalkgroupLock = "dynamic-talkgroup:lock"
+
+// parseOptionsTimer finds the TIMER= option in an RPTO options string such as "TS1=1,2;TS2=3;TIMER=10"
+func parseOptionsTimer(options string) (uint, bool) {
+	for _, option := range strings.Split(options, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(option), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(key), "TIMER") {
+			continue
+		}
+		timer, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		if err != nil {
+			klog.Warningf("Invalid TIMER option %q", value)
+			return 0, false
+		}
+		return uint(timer), true
+	}
+	return 0, false
+}
+
+// auditDynamicLink records a dynamic talkgroup change made on the air by actorID,
+// or by the timeout sweep when actorID is nil. A talkgroup of 0 means nothing was linked.
+func (s *Server) auditDynamicLink(repeaterID uint, slot bool, oldTGID uint, newTGID uint, actorID *uint) {
+	entry := models.AuditLog{
+		Source:     models.AuditSourceSystem,
+		Action:     models.AuditRepeaterLink,
+		TargetType: models.AuditTargetRepeater,
+		TargetID:   repeaterID,
+	}
+	if newTGID == 0 {
+		entry.Action = models.AuditRepeaterUnlink
+	} else {
+		entry.After = models.NewAuditValue(models.AuditLink{Type: "dynamic", Slot: models.SlotNumber(slot), TalkgroupID: newTGID})
+	}
+	if oldTGID != 0 {
+		entry.Before = models.NewAuditValue(models.AuditLink{Type: "dynamic", Slot: models.SlotNumber(slot), TalkgroupID: oldTGID})
+	}
+	if actorID != nil {
+		entry.Source = models.AuditSourceOnAir
+		entry.ActorID = actorID
+		if user, ok := s.cache.user(*actorID); ok {
+			entry.ActorCallsign = user.Callsign
+		}
+	}
+	models.RecordAudit(s.DB, entry)
+}
+
+// unlinkDynamicTalkgroup drops the dynamic talkgroup linked on one of a repeater's slots.
+// actorID is the radio that asked for it, nil when it timed out.
+// Only the slot's link is written, so the caller mustn't save the repeater afterwards.
+func (s *Server) unlinkDynamicTalkgroup(ctx context.Context, repeater *models.Repeater, slot bool, actorID *uint) {
+	var oldTGID uint
+	if slot {
+		if repeater.TS2DynamicTalkgroupID == nil {
+			return
+		}
+		oldTGID = *repeater.TS2DynamicTalkgroupID
+		s.DB.Model(repeater).Select("TS2DynamicTalkgroupID").Updates(map[string]interface{}{"TS2DynamicTalkgroupID": nil})
+		err := s.DB.Model(repeater).Association("TS2DynamicTalkgroup").Delete(&repeater.TS2DynamicTalkgroup)
+		if err != nil {
+			klog.Errorf("Error deleting TS2DynamicTalkgroup: %s", err)
+		}
+	} else {
+		if repeater.TS1DynamicTalkgroupID == nil {
+			return
+		}
+		oldTGID = *repeater.TS1DynamicTalkgroupID
+		s.DB.Model(repeater).Select("TS1DynamicTalkgroupID").Updates(map[string]interface{}{"TS1DynamicTalkgroupID": nil})
+		err := s.DB.Model(repeater).Association("TS1DynamicTalkgroup").Delete(&repeater.TS1DynamicTalkgroup)
+		if err != nil {
+			klog.Errorf("Error deleting TS1DynamicTalkgroup: %s", err)
+		}
+	}
+	repeater.CancelSubscription(oldTGID)
+	s.cache.invalidateRepeater(ctx, repeater.RadioID)
+	models.ClearDynamicTalkgroupActivity(ctx, s.Redis.Redis, repeater.RadioID, slot)
+	s.publishLinkEvent(ctx, models.RepeaterEventUnlink, repeater.RadioID, slot, oldTGID)
+	s.auditDynamicLink(repeater.RadioID, slot, oldTGID, 0, actorID)
+}
+
+// expireDynamicTalkgroups unlinks dynamic talkgroups that haven't seen local activity within their timeout
+func (s *Server) expireDynamicTalkgroups(ctx context.Context) {
+	locked, err := s.Redis.Redis.SetNX(ctx, dynamicTalkgroupLock, 1, dynamicTalkgroupCheckInterval-time.Second).Result()
+	if err != nil {
+		klog.Errorf("Error locking dynamic talkgroup check: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+
+	for _, repeater := range models.ListRepeatersWithDynamicTalkgroups(s.DB) {
+		repeater := repeater
+		var optionsTimer *uint
+		if live, err := s.Redis.get(ctx, repeater.RadioID); err == nil {
+			optionsTimer = live.OptionsTimer
+		}
+		timeout := repeater.EffectiveDynamicTalkgroupTimeout(optionsTimer)
+		if timeout == 0 {
+			continue
+		}
+
+		for _, slot := range []bool{false, true} {
+			if (slot && repeater.TS2DynamicTalkgroupID == nil) || (!slot && repeater.TS1DynamicTalkgroupID == nil) {
+				continue
+			}
+			lastActivity, ok := models.DynamicTalkgroupLastActivity(ctx, s.Redis.Redis, repeater.RadioID, slot)
+			if !ok {
+				// Links made before a restart or through the API start their timeout now
+				models.TouchDynamicTalkgroup(ctx, s.Redis.Redis, repeater.RadioID, slot)
+				continue
+			}
+			if time.Since(lastActivity) < timeout {
+				continue
+			}
+			klog.Infof("Unlinking timeslot %d from %d after %v of inactivity", models.SlotNumber(slot), repeater.RadioID, timeout)
+			s.unlinkDynamicTalkgroup(ctx, &repeater, slot, nil)
+		}
+	}
+}
+
+func (s *Server) listenDynamicTalkgroupTimeouts(ctx context.Context) {
+	ticker := time.NewTicker(dynamicTalkgroupCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if config.GetConfig().Debug {
+				klog.Info("Checking for inactive dynamic talkgroups")
+			}
+			s.expireDynamicTalkgroups(ctx)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package dmr
+
+import "testing"
+
+func TestParseOptionsTimer(t *testing.T) {
+	tests := []struct {
+		options string
+		want    uint
+		found   bool
+	}{
+		{"TS1=1,2;TS2=3;TIMER=10", 10, true},
+		{"timer=0", 0, true},
+		{"TS1=1; TIMER = 30 ;TS2=2", 30, true},
+		{"TS1=1;TS2=2", 0, false},
+		{"TIMER=soon", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, found := parseOptionsTimer(tt.options)
+		if got != tt.want || found != tt.found {
+			t.Errorf("parseOptionsTimer(%q) = %d, %v, want %d, %v", tt.options, got, found, tt.want, tt.found)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package lc
+
+import "github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+
+// Block product turbo code (196,96), which carries the full link control of
+// voice headers and terminators in the two 98 bit halves of a data burst
+
+var headerMask = [3]byte{0x96, 0x96, 0x96}
+var terminatorMask = [3]byte{0x99, 0x99, 0x99}
+
+func crcMask(dataType dmrconst.DataType) [3]byte {
+	if dataType == dmrconst.DTypeVoiceTerm {
+		return terminatorMask
+	}
+	return headerMask
+}
+
+// bptcDataPositions lists the positions of the 96 data bits in the deinterleaved matrix
+var bptcDataPositions = func() []int {
+	positions := make([]int, 0, 96)
+	for i := 4; i <= 11; i++ {
+		positions = append(positions, i)
+	}
+	for row := 1; row < 9; row++ {
+		for i := row*15 + 1; i <= row*15+11; i++ {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}()
+
+// burstInfoBits reads the 196 information bits either side of the sync and slot type
+func burstInfoBits(burst [33]byte) [196]bool {
+	var bits [196]bool
+	for i := 0; i < 98; i++ {
+		bits[i] = getBit(burst[:], i)
+		bits[98+i] = getBit(burst[:], 166+i)
+	}
+	return bits
+}
+
+func setBurstInfoBits(burst *[33]byte, bits [196]bool) {
+	for i := 0; i < 98; i++ {
+		setBit(burst[:], i, bits[i])
+		setBit(burst[:], 166+i, bits[98+i])
+	}
+}
+
+func bptcDecode(raw [196]bool) [12]byte {
+	var matrix [196]bool
+	for i := 0; i < 196; i++ {
+		matrix[i] = raw[(i*181)%196]
+	}
+	var data [12]byte
+	for i, pos := range bptcDataPositions {
+		setBit(data[:], i, matrix[pos])
+	}
+	return data
+}
+
+func bptcEncode(data [12]byte) [196]bool {
+	var matrix [196]bool
+	for i, pos := range bptcDataPositions {
+		matrix[pos] = getBit(data[:], i)
+	}
+
+	// Hamming (15,11,3) across each of the 9 data rows
+	for row := 0; row < 9; row++ {
+		hamming15113(matrix[row*15+1 : row*15+16])
+	}
+
+	// Hamming (13,9,3) down each of the 15 columns
+	var col [13]bool
+	for c := 0; c < 15; c++ {
+		for r := 0; r < 13; r++ {
+			col[r] = matrix[r*15+c+1]
+		}
+		hamming1393(col[:])
+		for r := 0; r < 13; r++ {
+			matrix[r*15+c+1] = col[r]
+		}
+	}
+
+	var raw [196]bool
+	for i := 0; i < 196; i++ {
+		raw[(i*181)%196] = matrix[i]
+	}
+	return raw
+}
+
+func hamming15113(d []bool) {
+	d[11] = d[0] != d[1] != d[2] != d[3] != d[5] != d[7] != d[8]
+	d[12] = d[1] != d[2] != d[3] != d[4] != d[6] != d[8] != d[9]
+	d[13] = d[2] != d[3] != d[4] != d[5] != d[7] != d[9] != d[10]
+	d[14] = d[0] != d[1] != d[2] != d[4] != d[6] != d[7] != d[10]
+}
+
+func hamming1393(d []bool) {
+	d[9] = d[0] != d[1] != d[3] != d[5] != d[6]
+	d[10] = d[0] != d[1] != d[2] != d[4] != d[6] != d[7]
+	d[11] = d[0] != d[1] != d[2] != d[3] != d[5] != d[7] != d[8]
+	d[12] = d[0] != d[2] != d[4] != d[5] != d[8]
+}
+
+// DecodeFullLC reads the link control from a voice header or terminator burst
+func DecodeFullLC(burst [33]byte, dataType dmrconst.DataType) (LC, error) {
+	data := bptcDecode(burstInfoBits(burst))
+	var lcBytes [9]byte
+	copy(lcBytes[:], data[:9])
+	parity := rsParity(lcBytes)
+	mask := crcMask(dataType)
+	for i := 0; i < 3; i++ {
+		if data[9+i]^mask[i] != parity[i] {
+			return LC{}, ErrBadChecksum
+		}
+	}
+	return FromBytes(lcBytes), nil
+}
+
+// EncodeFullLC writes the link control into a voice header or terminator burst,
+// leaving the slot type and sync pattern untouched
+func EncodeFullLC(burst *[33]byte, lc LC, dataType dmrconst.DataType) {
+	lcBytes := lc.Bytes()
+	parity := rsParity(lcBytes)
+	mask := crcMask(dataType)
+	var data [12]byte
+	copy(data[:9], lcBytes[:])
+	for i := 0; i < 3; i++ {
+		data[9+i] = parity[i] ^ mask[i]
+	}
+	setBurstInfoBits(burst, bptcEncode(data))
+}
@@ -0,0 +1,125 @@
+package lc
+
+// Embedded link control, spread across the 32 bit embedded signalling field of
+// voice bursts B through E
+
+// embeddedDataPositions lists where the 72 LC bits sit in the 8x16 embedded matrix
+var embeddedDataPositions = func() []int {
+	positions := make([]int, 0, 72)
+	for i := 0; i < 11; i++ {
+		positions = append(positions, i)
+	}
+	for i := 16; i < 27; i++ {
+		positions = append(positions, i)
+	}
+	for row := 2; row < 7; row++ {
+		for i := row * 16; i < row*16+10; i++ {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}()
+
+// The 5 bit checksum is stored in the last column of rows 2 through 6
+var embeddedCRCPositions = [5]int{42, 58, 74, 90, 106}
+
+func embeddedChecksum(data [9]byte) byte {
+	var total uint
+	for _, b := range data {
+		total += uint(b)
+	}
+	return byte(total % 31)
+}
+
+func hamming16114(d []bool) {
+	d[11] = d[0] != d[1] != d[2] != d[3] != d[5] != d[7] != d[8]
+	d[12] = d[1] != d[2] != d[3] != d[4] != d[6] != d[8] != d[9]
+	d[13] = d[2] != d[3] != d[4] != d[5] != d[7] != d[9] != d[10]
+	d[14] = d[0] != d[1] != d[2] != d[4] != d[6] != d[7] != d[10]
+	d[15] = d[0] != d[2] != d[5] != d[6] != d[8] != d[9] != d[10]
+}
+
+// embeddedEncode returns the 128 transmitted bits, in fragment order
+func embeddedEncode(lc LC) [128]bool {
+	lcBytes := lc.Bytes()
+	var matrix [128]bool
+	for i, pos := range embeddedDataPositions {
+		matrix[pos] = getBit(lcBytes[:], i)
+	}
+	crc := embeddedChecksum(lcBytes)
+	for i, pos := range embeddedCRCPositions {
+		matrix[pos] = crc&(0x10>>i) != 0
+	}
+	for row := 0; row < 7; row++ {
+		hamming16114(matrix[row*16 : row*16+16])
+	}
+	for c := 0; c < 16; c++ {
+		parity := false
+		for row := 0; row < 7; row++ {
+			parity = parity != matrix[row*16+c]
+		}
+		matrix[112+c] = parity
+	}
+
+	// The matrix is transmitted column by column
+	var raw [128]bool
+	b := 0
+	for a := 0; a < 128; a++ {
+		raw[a] = matrix[b]
+		b += 16
+		if b > 127 {
+			b -= 127
+		}
+	}
+	return raw
+}
+
+// embeddedDecode reassembles the link control from the 128 transmitted bits
+func embeddedDecode(raw [128]bool) (LC, error) {
+	var matrix [128]bool
+	b := 0
+	for a := 0; a < 128; a++ {
+		matrix[b] = raw[a]
+		b += 16
+		if b > 127 {
+			b -= 127
+		}
+	}
+	var lcBytes [9]byte
+	for i, pos := range embeddedDataPositions {
+		setBit(lcBytes[:], i, matrix[pos])
+	}
+	var crc byte
+	for i, pos := range embeddedCRCPositions {
+		if matrix[pos] {
+			crc |= 0x10 >> i
+		}
+	}
+	if crc != embeddedChecksum(lcBytes) {
+		return LC{}, ErrBadChecksum
+	}
+	return FromBytes(lcBytes), nil
+}
+
+// EncodeEmbeddedLC writes fragment vseq (1-4) of the link control into a voice burst
+func EncodeEmbeddedLC(burst *[33]byte, lc LC, vseq uint) {
+	if vseq < 1 || vseq > 4 {
+		return
+	}
+	raw := embeddedEncode(lc)
+	offset := int(vseq-1) * 32
+	for i := 0; i < 32; i++ {
+		setBit(burst[:], 116+i, raw[offset+i])
+	}
+}
+
+// DecodeEmbeddedLC reassembles the link control from voice bursts B through E
+func DecodeEmbeddedLC(bursts [4][33]byte) (LC, error) {
+	var raw [128]bool
+	for n, burst := range bursts {
+		for i := 0; i < 32; i++ {
+			raw[n*32+i] = getBit(burst[:], 116+i)
+		}
+	}
+	return embeddedDecode(raw)
+}
@@ -0,0 +1,108 @@
+// Package lc encodes and decodes the DMR link control carried in voice
+// headers, terminators and the embedded signalling of voice bursts.
+package lc
+
+import (
+	"errors"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+)
+
+// Full link control opcodes
+const (
+	FLCOGroupVoice   byte = 0x00
+	FLCOPrivateVoice byte = 0x03
+)
+
+// ErrBadChecksum is returned when the link control fails its checksum
+var ErrBadChecksum = errors.New("link control checksum mismatch")
+
+// LC is a decoded DMR full link control
+type LC struct {
+	ProtectFlag    bool
+	FLCO           byte
+	FID            byte
+	ServiceOptions byte
+	Dst            uint
+	Src            uint
+}
+
+// New builds the link control for a voice call between src and dst
+func New(groupCall bool, src uint, dst uint) LC {
+	lc := LC{
+		FLCO: FLCOGroupVoice,
+		Src:  src,
+		Dst:  dst,
+	}
+	if !groupCall {
+		lc.FLCO = FLCOPrivateVoice
+	}
+	return lc
+}
+
+// Bytes packs the link control into its 9 byte over-the-air form
+func (lc LC) Bytes() [9]byte {
+	var data [9]byte
+	data[0] = lc.FLCO & 0x3F
+	if lc.ProtectFlag {
+		data[0] |= 0x80
+	}
+	data[1] = lc.FID
+	data[2] = lc.ServiceOptions
+	data[3] = byte(lc.Dst >> 16)
+	data[4] = byte(lc.Dst >> 8)
+	data[5] = byte(lc.Dst)
+	data[6] = byte(lc.Src >> 16)
+	data[7] = byte(lc.Src >> 8)
+	data[8] = byte(lc.Src)
+	return data
+}
+
+// FromBytes unpacks a 9 byte link control
+func FromBytes(data [9]byte) LC {
+	return LC{
+		ProtectFlag:    data[0]&0x80 != 0,
+		FLCO:           data[0] & 0x3F,
+		FID:            data[1],
+		ServiceOptions: data[2],
+		Dst:            uint(data[3])<<16 | uint(data[4])<<8 | uint(data[5]),
+		Src:            uint(data[6])<<16 | uint(data[7])<<8 | uint(data[8]),
+	}
+}
+
+// Rewrite replaces the source and destination carried in the link control of a
+// voice burst so that radios display the IDs the packet header was rewritten to.
+// Voice headers and terminators keep their feature ID and service options.
+func Rewrite(burst *[33]byte, frameType dmrconst.FrameType, dtypeOrVSeq uint, groupCall bool, src uint, dst uint) {
+	switch frameType {
+	case dmrconst.FrameDataSync:
+		dataType := dmrconst.DataType(dtypeOrVSeq)
+		if dataType != dmrconst.DTypeVoiceHead && dataType != dmrconst.DTypeVoiceTerm {
+			return
+		}
+		lc, err := DecodeFullLC(*burst, dataType)
+		if err != nil {
+			lc = New(groupCall, src, dst)
+		}
+		lc.Src = src
+		lc.Dst = dst
+		EncodeFullLC(burst, lc, dataType)
+	case dmrconst.FrameVoice:
+		// Bursts B through E carry the four embedded LC fragments
+		if dtypeOrVSeq >= 1 && dtypeOrVSeq <= 4 {
+			EncodeEmbeddedLC(burst, New(groupCall, src, dst), dtypeOrVSeq)
+		}
+	}
+}
+
+func getBit(data []byte, i int) bool {
+	return data[i/8]&(0x80>>(i%8)) != 0
+}
+
+func setBit(data []byte, i int, value bool) {
+	if value {
+		data[i/8] |= 0x80 >> (i % 8)
+	} else {
+		data[i/8] &^= 0x80 >> (i % 8)
+	}
+}
@@ -0,0 +1,144 @@
+package lc_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/lc"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+)
+
+func syncBurst() [33]byte {
+	// Random looking info bits with the BS voice sync in the middle
+	var burst [33]byte
+	for i := range burst {
+		burst[i] = byte(i*37 + 11)
+	}
+	copy(burst[13:20], []byte{0x75, 0x5F, 0xD7, 0xDF, 0x75, 0xF7, 0x00})
+	return burst
+}
+
+func TestLCBytes(t *testing.T) {
+	original := lc.LC{
+		ProtectFlag:    true,
+		FLCO:           lc.FLCOPrivateVoice,
+		FID:            0x10,
+		ServiceOptions: 0x20,
+		Dst:            3120000,
+		Src:            3191868,
+	}
+	if decoded := lc.FromBytes(original.Bytes()); decoded != original {
+		t.Errorf("LC did not survive a round trip: %+v != %+v", decoded, original)
+	}
+}
+
+func TestFullLCRoundTrip(t *testing.T) {
+	for _, dataType := range []dmrconst.DataType{dmrconst.DTypeVoiceHead, dmrconst.DTypeVoiceTerm} {
+		burst := syncBurst()
+		original := lc.New(true, 3191868, 3100)
+		original.ServiceOptions = 0x40
+		lc.EncodeFullLC(&burst, original, dataType)
+
+		decoded, err := lc.DecodeFullLC(burst, dataType)
+		if err != nil {
+			t.Fatalf("Failed to decode full LC: %v", err)
+		}
+		if decoded != original {
+			t.Errorf("Full LC did not survive a round trip: %+v != %+v", decoded, original)
+		}
+	}
+}
+
+func TestFullLCMask(t *testing.T) {
+	burst := syncBurst()
+	lc.EncodeFullLC(&burst, lc.New(true, 3191868, 3100), dmrconst.DTypeVoiceHead)
+	if _, err := lc.DecodeFullLC(burst, dmrconst.DTypeVoiceTerm); err == nil {
+		t.Error("Expected a voice header LC not to pass the terminator checksum")
+	}
+}
+
+func TestFullLCCorrupt(t *testing.T) {
+	burst := syncBurst()
+	lc.EncodeFullLC(&burst, lc.New(true, 3191868, 3100), dmrconst.DTypeVoiceHead)
+	// Flip every bit of the first information byte
+	burst[0] ^= 0xFF
+	if _, err := lc.DecodeFullLC(burst, dmrconst.DTypeVoiceHead); err == nil {
+		t.Error("Expected a corrupted LC to fail its checksum")
+	}
+}
+
+func TestFullLCPreservesSync(t *testing.T) {
+	burst := syncBurst()
+	before := burst
+	lc.EncodeFullLC(&burst, lc.New(false, 3191868, 3120000), dmrconst.DTypeVoiceTerm)
+	// Bits 98 through 165 are the slot type and sync, which must not change
+	for i := 98; i < 166; i++ {
+		mask := byte(0x80 >> (i % 8))
+		if burst[i/8]&mask != before[i/8]&mask {
+			t.Fatalf("Bit %d outside the info field changed", i)
+		}
+	}
+}
+
+func TestEmbeddedLCRoundTrip(t *testing.T) {
+	original := lc.New(true, 3191868, 3100)
+	var bursts [4][33]byte
+	for vseq := uint(1); vseq <= 4; vseq++ {
+		bursts[vseq-1] = syncBurst()
+		lc.EncodeEmbeddedLC(&bursts[vseq-1], original, vseq)
+	}
+	decoded, err := lc.DecodeEmbeddedLC(bursts)
+	if err != nil {
+		t.Fatalf("Failed to decode embedded LC: %v", err)
+	}
+	if decoded != original {
+		t.Errorf("Embedded LC did not survive a round trip: %+v != %+v", decoded, original)
+	}
+
+	bursts[2][15] ^= 0x01
+	if _, err := lc.DecodeEmbeddedLC(bursts); err == nil {
+		t.Error("Expected a corrupted embedded LC to fail its checksum")
+	}
+}
+
+func TestEmbeddedLCPreservesEMB(t *testing.T) {
+	burst := syncBurst()
+	before := burst
+	lc.EncodeEmbeddedLC(&burst, lc.New(true, 1, 2), 2)
+	for i := 0; i < 264; i++ {
+		if i >= 116 && i < 148 {
+			continue
+		}
+		mask := byte(0x80 >> (i % 8))
+		if burst[i/8]&mask != before[i/8]&mask {
+			t.Fatalf("Bit %d outside the embedded LC field changed", i)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	burst := syncBurst()
+	original := lc.New(true, 3191868, 9)
+	original.ServiceOptions = 0x40
+	lc.EncodeFullLC(&burst, original, dmrconst.DTypeVoiceHead)
+
+	lc.Rewrite(&burst, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceHead), true, 3191868, 3100)
+	decoded, err := lc.DecodeFullLC(burst, dmrconst.DTypeVoiceHead)
+	if err != nil {
+		t.Fatalf("Failed to decode rewritten LC: %v", err)
+	}
+	if decoded.Dst != 3100 {
+		t.Errorf("Expected destination 3100, got %d", decoded.Dst)
+	}
+	if decoded.ServiceOptions != 0x40 {
+		t.Errorf("Expected service options to be kept, got %#x", decoded.ServiceOptions)
+	}
+
+	// Voice sync and the last burst of a superframe carry no LC
+	voiceSync := syncBurst()
+	before := voiceSync
+	lc.Rewrite(&voiceSync, dmrconst.FrameVoiceSync, 0, true, 3191868, 3100)
+	lc.Rewrite(&voiceSync, dmrconst.FrameVoice, 5, true, 3191868, 3100)
+	if voiceSync != before {
+		t.Error("Expected bursts without LC to be left alone")
+	}
+}
@@ -0,0 +1,42 @@
+package lc
+
+// Reed-Solomon (12,9) over GF(256), used to protect the full link control
+
+var rsGenerator = [3]byte{64, 56, 14}
+
+var gfExp [512]byte
+var gfLog [256]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// rsParity computes the three parity bytes of the link control, in transmission order
+func rsParity(data [9]byte) [3]byte {
+	var parity [3]byte
+	for _, b := range data {
+		feedback := b ^ parity[2]
+		parity[2] = parity[1] ^ gfMul(rsGenerator[2], feedback)
+		parity[1] = parity[0] ^ gfMul(rsGenerator[1], feedback)
+		parity[0] = gfMul(rsGenerator[0], feedback)
+	}
+	return [3]byte{parity[2], parity[1], parity[0]}
+}
@@ -0,0 +1,207 @@
+package dmr
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// lookupCacheTTL bounds how stale an entry can get if an invalidation is ever missed
+const lookupCacheTTL = 5 * time.Minute
+
+type cachedRepeater struct {
+	repeater models.Repeater
+	expires  time.Time
+}
+
+type cachedUser struct {
+	user    models.User
+	expires time.Time
+}
+
+type cachedTalkgroup struct {
+	talkgroup models.Talkgroup
+	expires   time.Time
+}
+
+// lookupCache keeps the repeaters, users and talkgroups the packet path needs in memory.
+// Misses are cached too, so unknown IDs don't hit the database every frame.
+// Anything that changes one of these models must invalidate it, see models.InvalidateRepeaterCache.
+type lookupCache struct {
+	mu         sync.RWMutex
+	repeaters  map[uint]cachedRepeater
+	users      map[uint]cachedUser
+	talkgroups map[uint]cachedTalkgroup
+	// generation moves on with every eviction, so a load that raced one isn't stored
+	generation uint64
+
+	redis         *redis.Client
+	loadRepeater  func(id uint) models.Repeater
+	loadUser      func(id uint) models.User
+	loadTalkgroup func(id uint) models.Talkgroup
+}
+
+func newLookupCache(db *gorm.DB, redis *redis.Client) *lookupCache {
+	return &lookupCache{
+		repeaters:  make(map[uint]cachedRepeater),
+		users:      make(map[uint]cachedUser),
+		talkgroups: make(map[uint]cachedTalkgroup),
+		redis:      redis,
+		loadRepeater: func(id uint) models.Repeater {
+			return models.FindRepeaterByID(db, id)
+		},
+		loadUser: func(id uint) models.User {
+			return models.FindUserByID(db, id)
+		},
+		loadTalkgroup: func(id uint) models.Talkgroup {
+			return models.FindTalkgroupByID(db, id)
+		},
+	}
+}
+
+// repeater returns a copy of the repeater, which is shared with other callers.
+// Its slices must not be modified, and anything saved must be invalidated.
+func (c *lookupCache) repeater(id uint) (models.Repeater, bool) {
+	c.mu.RLock()
+	entry, ok := c.repeaters[id]
+	generation := c.generation
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expires) {
+		entry = cachedRepeater{repeater: c.loadRepeater(id), expires: time.Now().Add(lookupCacheTTL)}
+		c.mu.Lock()
+		if c.generation == generation {
+			c.repeaters[id] = entry
+		}
+		c.mu.Unlock()
+	}
+	return entry.repeater, entry.repeater.RadioID != 0
+}
+
+func (c *lookupCache) user(id uint) (models.User, bool) {
+	c.mu.RLock()
+	entry, ok := c.users[id]
+	generation := c.generation
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expires) {
+		entry = cachedUser{user: c.loadUser(id), expires: time.Now().Add(lookupCacheTTL)}
+		c.mu.Lock()
+		if c.generation == generation {
+			c.users[id] = entry
+		}
+		c.mu.Unlock()
+	}
+	return entry.user, entry.user.ID != 0
+}
+
+// userEmail finds a user's verified email address for notifications
+func (c *lookupCache) userEmail(id uint) (string, bool) {
+	user, ok := c.user(id)
+	if !ok || !user.EmailVerified || user.Email == "" {
+		return "", false
+	}
+	return user.Email, true
+}
+
+func (c *lookupCache) talkgroup(id uint) (models.Talkgroup, bool) {
+	c.mu.RLock()
+	entry, ok := c.talkgroups[id]
+	generation := c.generation
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expires) {
+		entry = cachedTalkgroup{talkgroup: c.loadTalkgroup(id), expires: time.Now().Add(lookupCacheTTL)}
+		c.mu.Lock()
+		if c.generation == generation {
+			c.talkgroups[id] = entry
+		}
+		c.mu.Unlock()
+	}
+	return entry.talkgroup, entry.talkgroup.ID != 0
+}
+
+func (c *lookupCache) evict(kind string, id uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	switch kind {
+	case models.CacheKindRepeater:
+		delete(c.repeaters, id)
+	case models.CacheKindUser:
+		delete(c.users, id)
+	case models.CacheKindTalkgroup:
+		delete(c.talkgroups, id)
+	default:
+		klog.Warningf("Unknown cache kind %s", kind)
+	}
+}
+
+// invalidateRepeater drops the repeater here straight away, so the next packet
+// sees the change, and tells the other instances to do the same
+func (c *lookupCache) invalidateRepeater(ctx context.Context, id uint) {
+	c.evict(models.CacheKindRepeater, id)
+	models.InvalidateRepeaterCache(ctx, c.redis, id)
+}
+
+func (c *lookupCache) sweep() {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.repeaters {
+		if now.After(entry.expires) {
+			delete(c.repeaters, id)
+		}
+	}
+	for id, entry := range c.users {
+		if now.After(entry.expires) {
+			delete(c.users, id)
+		}
+	}
+	for id, entry := range c.talkgroups {
+		if now.After(entry.expires) {
+			delete(c.talkgroups, id)
+		}
+	}
+}
+
+func (c *lookupCache) listen(ctx context.Context) {
+	pubsub := c.redis.Subscribe(ctx, models.CacheInvalidationChannel)
+	defer func() {
+		err := pubsub.Close()
+		if err != nil {
+			klog.Errorf("Error closing pubsub: %v", err)
+		}
+	}()
+	ticker := time.NewTicker(lookupCacheTTL)
+	defer ticker.Stop()
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.sweep()
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var invalidation models.CacheInvalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &invalidation); err != nil {
+				klog.Errorf("Error unmarshalling cache invalidation: %v", err)
+				continue
+			}
+			c.evict(invalidation.Kind, invalidation.ID)
+			if invalidation.Kind == models.CacheKindRepeater && models.ListeningForCalls(invalidation.ID) {
+				// Egress rewrites are applied by the subscriptions, so changes made through
+				// any instance have to reach the one listening for the repeater
+				if repeater, ok := c.repeater(invalidation.ID); ok {
+					go repeater.ListenForCalls(ctx, c.redis)
+				}
+			}
+		}
+	}
+}
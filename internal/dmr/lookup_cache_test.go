@@ -0,0 +1,116 @@
+package dmr
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func newTestLookupCache(loads *int) *lookupCache {
+	var mu sync.Mutex
+	return &lookupCache{
+		repeaters:  make(map[uint]cachedRepeater),
+		users:      make(map[uint]cachedUser),
+		talkgroups: make(map[uint]cachedTalkgroup),
+		loadRepeater: func(id uint) models.Repeater {
+			mu.Lock()
+			*loads++
+			mu.Unlock()
+			if id == 311860 {
+				return models.Repeater{RadioID: id}
+			}
+			return models.Repeater{}
+		},
+		loadUser: func(id uint) models.User {
+			return models.User{ID: id}
+		},
+		loadTalkgroup: func(id uint) models.Talkgroup {
+			return models.Talkgroup{ID: id}
+		},
+	}
+}
+
+func TestLookupCacheHits(t *testing.T) {
+	loads := 0
+	cache := newTestLookupCache(&loads)
+	for i := 0; i < 100; i++ {
+		if _, ok := cache.repeater(311860); !ok {
+			t.Fatal("Expected repeater 311860 to exist")
+		}
+	}
+	if loads != 1 {
+		t.Errorf("Expected 1 database load, got %d", loads)
+	}
+}
+
+func TestLookupCacheMisses(t *testing.T) {
+	loads := 0
+	cache := newTestLookupCache(&loads)
+	for i := 0; i < 100; i++ {
+		if _, ok := cache.repeater(1); ok {
+			t.Fatal("Expected repeater 1 not to exist")
+		}
+	}
+	if loads != 1 {
+		t.Errorf("Expected unknown repeaters to be cached too, got %d loads", loads)
+	}
+}
+
+func TestLookupCacheEvict(t *testing.T) {
+	loads := 0
+	cache := newTestLookupCache(&loads)
+	cache.repeater(311860)
+	cache.evict(models.CacheKindRepeater, 311860)
+	cache.repeater(311860)
+	if loads != 2 {
+		t.Errorf("Expected eviction to reload the repeater, got %d loads", loads)
+	}
+
+	// Evicting one kind leaves the others alone
+	cache.evict(models.CacheKindUser, 311860)
+	cache.repeater(311860)
+	if loads != 2 {
+		t.Errorf("Expected the repeater to stay cached, got %d loads", loads)
+	}
+}
+
+func TestLookupCacheEvictDuringLoad(t *testing.T) {
+	loads := 0
+	cache := newTestLookupCache(&loads)
+	cache.loadRepeater = func(id uint) models.Repeater {
+		loads++
+		// The repeater changes while it's being loaded
+		if loads == 1 {
+			cache.evict(models.CacheKindRepeater, id)
+		}
+		return models.Repeater{RadioID: id}
+	}
+	cache.repeater(311860)
+	cache.repeater(311860)
+	if loads != 2 {
+		t.Errorf("Expected a load that raced an eviction not to be cached, got %d loads", loads)
+	}
+}
+
+func TestLookupCacheConcurrent(t *testing.T) {
+	loads := 0
+	cache := newTestLookupCache(&loads)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.repeater(311860)
+				cache.user(uint(j))
+				cache.talkgroup(uint(j))
+				if j%10 == 0 {
+					cache.evict(models.CacheKindTalkgroup, uint(i))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	cache.sweep()
+}
@@ -0,0 +1,60 @@
+package dmr
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/USA-RedDragon/DMRHub/internal/userdb"
+	"k8s.io/klog/v2"
+)
+
+// logNetCheckIn records the caller as checked in to the net running on the
+// call's talkgroup, if there is one.
+func (c *CallTracker) logNetCheckIn(ctx context.Context, call *models.Call) {
+	if !call.IsToTalkgroup || !models.ActiveNetExistsForTalkgroup(c.DB, call.DestinationID) {
+		return
+	}
+	net := models.FindActiveNetForTalkgroup(c.DB, call.DestinationID)
+	if net.ID == 0 {
+		return
+	}
+
+	now := time.Now()
+	checkIn := models.FindNetCheckInByUser(c.DB, net.ID, call.UserID)
+	eventType := models.NetEventCheckInUpdate
+	if checkIn.ID == 0 {
+		eventType = models.NetEventCheckIn
+		checkIn = models.NetCheckIn{
+			NetID:      net.ID,
+			UserID:     call.UserID,
+			Callsign:   call.User.Callsign,
+			FirstHeard: now,
+		}
+		dmrUser, err := userdb.GetUser(call.UserID)
+		if err == nil {
+			checkIn.Name = strings.TrimSpace(dmrUser.FName + " " + dmrUser.Surname)
+		}
+	}
+	checkIn.Calls++
+	checkIn.LastHeard = now
+	checkIn.RepeaterID = call.Repeater.RadioID
+	checkIn.RepeaterCallsign = call.Repeater.Callsign
+
+	err := c.DB.Save(&checkIn).Error
+	if err != nil {
+		klog.Errorf("Error saving check-in for %d to net %d: %v", call.UserID, net.ID, err)
+		return
+	}
+	if config.GetConfig().Debug {
+		klog.Infof("Logged check-in from %d to net %d on talkgroup %d", call.UserID, net.ID, net.TalkgroupID)
+	}
+
+	models.PublishNetEvent(ctx, c.Redis, models.NetEvent{
+		Type:    eventType,
+		NetID:   net.ID,
+		CheckIn: &checkIn,
+	})
+}
@@ -26,7 +26,8 @@ func (s *Server) validRepeater(ctx context.Context, repeaterID uint, connection
 	valid := true
 	if !s.Redis.exists(ctx, repeaterID) {
 		klog.Warningf("Repeater %d does not exist", repeaterID)
-		valid = false
+		// The watchdog reports the timeout of a repeater whose state expired, once
+		return false
 	}
 	repeater, err := s.Redis.get(ctx, repeaterID)
 	if err != nil {
@@ -50,30 +51,44 @@ func (s *Server) switchDynamicTalkgroup(ctx context.Context, packet models.Packe
 	// of the current `packet.Slot`) doesn't match the packet's `Dst`
 	// field, then we need to update the database entry to reflect
 	// the new dynamic talkgroup on the appropriate slot.
-	if models.RepeaterIDExists(s.DB, packet.Repeater) {
-		if !models.TalkgroupIDExists(s.DB, packet.Dst) {
+	if repeater, ok := s.cache.repeater(packet.Repeater); ok {
+		talkgroup, ok := s.cache.talkgroup(packet.Dst)
+		if !ok {
 			if config.GetConfig().Debug {
 				klog.Infof("Repeater %d not found in DB", packet.Repeater)
 			}
 			return
 		}
-		repeater := models.FindRepeaterByID(s.DB, packet.Repeater)
-		talkgroup := models.FindTalkgroupByID(s.DB, packet.Dst)
 		if packet.Slot {
 			if repeater.TS2DynamicTalkgroupID == nil || *repeater.TS2DynamicTalkgroupID != packet.Dst {
 				klog.Infof("Dynamically Linking %d timeslot 2 to %d", packet.Repeater, packet.Dst)
+				var oldTGID uint
+				if repeater.TS2DynamicTalkgroupID != nil {
+					oldTGID = *repeater.TS2DynamicTalkgroupID
+				}
 				repeater.TS2DynamicTalkgroup = talkgroup
 				repeater.TS2DynamicTalkgroupID = &packet.Dst
 				go repeater.ListenForCallsOn(ctx, s.Redis.Redis, packet.Dst)
-				s.DB.Save(&repeater)
+				// The cached repeater may be stale, so only the link itself is written
+				s.DB.Model(&repeater).Select("TS2DynamicTalkgroupID").Updates(map[string]interface{}{"TS2DynamicTalkgroupID": packet.Dst})
+				s.cache.invalidateRepeater(ctx, repeater.RadioID)
+				s.publishLinkEvent(ctx, models.RepeaterEventLink, packet.Repeater, packet.Slot, packet.Dst)
+				s.auditDynamicLink(packet.Repeater, packet.Slot, oldTGID, packet.Dst, &packet.Src)
 			}
 		} else {
 			if repeater.TS1DynamicTalkgroupID == nil || *repeater.TS1DynamicTalkgroupID != packet.Dst {
 				klog.Infof("Dynamically Linking %d timeslot 1 to %d", packet.Repeater, packet.Dst)
+				var oldTGID uint
+				if repeater.TS1DynamicTalkgroupID != nil {
+					oldTGID = *repeater.TS1DynamicTalkgroupID
+				}
 				repeater.TS1DynamicTalkgroup = talkgroup
 				repeater.TS1DynamicTalkgroupID = &packet.Dst
 				go repeater.ListenForCallsOn(ctx, s.Redis.Redis, packet.Dst)
-				s.DB.Save(&repeater)
+				s.DB.Model(&repeater).Select("TS1DynamicTalkgroupID").Updates(map[string]interface{}{"TS1DynamicTalkgroupID": packet.Dst})
+				s.cache.invalidateRepeater(ctx, repeater.RadioID)
+				s.publishLinkEvent(ctx, models.RepeaterEventLink, packet.Repeater, packet.Slot, packet.Dst)
+				s.auditDynamicLink(packet.Repeater, packet.Slot, oldTGID, packet.Dst, &packet.Src)
 			}
 		}
 	} else if config.GetConfig().Debug {
@@ -81,6 +96,61 @@ func (s *Server) switchDynamicTalkgroup(ctx context.Context, packet models.Packe
 	}
 }
 
+func (s *Server) publishLinkEvent(ctx context.Context, eventType string, repeaterID uint, slot bool, talkgroupID uint) {
+	models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+		Type:        eventType,
+		RepeaterID:  repeaterID,
+		Slot:        models.SlotNumber(slot),
+		TalkgroupID: talkgroupID,
+	})
+}
+
+func (s *Server) trackCall(ctx context.Context, packet models.Packet) {
+	if !s.CallTracker.IsCallActive(packet) {
+		s.CallTracker.StartCall(ctx, packet)
+	}
+	if s.CallTracker.IsCallActive(packet) {
+		s.CallTracker.ProcessCallPacket(ctx, packet)
+		if packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm {
+			s.CallTracker.EndCall(ctx, packet)
+		}
+	}
+}
+
+// bridgePacket copies a talkgroup packet onto every talkgroup bridged to it.
+// Bridged copies are published straight to the destination talkgroup and never
+// pass through handlePacket again, so bridges only ever go one hop and can't loop.
+func (s *Server) bridgePacket(ctx context.Context, packet models.Packet, remoteAddr *net.UDPAddr) {
+	for _, target := range s.Bridges.Targets(packet.Dst) {
+		bridged := packet
+		bridged.Dst = target
+		bridged.UpdateLC()
+		if !models.ClaimTalkgroupCopy(ctx, s.Redis.Redis, bridged) {
+			if config.GetConfig().Debug {
+				klog.Infof("Not bridging stream %d to busy talkgroup %d", packet.StreamID, target)
+			}
+			continue
+		}
+		if config.GetConfig().Debug {
+			klog.Infof("Bridging stream %d from talkgroup %d to %d", packet.StreamID, packet.Dst, target)
+		}
+
+		var rawPacket models.RawDMRPacket
+		rawPacket.Data = bridged.Encode()
+		rawPacket.RemoteIP = remoteAddr.IP.String()
+		rawPacket.RemotePort = remoteAddr.Port
+		rawPacket.BridgedFrom = packet.Dst
+		packedBytes, err := rawPacket.MarshalMsg(nil)
+		if err != nil {
+			klog.Errorf("Error marshalling raw packet: %v", err)
+			continue
+		}
+		s.Redis.Redis.Publish(ctx, fmt.Sprintf("packets:talkgroup:%d", target), packedBytes)
+
+		go s.trackCall(ctx, bridged)
+	}
+}
+
 func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 	ctx := context.Background()
 	ctx, span := tracer.Start(ctx, "handlePacket")
@@ -105,14 +175,12 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 		}
 		if s.validRepeater(ctx, repeaterID, "YES", *remoteAddr) {
 			s.Redis.ping(ctx, repeaterID)
-			dbRepeater := models.FindRepeaterByID(s.DB, repeaterID)
-			if dbRepeater.RadioID == 0 {
+			if _, ok := s.cache.repeater(repeaterID); !ok {
 				// Repeater not found, drop
 				klog.Warningf("Repeater %d not found in DB", repeaterID)
 				return
 			}
-			dbRepeater.LastPing = time.Now()
-			s.DB.Save(&dbRepeater)
+			s.lastPings.touch(repeaterID)
 
 			typeBytes := data[8:9]
 			// Type can be 0 for a full talk alias, or 1,2,3 for talk alias blocks
@@ -139,11 +207,9 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 		if s.validRepeater(ctx, repeaterID, "YES", *remoteAddr) {
 			s.Redis.ping(ctx, repeaterID)
 
-			var dbRepeater models.Repeater
-			if models.RepeaterIDExists(s.DB, repeaterID) {
-				dbRepeater = models.FindRepeaterByID(s.DB, repeaterID)
-				dbRepeater.LastPing = time.Now()
-				s.DB.Save(&dbRepeater)
+			dbRepeater, ok := s.cache.repeater(repeaterID)
+			if ok {
+				s.lastPings.touch(repeaterID)
 			} else {
 				klog.Warningf("Repeater %d not found in DB", repeaterID)
 				return
@@ -154,6 +220,15 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 				klog.Infof("DMRD packet: %s", packet.String())
 			}
 
+			// Slots are arbitrated in the repeater's own talkgroup and timeslot terms
+			localPacket := packet
+			if dbRepeater.RewriteIngress(&packet) {
+				if config.GetConfig().Debug {
+					klog.Infof("Rewrote talkgroup from repeater %d to %d", repeaterID, packet.Dst)
+				}
+				data = packet.Encode()
+			}
+
 			isVoice := false
 			isData := false
 			switch packet.FrameType {
@@ -190,19 +265,24 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 				return
 			}
 
+			if isVoice {
+				// Local traffic always gets the slot, this just keeps network streams off of it
+				models.ClaimSlot(ctx, s.Redis.Redis, repeaterID, localPacket, true)
+
+				switch s.checkTransmitTimeout(ctx, packet, repeaterID) {
+				case transmitDropped:
+					return
+				case transmitCutOff:
+					// Route a terminator in place of this packet so everyone downstream unkeys
+					packet = transmitTerminator(packet)
+					data = packet.Encode()
+				case transmitAllowed:
+				}
+			}
+
 			// Don't call track unlink
 			if packet.Dst != 4000 && isVoice {
-				go func() {
-					if !s.CallTracker.IsCallActive(packet) {
-						s.CallTracker.StartCall(ctx, packet)
-					}
-					if s.CallTracker.IsCallActive(packet) {
-						s.CallTracker.ProcessCallPacket(ctx, packet)
-						if packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm {
-							s.CallTracker.EndCall(ctx, packet)
-						}
-					}
-				}()
+				go s.trackCall(ctx, packet)
 			}
 
 			if packet.Dst == 9990 && isVoice {
@@ -217,38 +297,11 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 					s.Parrot.StopStream(ctx, packet.StreamID)
 					go func() {
 						packets := s.Parrot.GetStream(ctx, packet.StreamID)
-						time.Sleep(3 * time.Second)
-						started := false
-						// Track the duration of the call to ensure that we send out packets right on the 60ms boundary
-						// This is to ensure that the DMR repeater doesn't drop the packet
-						startedTime := time.Now()
-						for j, pkt := range packets {
+						s.captureAnnouncement(ctx, packet.Src, packets)
+						time.Sleep(models.CurrentAppSettings().ParrotDelayDuration())
+						s.playStream(ctx, packets, func(pkt models.Packet) {
 							s.sendPacket(ctx, repeaterID, pkt)
-
-							go func() {
-								if !started {
-									s.CallTracker.StartCall(ctx, pkt)
-									started = true
-								}
-								s.CallTracker.ProcessCallPacket(ctx, pkt)
-								if j == len(packets)-1 {
-									s.CallTracker.EndCall(ctx, pkt)
-								}
-							}()
-							// Calculate the time since the call started
-							elapsed := time.Since(startedTime)
-							// If elapsed is greater than 60ms, we're behind and need to catch up
-							if elapsed > 60*time.Millisecond {
-								klog.Warningf("Parrot call took too long to send, elapsed: %s", elapsed)
-								// Sleep for 60ms minus the difference between the elapsed time and 60ms
-								time.Sleep(60*time.Millisecond - (elapsed - 60*time.Millisecond))
-							} else {
-								// Now subtract the elapsed time from 60ms to get the true delay
-								delay := 60*time.Millisecond - elapsed
-								time.Sleep(delay)
-							}
-							startedTime = time.Now()
-						}
+						})
 					}()
 				}
 				// Don't route parrot calls
@@ -256,34 +309,22 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 			}
 
 			if packet.Dst == 4000 && isVoice {
-				if packet.Slot {
-					klog.Infof("Unlinking timeslot 2 from %d", packet.Repeater)
-					if dbRepeater.TS2DynamicTalkgroupID != nil {
-						oldTGID := *dbRepeater.TS2DynamicTalkgroupID
-						s.DB.Model(&dbRepeater).Select("TS2DynamicTalkgroupID").Updates(map[string]interface{}{"TS2DynamicTalkgroupID": nil})
-						err := s.DB.Model(&dbRepeater).Association("TS2DynamicTalkgroup").Delete(&dbRepeater.TS2DynamicTalkgroup)
-						if err != nil {
-							klog.Errorf("Error deleting TS2DynamicTalkgroup: %s", err)
-						}
-						dbRepeater.CancelSubscription(oldTGID)
-					}
-				} else {
-					klog.Infof("Unlinking timeslot 1 from %d", packet.Repeater)
-					if dbRepeater.TS1DynamicTalkgroupID != nil {
-						oldTGID := *dbRepeater.TS1DynamicTalkgroupID
-						s.DB.Model(&dbRepeater).Select("TS1DynamicTalkgroupID").Updates(map[string]interface{}{"TS1DynamicTalkgroupID": nil})
-						err := s.DB.Model(&dbRepeater).Association("TS1DynamicTalkgroup").Delete(&dbRepeater.TS1DynamicTalkgroup)
-						if err != nil {
-							klog.Errorf("Error deleting TS1DynamicTalkgroup: %s", err)
-						}
-						dbRepeater.CancelSubscription(oldTGID)
-					}
-				}
-				s.DB.Save(&dbRepeater)
+				klog.Infof("Unlinking timeslot %d from %d", models.SlotNumber(packet.Slot), packet.Repeater)
+				s.unlinkDynamicTalkgroup(ctx, &dbRepeater, packet.Slot, &packet.Src)
 				return
 			}
 
 			if packet.GroupCall && isVoice {
+				// A stream turned away from a busy talkgroup mustn't link the slot to it either
+				if !s.claimTalkgroup(ctx, packet, localPacket, repeaterID) {
+					return
+				}
+
+				// The timeout restarts when a stream keys up and again when it ends
+				isTerminator := packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm
+				if s.transmitStreams.recordActivity(packet.StreamID) || isTerminator {
+					models.TouchDynamicTalkgroup(ctx, s.Redis.Redis, repeaterID, packet.Slot)
+				}
 				go s.switchDynamicTalkgroup(ctx, packet)
 
 				// We can just use redis to publish to "packets:talkgroup:<id>"
@@ -297,6 +338,13 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 					return
 				}
 				s.Redis.Redis.Publish(ctx, fmt.Sprintf("packets:talkgroup:%d", packet.Dst), packedBytes)
+
+				s.bridgePacket(ctx, packet, remoteAddr)
+			} else if !packet.GroupCall && isVoice && models.IsRadioVerificationID(packet.Dst) {
+				// Calls to verification codes prove control of an ID and go nowhere
+				if packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceHead {
+					go s.verifyRadio(ctx, packet)
+				}
 			} else if !packet.GroupCall && isVoice {
 				// packet.Dst is either a repeater or a user
 				// If it's a repeater, we need to send it to the repeater
@@ -321,25 +369,21 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 				} else if packet.Dst < 10000000 {
 					// This is to a user
 					// Search the database for the user
-					if models.UserIDExists(s.DB, packet.Dst) {
-						user := models.FindUserByID(s.DB, packet.Dst)
-						// Query lastheard where UserID == user.ID LIMIT 1
-						var lastCall models.Call
-						s.DB.Where("user_id = ?", user.ID).Order("created_at DESC").First(&lastCall)
-						if s.DB.Error != nil {
-							klog.Errorf("Error querying last call for user %d: %s", user.ID, s.DB.Error)
-						} else {
-							// If the last call exists that that repeater is online
-							if lastCall.ID != 0 && s.Redis.exists(ctx, lastCall.RepeaterID) {
-								// Send the packet to the last user call's repeater
-								s.Redis.Redis.Publish(ctx, fmt.Sprintf("packets:repeater:%d", lastCall.RepeaterID), packedBytes)
-							}
+					if user, ok := s.cache.user(packet.Dst); ok {
+						lastRepeaterID := s.privateCalls.lastRepeater(packet.StreamID, user.ID)
+						if packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm {
+							s.privateCalls.end(packet.StreamID)
+						}
+						// If the user's last call was through a repeater that's online
+						if lastRepeaterID != nil && s.Redis.exists(ctx, *lastRepeaterID) {
+							// Send the packet to the last user call's repeater
+							s.Redis.Redis.Publish(ctx, fmt.Sprintf("packets:repeater:%d", *lastRepeaterID), packedBytes)
 						}
 
 						// For each user repeaters
 						for _, repeater := range user.Repeaters {
 							// If the repeater is online and the last user call was not to this repeater
-							if repeater.RadioID != lastCall.RepeaterID && s.Redis.exists(ctx, repeater.RadioID) {
+							if (lastRepeaterID == nil || repeater.RadioID != *lastRepeaterID) && s.Redis.exists(ctx, repeater.RadioID) {
 								// Send the packet to the repeater
 								s.Redis.Redis.Publish(ctx, fmt.Sprintf("packets:repeater:%d", repeater.RadioID), packedBytes)
 							}
@@ -370,10 +414,8 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 
 		if s.validRepeater(ctx, repeaterID, "YES", *remoteAddr) {
 			s.Redis.ping(ctx, repeaterID)
-			if models.RepeaterIDExists(s.DB, repeaterID) {
-				dbRepeater := models.FindRepeaterByID(s.DB, repeaterID)
-				dbRepeater.LastPing = time.Now()
-				s.DB.Save(&dbRepeater)
+			if _, ok := s.cache.repeater(repeaterID); ok {
+				s.lastPings.touch(repeaterID)
 			} else {
 				return
 			}
@@ -384,7 +426,19 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 			}
 
 			// https://github.com/g4klx/MMDVMHost/blob/master/DMRplus_startup_options.md
-			// Options are not yet supported
+			// Only TIMER= is supported for now
+			if timer, ok := parseOptionsTimer(options); ok {
+				repeater, err := s.Redis.get(ctx, repeaterID)
+				if err != nil {
+					klog.Errorf("Error getting repeater from redis: %v", err)
+					return
+				}
+				repeater.OptionsTimer = &timer
+				s.Redis.store(ctx, repeaterID, repeater)
+				if config.GetConfig().Debug {
+					klog.Infof("Repeater %d set dynamic talkgroup timer to %d minutes", repeaterID, timer)
+				}
+			}
 		}
 	} else if command == dmrconst.CommandRPTL {
 		// RPTL packets are 8 bytes long
@@ -408,6 +462,11 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 			if config.GetConfig().Debug {
 				klog.Infof("Repeater ID %d is not valid, sending NAK", repeaterID)
 			}
+			models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+				Type:       models.RepeaterEventAuthFailed,
+				RepeaterID: repeaterID,
+				Message:    "Repeater is not registered",
+			})
 		} else {
 			repeater := models.FindRepeaterByID(s.DB, repeaterID)
 			bigSalt, err := rand.Int(rand.Reader, big.NewInt(0xFFFFFFFF))
@@ -430,6 +489,11 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 			}
 			s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, saltBytes[:])
 			s.Redis.updateConnection(ctx, repeaterID, "CHALLENGE_SENT")
+			models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+				Type:       models.RepeaterEventLogin,
+				RepeaterID: repeaterID,
+				Connection: "CHALLENGE_SENT",
+			})
 		}
 	} else if command == dmrconst.CommandRPTK {
 		// RPTL packets are 8 bytes long + a 32 byte sha256 hash
@@ -468,6 +532,7 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 			s.Redis.ping(ctx, repeaterID)
 			dbRepeater.LastPing = time.Now()
 			s.DB.Save(&dbRepeater)
+			s.cache.invalidateRepeater(ctx, repeaterID)
 
 			repeater, err := s.Redis.get(ctx, repeaterID)
 			if err != nil {
@@ -487,12 +552,22 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 				klog.Infof("Repeater ID %d authed, sending ACK", repeaterID)
 				s.Redis.updateConnection(ctx, repeaterID, "WAITING_CONFIG")
 				s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, repeaterIDBytes)
+				models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+					Type:       models.RepeaterEventAuthenticated,
+					RepeaterID: repeaterID,
+					Connection: "WAITING_CONFIG",
+				})
 				go func() {
 					time.Sleep(1 * time.Second)
 					s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTSBKN, repeaterIDBytes)
 				}()
 			} else {
 				s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
+				models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+					Type:       models.RepeaterEventAuthFailed,
+					RepeaterID: repeaterID,
+					Message:    "Invalid password",
+				})
 			}
 		} else {
 			s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
@@ -512,6 +587,8 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 			}
 			if !s.Redis.delete(ctx, repeaterID) {
 				klog.Warningf("Repeater ID %d not deleted", repeaterID)
+			} else {
+				s.repeaterOffline(ctx, repeaterID, models.RepeaterConnectionDisconnect, "Repeater disconnected")
 			}
 		} else {
 			// RPTC packets are 302 bytes long
@@ -650,6 +727,12 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 				repeater.Connection = "YES"
 				s.Redis.store(ctx, repeaterID, repeater)
 				klog.Infof("Repeater ID %d (%s) connected\n", repeaterID, repeater.Callsign)
+				models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+					Type:       models.RepeaterEventConfig,
+					RepeaterID: repeaterID,
+					Connection: repeater.Connection,
+					Message:    fmt.Sprintf("%s %s", repeater.Callsign, repeater.SoftwareID),
+				})
 				s.sendCommand(ctx, repeaterID, dmrconst.CommandRPTACK, repeaterIDBytes)
 				dbRepeater := models.FindRepeaterByID(s.DB, repeaterID)
 				dbRepeater.Connected = repeater.Connected
@@ -669,6 +752,8 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 				dbRepeater.SoftwareID = repeater.SoftwareID
 				dbRepeater.PackageID = repeater.PackageID
 				s.DB.Save(&dbRepeater)
+				s.cache.invalidateRepeater(ctx, repeaterID)
+				s.repeaterOnline(ctx, repeaterID)
 			} else {
 				s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
 			}
@@ -685,14 +770,12 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 
 		if s.validRepeater(ctx, repeaterID, "YES", *remoteAddr) {
 			s.Redis.ping(ctx, repeaterID)
-			dbRepeater := models.FindRepeaterByID(s.DB, repeaterID)
-			if dbRepeater.RadioID == 0 {
+			if _, ok := s.cache.repeater(repeaterID); !ok {
 				// No repeater found, drop
 				klog.Warningf("No repeater found for ID %d", repeaterID)
 				return
 			}
-			dbRepeater.LastPing = time.Now()
-			s.DB.Save(&dbRepeater)
+			s.lastPings.touch(repeaterID)
 			repeater, err := s.Redis.get(ctx, repeaterID)
 			if err != nil {
 				klog.Errorf("Error getting repeater from Redis", err)
@@ -700,6 +783,11 @@ func (s *Server) handlePacket(remoteAddr *net.UDPAddr, data []byte) {
 			}
 			repeater.PingsReceived++
 			s.Redis.store(ctx, repeaterID, repeater)
+			models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+				Type:       models.RepeaterEventPing,
+				RepeaterID: repeaterID,
+				Connection: repeater.Connection,
+			})
 			s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTPONG, repeaterIDBytes)
 		} else {
 			s.sendCommand(ctx, repeaterID, dmrconst.CommandMSTNAK, repeaterIDBytes)
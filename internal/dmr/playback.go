@@ -0,0 +1,56 @@
+package dmr
+
+import (
+	"context"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"k8s.io/klog/v2"
+)
+
+// playStream sends a recorded stream out one packet at a time, right on the 60ms
+// boundary a DMR repeater expects, and tracks the stream as a call while it plays
+func (s *Server) playStream(ctx context.Context, packets []models.Packet, send func(models.Packet)) {
+	if len(packets) == 0 {
+		return
+	}
+
+	// Call tracking hits the database, so keep it off the timing loop
+	tracked := make(chan models.Packet, len(packets))
+	defer close(tracked)
+	go func() {
+		started := false
+		var last models.Packet
+		for pkt := range tracked {
+			if !started {
+				s.CallTracker.StartCall(ctx, pkt)
+				started = true
+			}
+			s.CallTracker.ProcessCallPacket(ctx, pkt)
+			last = pkt
+		}
+		s.CallTracker.EndCall(ctx, last)
+	}()
+
+	// Track the duration of the call to ensure that we send out packets right on the 60ms boundary
+	// This is to ensure that the DMR repeater doesn't drop the packet
+	startedTime := time.Now()
+	for _, pkt := range packets {
+		send(pkt)
+		tracked <- pkt
+
+		// Calculate the time since the call started
+		elapsed := time.Since(startedTime)
+		// If elapsed is greater than 60ms, we're behind and need to catch up
+		if elapsed > 60*time.Millisecond {
+			klog.Warningf("Stream %d took too long to send, elapsed: %s", pkt.StreamID, elapsed)
+			// Sleep for 60ms minus the difference between the elapsed time and 60ms
+			time.Sleep(60*time.Millisecond - (elapsed - 60*time.Millisecond))
+		} else {
+			// Now subtract the elapsed time from 60ms to get the true delay
+			delay := 60*time.Millisecond - elapsed
+			time.Sleep(delay)
+		}
+		startedTime = time.Now()
+	}
+}
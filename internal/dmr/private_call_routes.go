@@ -0,0 +1,73 @@
+package dmr
+
+import (
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// privateCallRoute is the repeater a private call's destination user last called from, nil if none
+type privateCallRoute struct {
+	repeaterID *uint
+	expires    time.Time
+}
+
+// privateCallRoutes remembers where each private call to a user is going, so the user's
+// last repeater is looked up once per stream instead of for every frame.
+type privateCallRoutes struct {
+	mu     sync.Mutex
+	routes map[uint]privateCallRoute
+
+	loadLastRepeater func(userID uint) *uint
+}
+
+func newPrivateCallRoutes(db *gorm.DB) *privateCallRoutes {
+	return &privateCallRoutes{
+		routes: make(map[uint]privateCallRoute),
+		loadLastRepeater: func(userID uint) *uint {
+			var lastCall models.Call
+			err := db.Where("user_id = ?", userID).Order("created_at DESC").Limit(1).Find(&lastCall).Error
+			if err != nil {
+				klog.Errorf("Error querying last call for user %d: %s", userID, err)
+				return nil
+			}
+			return lastCall.RepeaterID
+		},
+	}
+}
+
+// lastRepeater returns the repeater the stream's destination user last called from
+func (r *privateCallRoutes) lastRepeater(streamID uint, userID uint) *uint {
+	now := time.Now()
+	r.mu.Lock()
+	route, ok := r.routes[streamID]
+	if ok && now.Before(route.expires) {
+		// Streams are only forgotten once they've gone quiet
+		route.expires = now.Add(timerDelay)
+		r.routes[streamID] = route
+		r.mu.Unlock()
+		return route.repeaterID
+	}
+	r.mu.Unlock()
+
+	route = privateCallRoute{repeaterID: r.loadLastRepeater(userID), expires: now.Add(timerDelay)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, existing := range r.routes {
+		if now.After(existing.expires) {
+			delete(r.routes, id)
+		}
+	}
+	r.routes[streamID] = route
+	return route.repeaterID
+}
+
+// end forgets a stream once its terminator is routed
+func (r *privateCallRoutes) end(streamID uint) {
+	r.mu.Lock()
+	delete(r.routes, streamID)
+	r.mu.Unlock()
+}
@@ -0,0 +1,32 @@
+package dmr
+
+import (
+	"testing"
+)
+
+func TestPrivateCallRoutesLookUpOncePerStream(t *testing.T) {
+	loads := make(map[uint]int)
+	repeaterID := uint(311860)
+	routes := &privateCallRoutes{
+		routes: make(map[uint]privateCallRoute),
+		loadLastRepeater: func(userID uint) *uint {
+			loads[userID]++
+			return &repeaterID
+		},
+	}
+	for i := 0; i < 100; i++ {
+		if got := routes.lastRepeater(42, 3191868); got == nil || *got != repeaterID {
+			t.Fatalf("Expected repeater %d, got %v", repeaterID, got)
+		}
+	}
+	routes.lastRepeater(43, 3191868)
+	if loads[3191868] != 2 {
+		t.Errorf("Expected one lookup per stream, got %d", loads[3191868])
+	}
+
+	routes.end(42)
+	routes.lastRepeater(42, 3191868)
+	if loads[3191868] != 3 {
+		t.Errorf("Expected an ended stream to be looked up again, got %d lookups", loads[3191868])
+	}
+}
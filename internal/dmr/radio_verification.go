@@ -0,0 +1,42 @@
+package dmr
+
+import (
+	"context"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"k8s.io/klog/v2"
+)
+
+// verifyRadio handles a private call to a radio verification code. If the code was handed out
+// to the caller, their account is marked verified and approved, since they've shown they control the ID.
+func (s *Server) verifyRadio(ctx context.Context, packet models.Packet) {
+	if !models.ClaimRadioVerification(ctx, s.Redis.Redis, packet.Dst, packet.Src) {
+		return
+	}
+	before, ok := s.cache.user(packet.Src)
+	if !ok {
+		return
+	}
+	err := models.MarkRadioVerified(s.DB, packet.Src)
+	if err != nil {
+		klog.Errorf("Error marking user %d radio verified: %v", packet.Src, err)
+		return
+	}
+	models.InvalidateUserCache(ctx, s.Redis.Redis, packet.Src)
+	klog.Infof("User %d verified their DMR ID on air through repeater %d", packet.Src, packet.Repeater)
+
+	after := before
+	after.RadioVerified = true
+	after.Approved = true
+	actorID := packet.Src
+	models.RecordAudit(s.DB, models.AuditLog{
+		ActorID:       &actorID,
+		ActorCallsign: before.Callsign,
+		Source:        models.AuditSourceOnAir,
+		Action:        models.AuditUserRadioVerify,
+		TargetType:    models.AuditTargetUser,
+		TargetID:      packet.Src,
+		Before:        models.NewAuditValue(before),
+		After:         models.NewAuditValue(after),
+	})
+}
@@ -0,0 +1,107 @@
+package dmr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/email"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"k8s.io/klog/v2"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// repeaterNotification is what owners are told when their repeater goes offline or starts flapping
+type repeaterNotification struct {
+	Event         string    `json:"event"`
+	RepeaterID    uint      `json:"repeater_id"`
+	Callsign      string    `json:"callsign"`
+	OwnerID       uint      `json:"owner_id"`
+	OwnerCallsign string    `json:"owner_callsign"`
+	Time          time.Time `json:"time"`
+	Message       string    `json:"message"`
+}
+
+// repeaterNotifier sends owner notifications outside of the WebSocket feed
+type repeaterNotifier struct {
+	webhookURL string
+	client     *http.Client
+	// mailer is nil when email isn't configured
+	mailer *email.Mailer
+	// ownerEmail finds the verified email address of a repeater owner, if they have one
+	ownerEmail func(ownerID uint) (string, bool)
+}
+
+func newRepeaterNotifier(webhookURL string, mailer *email.Mailer, ownerEmail func(ownerID uint) (string, bool)) *repeaterNotifier {
+	return &repeaterNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: webhookTimeout},
+		mailer:     mailer,
+		ownerEmail: ownerEmail,
+	}
+}
+
+func (n *repeaterNotifier) notify(ctx context.Context, notification repeaterNotification) {
+	if n.webhookURL != "" {
+		if err := n.sendWebhook(ctx, notification); err != nil {
+			klog.Errorf("Error sending repeater %d %s webhook: %v", notification.RepeaterID, notification.Event, err)
+		}
+	}
+	if n.mailer != nil && notification.OwnerID != 0 {
+		if to, ok := n.ownerEmail(notification.OwnerID); ok {
+			if err := n.mailer.Send(ctx, notification.email(to)); err != nil {
+				klog.Errorf("Error emailing repeater %d %s notification: %v", notification.RepeaterID, notification.Event, err)
+			}
+		}
+	}
+}
+
+func (n repeaterNotification) email(to string) email.Message {
+	what := "went offline"
+	switch n.Event {
+	case models.RepeaterEventTimeout:
+		what = "stopped responding"
+	case models.RepeaterEventFlapping:
+		what = "keeps dropping its connection"
+	}
+	return email.Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("Repeater %s (%d) %s", n.Callsign, n.RepeaterID, what),
+		Body: fmt.Sprintf(`Hi %s,
+
+Your repeater %s (%d) %s at %s.
+
+%s
+`, n.OwnerCallsign, n.Callsign, n.RepeaterID, what, n.Time.UTC().Format(time.RFC1123), n.Message),
+	}
+}
+
+func (n *repeaterNotifier) sendWebhook(ctx context.Context, notification repeaterNotification) error {
+	notificationJSON, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(notificationJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			klog.Errorf("Error closing webhook response body: %v", err)
+		}
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
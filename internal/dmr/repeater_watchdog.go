@@ -0,0 +1,159 @@
+package dmr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"k8s.io/klog/v2"
+)
+
+const repeaterWatchdogInterval = 5 * time.Second
+
+// repeaterWatchdogLock keeps more than one instance from timing out the same repeater
+const repeaterWatchdogLock = "repeater-watchdog:lock"
+
+// repeaterFlappingPrefix marks a repeater that has already been reported as flapping
+const repeaterFlappingPrefix = "repeater-flapping:"
+
+// pingOverdue reports whether a connected repeater has gone too long without pinging
+func pingOverdue(repeater models.Repeater, now time.Time, timeout time.Duration) bool {
+	return repeater.Connection == models.RepeaterConnectionEstablished && now.Sub(repeater.LastPing) > timeout
+}
+
+func (s *Server) checkRepeaterPings(ctx context.Context) {
+	locked, err := s.Redis.Redis.SetNX(ctx, repeaterWatchdogLock, 1, repeaterWatchdogInterval-time.Second).Result()
+	if err != nil {
+		klog.Errorf("Error locking repeater watchdog: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+
+	repeaterIDs, err := models.ListConnectedRepeaterIDs(ctx, s.Redis.Redis)
+	if err != nil {
+		klog.Errorf("Error listing repeaters: %v", err)
+		return
+	}
+	timeout := config.GetConfig().RepeaterPingTimeout
+	now := time.Now()
+	for _, repeaterID := range repeaterIDs {
+		repeater, err := s.Redis.get(ctx, repeaterID)
+		if err != nil || !pingOverdue(repeater, now, timeout) {
+			continue
+		}
+		// Only the instance that removes the repeater reports it, in case it disconnected meanwhile
+		if !s.Redis.delete(ctx, repeaterID) {
+			continue
+		}
+		klog.Warningf("Repeater %d has not pinged since %s, marking offline", repeaterID, repeater.LastPing)
+		s.repeaterOffline(ctx, repeaterID, models.RepeaterConnectionTimeout,
+			fmt.Sprintf("No ping for %s", now.Sub(repeater.LastPing).Truncate(time.Second)))
+	}
+}
+
+// repeaterOnline records a repeater finishing its login and restores its subscriptions everywhere
+func (s *Server) repeaterOnline(ctx context.Context, repeaterID uint) {
+	models.RecordRepeaterConnection(s.DB, repeaterID, models.RepeaterConnectionConnect, models.RepeaterConnectionEstablished)
+	models.PublishRepeaterPresence(ctx, s.Redis.Redis, repeaterID, true)
+}
+
+// repeaterOffline records a repeater whose Redis state is gone, tears down its subscriptions
+// everywhere and lets its owner know, holding back repeat notifications while it flaps
+func (s *Server) repeaterOffline(ctx context.Context, repeaterID uint, event string, message string) {
+	models.PublishRepeaterPresence(ctx, s.Redis.Redis, repeaterID, false)
+	models.RecordRepeaterConnection(s.DB, repeaterID, event, "")
+
+	eventType := models.RepeaterEventDisconnect
+	if event == models.RepeaterConnectionTimeout {
+		eventType = models.RepeaterEventTimeout
+	}
+	models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+		Type:       eventType,
+		RepeaterID: repeaterID,
+		Message:    message,
+	})
+
+	notification := repeaterNotification{
+		Event:      eventType,
+		RepeaterID: repeaterID,
+		Time:       time.Now(),
+		Message:    message,
+	}
+	if repeater, ok := s.cache.repeater(repeaterID); ok {
+		notification.Callsign = repeater.Callsign
+		notification.OwnerID = repeater.OwnerID
+		notification.OwnerCallsign = repeater.Owner.Callsign
+	}
+
+	threshold := config.GetConfig().RepeaterFlapThreshold
+	window := config.GetConfig().RepeaterFlapWindow
+	if threshold > 0 && models.CountRepeaterDrops(s.DB, repeaterID, time.Now().Add(-window)) >= int64(threshold) {
+		first, err := s.Redis.Redis.SetNX(ctx, fmt.Sprintf("%s%d", repeaterFlappingPrefix, repeaterID), 1, window).Result()
+		if err != nil {
+			klog.Errorf("Error marking repeater %d as flapping: %v", repeaterID, err)
+			return
+		}
+		if !first {
+			return
+		}
+		notification.Event = models.RepeaterEventFlapping
+		notification.Message = fmt.Sprintf("Dropped %d or more times in %s", threshold, window)
+		models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+			Type:       models.RepeaterEventFlapping,
+			RepeaterID: repeaterID,
+			Message:    notification.Message,
+		})
+	}
+	go s.notifier.notify(ctx, notification)
+}
+
+func (s *Server) updateRepeaterPresence(presence models.RepeaterPresence) {
+	if !presence.Online {
+		// A bare repeater has no talkgroups to keep, so every subscription goes
+		models.Repeater{RadioID: presence.RepeaterID}.CancelAllSubscriptions()
+		return
+	}
+	repeater := models.FindRepeaterByID(s.DB, presence.RepeaterID)
+	if repeater.RadioID == 0 {
+		return
+	}
+	go repeater.ListenForCalls(context.Background(), s.Redis.Redis)
+}
+
+// listenRepeaterWatchdog times out repeaters that stop pinging and keeps this
+// instance's subscriptions in line with which repeaters are online
+func (s *Server) listenRepeaterWatchdog(ctx context.Context) {
+	pubsub := s.Redis.Redis.Subscribe(ctx, models.RepeaterPresenceChannel)
+	defer func() {
+		err := pubsub.Close()
+		if err != nil {
+			klog.Errorf("Error closing pubsub: %v", err)
+		}
+	}()
+	ticker := time.NewTicker(repeaterWatchdogInterval)
+	defer ticker.Stop()
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkRepeaterPings(ctx)
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var presence models.RepeaterPresence
+			if err := json.Unmarshal([]byte(msg.Payload), &presence); err != nil {
+				klog.Errorf("Error unmarshalling repeater presence: %v", err)
+				continue
+			}
+			s.updateRepeaterPresence(presence)
+		}
+	}
+}
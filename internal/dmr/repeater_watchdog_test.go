@@ -0,0 +1,110 @@
+package dmr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/email"
+	"github.com/USA-RedDragon/DMRHub/internal/email/emailtest"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestPingOverdue(t *testing.T) {
+	now := time.Now()
+	timeout := 30 * time.Second
+	repeater := models.Repeater{Connection: models.RepeaterConnectionEstablished, LastPing: now.Add(-10 * time.Second)}
+	if pingOverdue(repeater, now, timeout) {
+		t.Error("Repeater that pinged recently was marked overdue")
+	}
+	repeater.LastPing = now.Add(-time.Minute)
+	if !pingOverdue(repeater, now, timeout) {
+		t.Error("Repeater that stopped pinging was not marked overdue")
+	}
+	// Repeaters still logging in are left to expire on their own
+	repeater.Connection = "WAITING_CONFIG"
+	if pingOverdue(repeater, now, timeout) {
+		t.Error("Repeater that never finished logging in was marked overdue")
+	}
+}
+
+func TestRepeaterNotifierWebhook(t *testing.T) {
+	received := make(chan repeaterNotification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected %s request with content type %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		var notification repeaterNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Error(err)
+		}
+		received <- notification
+	}))
+	defer server.Close()
+
+	notifier := newRepeaterNotifier(server.URL, nil, nil)
+	notifier.notify(context.Background(), repeaterNotification{
+		Event:      models.RepeaterEventTimeout,
+		RepeaterID: 311860,
+		Callsign:   "N0CALL",
+	})
+	select {
+	case notification := <-received:
+		if notification.Event != models.RepeaterEventTimeout || notification.RepeaterID != 311860 || notification.Callsign != "N0CALL" {
+			t.Errorf("Unexpected notification %+v", notification)
+		}
+	default:
+		t.Fatal("Webhook was not called")
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if err := newRepeaterNotifier(failing.URL, nil, nil).sendWebhook(context.Background(), repeaterNotification{}); err == nil {
+		t.Error("Expected an error from a failing webhook")
+	}
+}
+
+func TestRepeaterNotifierEmail(t *testing.T) {
+	smtp, err := emailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer smtp.Close()
+	mailer := &email.Mailer{Host: smtp.Host, Port: smtp.Port, From: "dmrhub@example.com"}
+	ownerEmail := func(ownerID uint) (string, bool) {
+		return "owner@example.com", ownerID == 3191868
+	}
+	notifier := newRepeaterNotifier("", mailer, ownerEmail)
+
+	notifier.notify(context.Background(), repeaterNotification{
+		Event:         models.RepeaterEventFlapping,
+		RepeaterID:    311860,
+		Callsign:      "N0CALL",
+		OwnerID:       3191868,
+		OwnerCallsign: "N0CALL",
+		Time:          time.Now(),
+		Message:       "Dropped 3 or more times in 15m0s",
+	})
+	msg, ok := smtp.Next(time.Second)
+	if !ok {
+		t.Fatal("Owner was not emailed")
+	}
+	if len(msg.To) != 1 || msg.To[0] != "owner@example.com" {
+		t.Errorf("Unexpected recipients %v", msg.To)
+	}
+	if !strings.Contains(msg.Data, "Subject: Repeater N0CALL (311860) keeps dropping its connection") || !strings.Contains(msg.Data, "Dropped 3 or more times") {
+		t.Errorf("Unexpected email %s", msg.Data)
+	}
+
+	// Owners without a verified address aren't emailed
+	notifier.notify(context.Background(), repeaterNotification{Event: models.RepeaterEventTimeout, RepeaterID: 311860, OwnerID: 1})
+	if _, ok := smtp.Next(100 * time.Millisecond); ok {
+		t.Error("Owner without an email address was emailed")
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/binary"
 	"net"
+	"time"
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/email"
 	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/go-co-op/gocron"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 	"k8s.io/klog/v2"
@@ -23,10 +26,23 @@ type Server struct {
 	DB            *gorm.DB
 	Redis         redisRepeaterStorage
 	CallTracker   *CallTracker
+	Bridges       *BridgeManager
+
+	announcementScheduler *gocron.Scheduler
+	lastPings             *lastPingBatcher
+	cache                 *lookupCache
+	notifier              *repeaterNotifier
+	privateCalls          *privateCallRoutes
+	transmitStreams       *transmitStreams
 }
 
 // MakeServer creates a new DMR server
 func MakeServer(db *gorm.DB, redis *redis.Client) Server {
+	cache := newLookupCache(db, redis)
+	var mailer *email.Mailer
+	if email.Enabled() {
+		mailer = email.Default()
+	}
 	return Server{
 		Buffer: make([]byte, 302),
 		SocketAddress: net.UDPAddr{
@@ -37,7 +53,15 @@ func MakeServer(db *gorm.DB, redis *redis.Client) Server {
 		Parrot:      NewParrot(redis),
 		DB:          db,
 		Redis:       makeRedisRepeaterStorage(redis),
-		CallTracker: NewCallTracker(db, redis),
+		CallTracker: NewCallTracker(db, redis, cache),
+		Bridges:     NewBridgeManager(db, redis),
+
+		announcementScheduler: gocron.NewScheduler(time.UTC),
+		lastPings:             newLastPingBatcher(db),
+		cache:                 cache,
+		notifier:              newRepeaterNotifier(config.GetConfig().RepeaterWebhookURL, mailer, cache.userEmail),
+		privateCalls:          newPrivateCallRoutes(db),
+		transmitStreams:       newTransmitStreams(),
 	}
 }
 
@@ -57,6 +81,7 @@ func (s *Server) Stop(ctx context.Context) {
 		binary.BigEndian.PutUint32(repeaterBinary, uint32(repeater))
 		s.sendCommand(ctx, repeater, dmrconst.CommandMSTCL, repeaterBinary)
 	}
+	s.lastPings.flush()
 	s.Started = false
 }
 
@@ -157,6 +182,14 @@ func (s *Server) Listen(ctx context.Context) {
 	go s.listen(ctx)
 	go s.send(ctx)
 	go s.sendNoAddr(ctx)
+	go s.Bridges.Listen(ctx)
+	go s.listenAnnouncementSchedules(ctx)
+	go s.listenAnnouncementQueue(ctx)
+	go s.listenDynamicTalkgroupTimeouts(ctx)
+	go s.CallTracker.Listen(ctx)
+	go s.lastPings.listen(ctx)
+	go s.cache.listen(ctx)
+	go s.listenRepeaterWatchdog(ctx)
 
 	go func() {
 		for {
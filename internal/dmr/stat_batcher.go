@@ -0,0 +1,140 @@
+package dmr
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// Every DMRD frame marks its repeater as seen, about 17 times a second per stream.
+// The live value is in Redis, so the database copy only needs to be close.
+const lastPingFlushInterval = 10 * time.Second
+
+// callStatsFlushInterval is how often in-progress call stats are written to the database.
+// The calls WebSocket feed is published from memory and doesn't wait on this.
+const callStatsFlushInterval = 5 * time.Second
+
+// lastPingBatcher collects repeater last-seen times and writes only the latest of each per flush
+type lastPingBatcher struct {
+	mu      sync.Mutex
+	pending map[uint]time.Time
+	write   func(repeaterID uint, lastPing time.Time) error
+}
+
+func newLastPingBatcher(db *gorm.DB) *lastPingBatcher {
+	return &lastPingBatcher{
+		pending: make(map[uint]time.Time),
+		write: func(repeaterID uint, lastPing time.Time) error {
+			return db.Model(&models.Repeater{RadioID: repeaterID}).Update("last_ping", lastPing).Error
+		},
+	}
+}
+
+// touch records that a repeater was just heard from
+func (b *lastPingBatcher) touch(repeaterID uint) {
+	b.mu.Lock()
+	b.pending[repeaterID] = time.Now()
+	b.mu.Unlock()
+}
+
+// flush writes out everything touched since the last flush and returns the number of writes
+func (b *lastPingBatcher) flush() int {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[uint]time.Time, len(pending))
+	b.mu.Unlock()
+
+	for repeaterID, lastPing := range pending {
+		if err := b.write(repeaterID, lastPing); err != nil {
+			klog.Errorf("Error saving last ping for repeater %d: %v", repeaterID, err)
+		}
+	}
+	return len(pending)
+}
+
+func (b *lastPingBatcher) listen(ctx context.Context) {
+	ticker := time.NewTicker(lastPingFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.flush()
+			return
+		case <-ticker.C:
+			if written := b.flush(); written > 0 && config.GetConfig().Debug {
+				klog.Infof("Saved last ping for %d repeaters", written)
+			}
+		}
+	}
+}
+
+// callStatsBatcher collects the stats of calls in progress and writes only the latest of each per flush
+type callStatsBatcher struct {
+	mu      sync.Mutex
+	pending map[uint]models.Call
+	// flushing is held for the whole of a flush so forget can wait one out
+	flushing sync.Mutex
+	write    func(call models.Call) error
+}
+
+func newCallStatsBatcher(db *gorm.DB) *callStatsBatcher {
+	return &callStatsBatcher{
+		pending: make(map[uint]models.Call),
+		write: func(call models.Call) error {
+			return db.Model(&models.Call{ID: call.ID}).Updates(map[string]interface{}{
+				"duration":       call.Duration,
+				"total_packets":  call.TotalPackets,
+				"lost_sequences": call.LostSequences,
+				"loss":           call.Loss,
+				"jitter":         call.Jitter,
+				"jitter_p95":     call.JitterP95,
+				"jitter_max":     call.JitterMax,
+				"total_bits":     call.TotalBits,
+				"errored_bits":   call.ErroredBits,
+				"ber":            call.BER,
+				"rssi":           call.RSSI,
+				"rssi_min":       call.RSSIMin,
+			}).Error
+		},
+	}
+}
+
+// record queues a copy of the call's current stats
+func (b *callStatsBatcher) record(call *models.Call) {
+	b.mu.Lock()
+	b.pending[call.ID] = *call
+	b.mu.Unlock()
+}
+
+// forget drops any queued stats for a call that's about to be saved for good,
+// waiting out a flush in progress so it can't land after the final save
+func (b *callStatsBatcher) forget(callID uint) {
+	b.mu.Lock()
+	delete(b.pending, callID)
+	b.mu.Unlock()
+	b.flushing.Lock()
+	defer b.flushing.Unlock()
+}
+
+// flush writes out every call recorded since the last flush and returns the number of writes
+func (b *callStatsBatcher) flush() int {
+	b.flushing.Lock()
+	defer b.flushing.Unlock()
+
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[uint]models.Call, len(pending))
+	b.mu.Unlock()
+
+	for _, call := range pending {
+		if err := b.write(call); err != nil {
+			klog.Errorf("Error saving stats for call %d: %v", call.StreamID, err)
+		}
+	}
+	return len(pending)
+}
@@ -0,0 +1,180 @@
+package dmr
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dbtest"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+// A voice frame every 60ms
+const framesPerSecond = 1000 / 60
+
+func TestLastPingBatcherCoalesces(t *testing.T) {
+	written := make(map[uint]int)
+	batcher := &lastPingBatcher{
+		pending: make(map[uint]time.Time),
+		write: func(repeaterID uint, lastPing time.Time) error {
+			written[repeaterID]++
+			return nil
+		},
+	}
+	for i := 0; i < 100; i++ {
+		batcher.touch(311860)
+		batcher.touch(311861)
+	}
+	if n := batcher.flush(); n != 2 {
+		t.Errorf("Expected 2 writes, got %d", n)
+	}
+	if written[311860] != 1 || written[311861] != 1 {
+		t.Errorf("Expected one write per repeater, got %v", written)
+	}
+	if n := batcher.flush(); n != 0 {
+		t.Errorf("Expected nothing left to flush, got %d", n)
+	}
+}
+
+func TestCallStatsBatcherForget(t *testing.T) {
+	var written []models.Call
+	batcher := &callStatsBatcher{
+		pending: make(map[uint]models.Call),
+		write: func(call models.Call) error {
+			written = append(written, call)
+			return nil
+		},
+	}
+	call := models.Call{ID: 1, TotalPackets: 10}
+	batcher.record(&call)
+	call.TotalPackets = 20
+	batcher.record(&call)
+	batcher.record(&models.Call{ID: 2})
+	batcher.forget(2)
+
+	if n := batcher.flush(); n != 1 {
+		t.Fatalf("Expected 1 write, got %d", n)
+	}
+	if written[0].ID != 1 || written[0].TotalPackets != 20 {
+		t.Errorf("Expected the latest stats for call 1, got %+v", written[0])
+	}
+}
+
+func TestCallStatsBatcherConcurrent(t *testing.T) {
+	var writes int
+	batcher := &callStatsBatcher{
+		pending: make(map[uint]models.Call),
+		write: func(call models.Call) error {
+			writes++
+			return nil
+		},
+	}
+	var wg sync.WaitGroup
+	for id := uint(1); id <= 50; id++ {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			call := models.Call{ID: id}
+			for i := 0; i < 100; i++ {
+				call.TotalPackets++
+				batcher.record(&call)
+				if i%25 == 0 {
+					batcher.flush()
+				}
+			}
+			batcher.forget(id)
+		}(id)
+	}
+	wg.Wait()
+	batcher.flush()
+	if writes == 0 || writes > 50*4 {
+		t.Errorf("Expected at most %d writes, got %d", 50*4, writes)
+	}
+}
+
+// callStatsFrames starts a call on each of the streams and feeds it voice frames through the
+// tracker, flushing the stats batcher as often as it would flush with calls this busy
+func callStatsFrames(tracker *CallTracker, streams uint, frames int) {
+	ctx := context.Background()
+	flushEvery := int(callStatsFlushInterval/time.Second) * framesPerSecond * int(streams)
+	for stream := uint(1); stream <= streams; stream++ {
+		header := voicePacket(stream, dmrconst.FrameDataSync, uint(dmrconst.DTypeVoiceHead))
+		tracker.StartCall(ctx, header)
+		tracker.ProcessCallPacket(ctx, header)
+	}
+	for i := 0; i < frames; i++ {
+		stream := uint(i)%streams + 1
+		seq := uint(i) / uint(streams) % 6
+		frameType := dmrconst.FrameVoice
+		if seq == 0 {
+			frameType = dmrconst.FrameVoiceSync
+		}
+		tracker.ProcessCallPacket(ctx, voicePacket(stream, frameType, seq))
+		if (i+1)%flushEvery == 0 {
+			tracker.stats.flush()
+		}
+	}
+	tracker.stats.flush()
+}
+
+func TestCallStatsWritesPerFrame(t *testing.T) {
+	const streams = 10
+	const seconds = 30
+	tracker, recorder, _ := newTestCallTracker(t)
+	frames := seconds * framesPerSecond * streams
+	callStatsFrames(tracker, streams, frames)
+
+	// Each flush writes each call at most once, however many frames it had
+	flushes := seconds/int(callStatsFlushInterval/time.Second) + 1
+	writes := len(recorder.Matching(`UPDATE "calls"`))
+	if writes == 0 || writes > streams*flushes {
+		t.Errorf("Expected between 1 and %d writes for %d frames, got %d", streams*flushes, frames, writes)
+	}
+}
+
+func TestLastPingWritesPerFrame(t *testing.T) {
+	db, recorder, err := dbtest.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batcher := newLastPingBatcher(db)
+	for i := 0; i < 1000; i++ {
+		batcher.touch(311860 + uint(i%10))
+	}
+	if n := len(recorder.Matching(`UPDATE "repeaters"`)); n != 0 {
+		t.Errorf("Expected frames not to write, got %d writes", n)
+	}
+	batcher.flush()
+	if n := len(recorder.Matching(`UPDATE "repeaters"`, `"last_ping"`)); n != 10 {
+		t.Errorf("Expected one write per repeater, got %d", n)
+	}
+}
+
+func BenchmarkLastPingWrites(b *testing.B) {
+	// Ten streams at once make ten frames every 60ms
+	flushEvery := int(lastPingFlushInterval/time.Second) * framesPerSecond * 10
+	db, recorder, err := dbtest.Open()
+	if err != nil {
+		b.Fatal(err)
+	}
+	batcher := newLastPingBatcher(db)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batcher.touch(311860 + uint(i%10))
+		if (i+1)%flushEvery == 0 {
+			batcher.flush()
+		}
+	}
+	batcher.flush()
+	b.ReportMetric(float64(len(recorder.Matching(`UPDATE "repeaters"`)))/float64(b.N), "writes/frame")
+}
+
+func BenchmarkCallStatsWrites(b *testing.B) {
+	tracker, recorder, _ := newTestCallTracker(b)
+	recorder.Reset()
+	b.ResetTimer()
+	callStatsFrames(tracker, 10, b.N)
+	b.ReportMetric(float64(len(recorder.Matching(`UPDATE "calls"`)))/float64(b.N), "writes/frame")
+}
@@ -0,0 +1,90 @@
+package dmr
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// Give the sender's radio time to drop back to receive before signalling
+const busySignalDelay = 500 * time.Millisecond
+
+func busyHeaderKey(streamID uint) string {
+	return fmt.Sprintf("talkgroup-busy:%d", streamID)
+}
+
+// claimTalkgroup reports whether a group voice packet may be routed to its talkgroup.
+// Streams that lose the talkgroup to another stream are recorded and optionally signalled.
+func (s *Server) claimTalkgroup(ctx context.Context, packet models.Packet, localPacket models.Packet, repeaterID uint) bool {
+	claim := models.ClaimTalkgroup(ctx, s.Redis.Redis, packet)
+	if claim.Granted {
+		return true
+	}
+	if claim.FirstRejection {
+		klog.Infof("Rejected stream %d from %d on talkgroup %d, in use by %d", packet.StreamID, packet.Src, packet.Dst, claim.OwnerSrc)
+		models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+			Type:          models.RepeaterEventRejected,
+			RepeaterID:    repeaterID,
+			Slot:          models.SlotNumber(localPacket.Slot),
+			TalkgroupID:   packet.Dst,
+			SourceID:      packet.Src,
+			DestinationID: packet.Dst,
+			Message:       fmt.Sprintf("Talkgroup in use by %d", claim.OwnerSrc),
+		})
+	}
+	if config.GetConfig().TalkgroupBusySignal {
+		s.signalBusy(ctx, localPacket, repeaterID, claim.OwnerSrc)
+	}
+	return false
+}
+
+// signalBusy answers a rejected stream with a short header and terminator from the
+// station holding the talkgroup, so the sender's radio shows who they were blocked by
+func (s *Server) signalBusy(ctx context.Context, localPacket models.Packet, repeaterID uint, ownerSrc uint) {
+	if localPacket.FrameType != dmrconst.FrameDataSync {
+		return
+	}
+	switch dmrconst.DataType(localPacket.DTypeOrVSeq) {
+	case dmrconst.DTypeVoiceHead:
+		err := s.Redis.Redis.Set(ctx, busyHeaderKey(localPacket.StreamID), localPacket.Encode(), time.Minute).Err()
+		if err != nil {
+			klog.Errorf("Error saving header for busy signal: %v", err)
+		}
+	case dmrconst.DTypeVoiceTerm:
+		packets := []models.Packet{}
+		headerBytes, err := s.Redis.Redis.GetDel(ctx, busyHeaderKey(localPacket.StreamID)).Bytes()
+		if err == nil {
+			packets = append(packets, models.UnpackPacket(headerBytes))
+		} else if !errors.Is(err, redis.Nil) {
+			klog.Errorf("Error getting header for busy signal: %v", err)
+		}
+		packets = append(packets, localPacket)
+
+		streamID, err := rand.Int(rand.Reader, big.NewInt(0xFFFFFFFF))
+		if err != nil {
+			klog.Errorf("Error generating stream ID for busy signal: %v", err)
+			return
+		}
+		go func() {
+			time.Sleep(busySignalDelay)
+			for i, pkt := range packets {
+				pkt.Src = ownerSrc
+				pkt.StreamID = uint(streamID.Uint64())
+				pkt.Seq = uint(i)
+				pkt.Repeater = repeaterID
+				pkt.UpdateLC()
+				s.sendPacket(ctx, repeaterID, pkt)
+				time.Sleep(60 * time.Millisecond)
+			}
+		}()
+	}
+}
@@ -0,0 +1,180 @@
+package dmr
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// A timed out stream is dropped for as long as it keeps sending, plus this long
+const timedOutStreamExpiry = 5 * time.Minute
+
+type transmitVerdict int
+
+const (
+	transmitAllowed transmitVerdict = iota
+	// transmitCutOff is the first packet past the limit, which is replaced by a terminator
+	transmitCutOff
+	transmitDropped
+)
+
+func transmitTimedOutKey(streamID uint) string {
+	return fmt.Sprintf("transmit:timed-out:%d", streamID)
+}
+
+func transmitThrottleKey(src uint) string {
+	return fmt.Sprintf("transmit:throttle:%d", src)
+}
+
+func streamTimedOut(ctx context.Context, redis *redis.Client, streamID uint) bool {
+	return redis.Exists(ctx, transmitTimedOutKey(streamID)).Val() == 1
+}
+
+// transmitStream is what's known about a stream's transmit time. A repeater's streams
+// all arrive at the instance it's connected to, so this is kept in memory.
+type transmitStream struct {
+	start time.Time
+	limit time.Duration
+	// dropped is set once the stream is cut off, or from the start if its source was throttled
+	dropped bool
+	// activityRecorded is set once the stream has restarted its slot's dynamic talkgroup timeout
+	activityRecorded bool
+	lastSeen         time.Time
+}
+
+// transmitStreams holds the transmit state of each stream, resolved on its first packet
+type transmitStreams struct {
+	mu      sync.Mutex
+	streams map[uint]transmitStream
+}
+
+func newTransmitStreams() *transmitStreams {
+	return &transmitStreams{streams: make(map[uint]transmitStream)}
+}
+
+// lookup returns a stream's state, if it has been seen recently
+func (t *transmitStreams) lookup(streamID uint, now time.Time) (transmitStream, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stream, ok := t.streams[streamID]
+	if !ok || now.Sub(stream.lastSeen) > timedOutStreamExpiry {
+		return transmitStream{}, false
+	}
+	stream.lastSeen = now
+	t.streams[streamID] = stream
+	return stream, true
+}
+
+// begin stores a new stream's state, returning the state already stored if another packet got there first
+func (t *transmitStreams) begin(streamID uint, stream transmitStream) transmitStream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if existing, ok := t.streams[streamID]; ok && stream.lastSeen.Sub(existing.lastSeen) <= timedOutStreamExpiry {
+		return existing
+	}
+	for id, existing := range t.streams {
+		if stream.lastSeen.Sub(existing.lastSeen) > timedOutStreamExpiry {
+			delete(t.streams, id)
+		}
+	}
+	t.streams[streamID] = stream
+	return stream
+}
+
+// cutOff drops the rest of a stream, returning false if it was already dropped
+func (t *transmitStreams) cutOff(streamID uint) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stream := t.streams[streamID]
+	if stream.dropped {
+		return false
+	}
+	stream.dropped = true
+	t.streams[streamID] = stream
+	return true
+}
+
+// recordActivity reports whether a stream has yet to restart its slot's dynamic talkgroup timeout
+func (t *transmitStreams) recordActivity(streamID uint) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stream, ok := t.streams[streamID]
+	if !ok || stream.activityRecorded {
+		return !ok
+	}
+	stream.activityRecorded = true
+	t.streams[streamID] = stream
+	return true
+}
+
+// transmitLimit is the talkgroup's own transmit time limit if it has one, otherwise the network's
+func (s *Server) transmitLimit(packet models.Packet) time.Duration {
+	if packet.GroupCall {
+		if talkgroup, ok := s.cache.talkgroup(packet.Dst); ok && talkgroup.TransmitTimeout != nil {
+			return time.Duration(*talkgroup.TransmitTimeout) * time.Second
+		}
+	}
+	return config.GetConfig().TransmitTimeout
+}
+
+// checkTransmitTimeout stops routing streams that run past their transmit time limit,
+// and ignores the offending source ID for a while afterwards. The limit and throttle
+// are looked up on a stream's first packet, later packets are checked in memory.
+func (s *Server) checkTransmitTimeout(ctx context.Context, packet models.Packet, repeaterID uint) transmitVerdict {
+	now := time.Now()
+	stream, ok := s.transmitStreams.lookup(packet.StreamID, now)
+	if !ok {
+		stream = transmitStream{start: now, limit: s.transmitLimit(packet), lastSeen: now}
+		if s.Redis.Redis.Exists(ctx, transmitThrottleKey(packet.Src)).Val() == 1 {
+			if config.GetConfig().Debug {
+				klog.Infof("Dropping stream %d from throttled source %d", packet.StreamID, packet.Src)
+			}
+			stream.dropped = true
+		}
+		stream = s.transmitStreams.begin(packet.StreamID, stream)
+	}
+	if stream.dropped {
+		return transmitDropped
+	}
+	if stream.limit == 0 || now.Sub(stream.start) < stream.limit {
+		return transmitAllowed
+	}
+	if !s.transmitStreams.cutOff(packet.StreamID) {
+		return transmitDropped
+	}
+
+	klog.Infof("Stream %d from %d to %d exceeded the transmit time limit of %v", packet.StreamID, packet.Src, packet.Dst, stream.limit)
+	// The call tracker marks the call as timed out when it ends
+	err := s.Redis.Redis.Set(ctx, transmitTimedOutKey(packet.StreamID), 1, timedOutStreamExpiry).Err()
+	if err != nil {
+		klog.Errorf("Error timing out stream %d: %v", packet.StreamID, err)
+	}
+	if penalty := config.GetConfig().TransmitTimeoutPenalty; penalty > 0 {
+		s.Redis.Redis.Set(ctx, transmitThrottleKey(packet.Src), 1, penalty)
+	}
+	models.PublishRepeaterEvent(ctx, s.Redis.Redis, models.RepeaterEvent{
+		Type:          models.RepeaterEventTXTimeout,
+		RepeaterID:    repeaterID,
+		Slot:          models.SlotNumber(packet.Slot),
+		SourceID:      packet.Src,
+		DestinationID: packet.Dst,
+		Message:       fmt.Sprintf("Transmission exceeded %v", stream.limit),
+	})
+	return transmitCutOff
+}
+
+// transmitTerminator turns a packet into a voice terminator for its stream. Repeaters
+// rebuild the slot type and sync from the DMRD flags, so only the link control needs encoding.
+func transmitTerminator(packet models.Packet) models.Packet {
+	packet.FrameType = dmrconst.FrameDataSync
+	packet.DTypeOrVSeq = uint(dmrconst.DTypeVoiceTerm)
+	packet.UpdateLC()
+	return packet
+}
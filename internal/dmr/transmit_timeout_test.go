@@ -0,0 +1,109 @@
+package dmr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/lc"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/USA-RedDragon/DMRHub/internal/redistest"
+)
+
+func TestTransmitTerminator(t *testing.T) {
+	packet := models.Packet{
+		Signature:   "DMRD",
+		Src:         3191868,
+		Dst:         3100,
+		GroupCall:   true,
+		FrameType:   dmrconst.FrameVoice,
+		DTypeOrVSeq: 3,
+		StreamID:    1234,
+	}
+	term := transmitTerminator(packet)
+	if term.FrameType != dmrconst.FrameDataSync || dmrconst.DataType(term.DTypeOrVSeq) != dmrconst.DTypeVoiceTerm {
+		t.Fatalf("Expected a voice terminator, got frame type %d dtype %d", term.FrameType, term.DTypeOrVSeq)
+	}
+	if term.StreamID != packet.StreamID {
+		t.Errorf("Terminator stream %d does not match %d", term.StreamID, packet.StreamID)
+	}
+	decoded, err := lc.DecodeFullLC(term.DMRData, dmrconst.DTypeVoiceTerm)
+	if err != nil {
+		t.Fatalf("Failed to decode terminator LC: %v", err)
+	}
+	if decoded != lc.New(true, packet.Src, packet.Dst) {
+		t.Errorf("Terminator LC %+v does not match the stream", decoded)
+	}
+}
+
+func newTransmitTimeoutServer(t *testing.T) (*Server, *redistest.Server) {
+	t.Helper()
+	tracker, _, redisServer := newTestCallTracker(t)
+	return &Server{
+		Redis:           makeRedisRepeaterStorage(tracker.Redis),
+		cache:           tracker.cache,
+		transmitStreams: newTransmitStreams(),
+	}, redisServer
+}
+
+func TestCheckTransmitTimeoutOncePerStream(t *testing.T) {
+	ctx := context.Background()
+	s, redisServer := newTransmitTimeoutServer(t)
+	timeout := uint(1)
+	s.cache.loadTalkgroup = func(id uint) models.Talkgroup {
+		return models.Talkgroup{ID: id, TransmitTimeout: &timeout}
+	}
+	packet := voicePacket(1, dmrconst.FrameVoice, 0)
+
+	before := redisServer.Commands("exists")
+	for i := 0; i < 50; i++ {
+		if verdict := s.checkTransmitTimeout(ctx, packet, 311860); verdict != transmitAllowed {
+			t.Fatalf("Frame %d of a stream within its limit got verdict %d", i, verdict)
+		}
+	}
+	if checks := redisServer.Commands("exists") - before; checks != 1 {
+		t.Errorf("Expected the throttle to be checked once per stream, got %d checks", checks)
+	}
+
+	// Move the stream's start back past its limit
+	stream := s.transmitStreams.streams[packet.StreamID]
+	stream.start = stream.start.Add(-2 * time.Second)
+	s.transmitStreams.streams[packet.StreamID] = stream
+	if verdict := s.checkTransmitTimeout(ctx, packet, 311860); verdict != transmitCutOff {
+		t.Fatalf("Expected the first frame past the limit to be cut off, got verdict %d", verdict)
+	}
+	if verdict := s.checkTransmitTimeout(ctx, packet, 311860); verdict != transmitDropped {
+		t.Errorf("Expected the rest of a timed out stream to be dropped, got verdict %d", verdict)
+	}
+	if !streamTimedOut(ctx, s.Redis.Redis, packet.StreamID) {
+		t.Error("Expected the timed out stream to be recorded for the call tracker")
+	}
+	if redisServer.Published(models.RepeaterEventsChannel(311860)) != 1 {
+		t.Errorf("Expected one timeout event, got %d", redisServer.Published(models.RepeaterEventsChannel(311860)))
+	}
+}
+
+func TestCheckTransmitTimeoutThrottledSource(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTransmitTimeoutServer(t)
+	s.Redis.Redis.Set(ctx, transmitThrottleKey(3191868), 1, time.Minute)
+
+	packet := voicePacket(1, dmrconst.FrameVoice, 0)
+	for i := 0; i < 3; i++ {
+		if verdict := s.checkTransmitTimeout(ctx, packet, 311860); verdict != transmitDropped {
+			t.Fatalf("Expected a stream from a throttled source to be dropped, got verdict %d", verdict)
+		}
+	}
+}
+
+func TestRecordActivityOncePerStream(t *testing.T) {
+	streams := newTransmitStreams()
+	streams.begin(1, transmitStream{start: time.Now(), lastSeen: time.Now()})
+	if !streams.recordActivity(1) {
+		t.Fatal("Expected a new stream to record activity")
+	}
+	if streams.recordActivity(1) {
+		t.Error("Expected a stream to record activity only once")
+	}
+}
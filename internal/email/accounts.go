@@ -0,0 +1,35 @@
+package email
+
+import (
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"gorm.io/gorm"
+)
+
+// SendVerification emails the user a link to prove they own their email address
+func SendVerification(db *gorm.DB, user models.User) error {
+	if !Enabled() || user.Email == "" {
+		return nil
+	}
+	token, err := models.CreateEmailToken(db, user.ID, models.EmailTokenVerify, user.Email, models.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	Send(VerifyEmail(user.Email, user.Callsign, token, models.EmailVerificationTTL))
+	return nil
+}
+
+// NotifyPendingApproval lets the admins know a user is waiting for approval
+func NotifyPendingApproval(db *gorm.DB, user models.User) {
+	if !Enabled() {
+		return
+	}
+	Send(PendingApproval(models.FindAdminEmails(db), user.Callsign, user.ID))
+}
+
+// NotifyUser sends a message to the user if they have a verified email address
+func NotifyUser(user models.User, msg func(to string, callsign string) Message) {
+	if !user.EmailVerified || user.Email == "" {
+		return
+	}
+	Send(msg(user.Email, user.Callsign))
+}
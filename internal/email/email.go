@@ -0,0 +1,154 @@
+// Package email sends the notification emails of the server over SMTP
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"k8s.io/klog/v2"
+)
+
+const sendTimeout = 30 * time.Second
+
+var ErrNotConfigured = errors.New("email is not configured")
+
+// Message is a plain text email
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages through an SMTP server
+type Mailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// ImplicitTLS connects over TLS from the start, as on port 465, rather than upgrading with STARTTLS
+	ImplicitTLS bool
+}
+
+// Enabled reports whether the server is configured to send email
+func Enabled() bool {
+	return config.GetConfig().SMTPHost != ""
+}
+
+// Default is the mailer from the server's configuration
+func Default() *Mailer {
+	cfg := config.GetConfig()
+	return &Mailer{
+		Host:        cfg.SMTPHost,
+		Port:        cfg.SMTPPort,
+		Username:    cfg.SMTPUsername,
+		Password:    cfg.SMTPPassword,
+		From:        cfg.SMTPFrom,
+		ImplicitTLS: cfg.SMTPImplicitTLS,
+	}
+}
+
+// Send sends the message with the configured mailer in the background, logging any failure.
+// Nothing is sent when email isn't configured or the message has no recipients.
+func Send(msg Message) {
+	if !Enabled() || len(msg.To) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := Default().Send(ctx, msg); err != nil {
+			klog.Errorf("Error sending email %q: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// Send delivers the message, waiting for the SMTP server to accept it
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	if m.Host == "" {
+		return ErrNotConfigured
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if m.ImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.Host, MinVersion: tls.VersionTLS12}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !m.ImplicitTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: m.Host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.format(msg, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *Mailer) format(msg Message, now time.Time) []byte {
+	var buf bytes.Buffer
+	domain := m.From[strings.LastIndex(m.From, "@")+1:]
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	// SMTP needs CRLF line endings, and a line starting with a dot is escaped by the DATA writer
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,60 @@
+package email_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/email"
+	"github.com/USA-RedDragon/DMRHub/internal/email/emailtest"
+)
+
+func TestMailerSend(t *testing.T) {
+	smtp, err := emailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer smtp.Close()
+
+	mailer := &email.Mailer{Host: smtp.Host, Port: smtp.Port, From: "dmrhub@example.com"}
+	err = mailer.Send(context.Background(), email.Message{
+		To:      []string{"n0call@example.com", "admin@example.com"},
+		Subject: "Test",
+		Body:    "Line one\n.Line two starts with a dot\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := smtp.Next(time.Second)
+	if !ok {
+		t.Fatal("Message was not delivered")
+	}
+	if msg.From != "dmrhub@example.com" || len(msg.To) != 2 || msg.To[1] != "admin@example.com" {
+		t.Errorf("Unexpected envelope %s -> %v", msg.From, msg.To)
+	}
+	for _, header := range []string{"From: dmrhub@example.com", "To: n0call@example.com, admin@example.com", "Subject: Test", "Message-ID: <"} {
+		if !strings.Contains(msg.Data, header) {
+			t.Errorf("Missing %q in %s", header, msg.Data)
+		}
+	}
+	if !strings.Contains(msg.Data, "Line one\n.Line two starts with a dot\n") {
+		t.Errorf("Body was mangled: %q", msg.Data)
+	}
+}
+
+func TestMailerNotConfigured(t *testing.T) {
+	if err := (&email.Mailer{}).Send(context.Background(), email.Message{}); err != email.ErrNotConfigured {
+		t.Errorf("Expected ErrNotConfigured, got %v", err)
+	}
+}
+
+func TestPasswordResetMessage(t *testing.T) {
+	msg := email.PasswordReset("n0call@example.com", "N0CALL", "abc123", time.Hour)
+	if len(msg.To) != 1 || msg.To[0] != "n0call@example.com" {
+		t.Errorf("Unexpected recipients %v", msg.To)
+	}
+	if !strings.Contains(msg.Body, "/reset-password?token=abc123") || !strings.Contains(msg.Body, "1h0m0s") {
+		t.Errorf("Unexpected body %s", msg.Body)
+	}
+}
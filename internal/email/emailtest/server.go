@@ -0,0 +1,147 @@
+// Package emailtest provides a local SMTP server that keeps the messages it's sent, for tests
+package emailtest
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is an email the server accepted
+type Message struct {
+	From string
+	To   []string
+	Data string
+}
+
+// Server is a minimal SMTP server on localhost. It accepts any sender, recipient and
+// credentials, and neither offers TLS nor relays anything.
+type Server struct {
+	Host string
+	Port int
+
+	listener net.Listener
+	received chan Message
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a random local port
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{
+		Host:     addr.IP.String(),
+		Port:     addr.Port,
+		listener: listener,
+		received: make(chan Message, 100),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server and waits for open connections to finish
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+// Next waits for the next message the server accepts
+func (s *Server) Next(timeout time.Duration) (Message, bool) {
+	select {
+	case msg := <-s.received:
+		return msg, true
+	case <-time.After(timeout):
+		return Message{}, false
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetDeadline(time.Now().Add(time.Minute))
+	text := textproto.NewConn(conn)
+	reply := func(code int, msg string) bool {
+		return text.PrintfLine("%d %s", code, msg) == nil
+	}
+	if !reply(220, "localhost emailtest") {
+		return
+	}
+	var msg Message
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(strings.TrimPrefix(line, line[:len(verb)]))
+		switch verb {
+		case "EHLO":
+			if text.PrintfLine("250-localhost") != nil || !reply(250, "AUTH PLAIN") {
+				return
+			}
+		case "HELO", "NOOP":
+			reply(250, "OK")
+		case "AUTH":
+			reply(235, "Authenticated")
+		case "RSET":
+			msg = Message{}
+			reply(250, "OK")
+		case "MAIL":
+			msg = Message{From: address(arg)}
+			reply(250, "OK")
+		case "RCPT":
+			msg.To = append(msg.To, address(arg))
+			reply(250, "OK")
+		case "DATA":
+			if !reply(354, "Go ahead") {
+				return
+			}
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.received <- msg
+			msg = Message{}
+			reply(250, "Queued")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Not implemented")
+		}
+	}
+}
+
+// address pulls the address out of "FROM:<a@b>" or "TO:<a@b>"
+func address(arg string) string {
+	start := strings.Index(arg, "<")
+	end := strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
@@ -0,0 +1,92 @@
+package email
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+// Link is an absolute link to a path on this server, with the given query parameters
+func Link(path string, query url.Values) string {
+	link := config.GetConfig().PublicURL + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+// network is the name emails call the network by
+func network() string {
+	return models.CurrentAppSettings().Network()
+}
+
+func PasswordReset(to string, callsign string, token string, ttl time.Duration) Message {
+	return Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("Reset your %s password", network()),
+		Body: fmt.Sprintf(`Hi %s,
+
+Someone asked to reset the password of your %s account. If it was you, set a new password here:
+
+%s
+
+The link works once and expires in %s. If you didn't ask for this, you can ignore this email and your password stays the same.
+`, callsign, network(), Link("/reset-password", url.Values{"token": {token}}), ttl),
+	}
+}
+
+func VerifyEmail(to string, callsign string, token string, ttl time.Duration) Message {
+	return Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("Verify your %s email address", network()),
+		Body: fmt.Sprintf(`Hi %s,
+
+Please confirm this is your email address for %s:
+
+%s
+
+The link expires in %s.
+`, callsign, network(), Link("/api/v1/auth/verify-email", url.Values{"token": {token}}), ttl),
+	}
+}
+
+func PendingApproval(to []string, callsign string, userID uint) Message {
+	return Message{
+		To:      to,
+		Subject: fmt.Sprintf("%s is waiting for approval on %s", callsign, network()),
+		Body: fmt.Sprintf(`%s (DMR ID %d) registered on %s and is waiting for an admin to approve them.
+
+Review pending users here:
+
+%s
+`, callsign, userID, network(), Link("/admin/users/approval", nil)),
+	}
+}
+
+func Approved(to string, callsign string) Message {
+	return Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("Your %s account was approved", network()),
+		Body: fmt.Sprintf(`Hi %s,
+
+Your %s account was approved, you can now log in:
+
+%s
+`, callsign, network(), Link("/login", nil)),
+	}
+}
+
+func Suspended(to string, callsign string) Message {
+	return Message{
+		To:      []string{to},
+		Subject: fmt.Sprintf("Your %s account was suspended", network()),
+		Body: fmt.Sprintf(`Hi %s,
+
+Your %s account was suspended by an admin, so you can't log in until it is unsuspended.
+Please contact the network admins if you think this is a mistake.
+`, callsign, network()),
+	}
+}
@@ -0,0 +1,21 @@
+package apimodels
+
+type AnnouncementPost struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type AnnouncementTarget struct {
+	TargetType string `json:"target_type" binding:"required"`
+	TargetID   uint   `json:"target_id" binding:"required"`
+	// Slot is the timeslot to play on when targeting a repeater, 1 or 2
+	Slot uint `json:"slot"`
+	// SourceID is the DMR ID the announcement is sent from, defaulting to the announcement's owner
+	SourceID uint `json:"source_id"`
+}
+
+type AnnouncementSchedulePost struct {
+	AnnouncementTarget
+	Cron    string `json:"cron" binding:"required"`
+	Enabled *bool  `json:"enabled"`
+}
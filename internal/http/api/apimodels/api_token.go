@@ -0,0 +1,9 @@
+package apimodels
+
+import "time"
+
+type APITokenPost struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
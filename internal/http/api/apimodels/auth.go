@@ -5,3 +5,16 @@ type AuthLogin struct {
 	Callsign string `json:"callsign"`
 	Password string `json:"password" binding:"required"`
 }
+
+type TOTPCode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type PasswordReset struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,23 @@
+package apimodels
+
+import "time"
+
+type BridgePost struct {
+	Name                   string     `json:"name"`
+	SourceTalkgroupID      uint       `json:"source_talkgroup_id" binding:"required"`
+	DestinationTalkgroupID uint       `json:"destination_talkgroup_id" binding:"required"`
+	Bidirectional          bool       `json:"bidirectional"`
+	Enabled                *bool      `json:"enabled"`
+	StartsAt               *time.Time `json:"starts_at"`
+	EndsAt                 *time.Time `json:"ends_at"`
+}
+
+type BridgePatch struct {
+	Name          *string    `json:"name"`
+	Bidirectional *bool      `json:"bidirectional"`
+	Enabled       *bool      `json:"enabled"`
+	StartsAt      *time.Time `json:"starts_at"`
+	EndsAt        *time.Time `json:"ends_at"`
+	// ClearWindow removes any start and end time from the bridge
+	ClearWindow bool `json:"clear_window"`
+}
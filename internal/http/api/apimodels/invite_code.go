@@ -0,0 +1,10 @@
+package apimodels
+
+import "time"
+
+type InviteCodePost struct {
+	Note string `json:"note"`
+	// MaxUses defaults to a single use, 0 allows any number of registrations
+	MaxUses   *uint      `json:"max_uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
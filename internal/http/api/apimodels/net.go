@@ -0,0 +1,9 @@
+package apimodels
+
+type NetStart struct {
+	Description string `json:"description"`
+}
+
+type NetCheckInPatch struct {
+	Notes string `json:"notes"`
+}
@@ -12,3 +12,17 @@ type RepeaterTalkgroupsPost struct {
 	TS1DynamicTalkgroup models.Talkgroup   `json:"ts1_dynamic_talkgroup"`
 	TS2DynamicTalkgroup models.Talkgroup   `json:"ts2_dynamic_talkgroup"`
 }
+
+type RepeaterRewritePost struct {
+	NetworkTalkgroupID uint `json:"network_talkgroup_id" binding:"required"`
+	LocalTalkgroupID   uint `json:"local_talkgroup_id" binding:"required"`
+	// Slot is the local timeslot, 1 or 2
+	Slot uint `json:"slot" binding:"required"`
+}
+
+type RepeaterPatch struct {
+	// DynamicTalkgroupTimeout is in minutes, 0 to never unlink
+	DynamicTalkgroupTimeout *uint `json:"dynamic_talkgroup_timeout"`
+	// ClearDynamicTalkgroupTimeout goes back to the network default
+	ClearDynamicTalkgroupTimeout bool `json:"clear_dynamic_talkgroup_timeout"`
+}
@@ -0,0 +1,17 @@
+package apimodels
+
+type RolePost struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RolePatch struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UserRoles struct {
+	RoleIDs []uint `json:"role_ids"`
+}
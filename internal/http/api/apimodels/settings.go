@@ -0,0 +1,17 @@
+package apimodels
+
+type SettingsPatch struct {
+	RequireAdminTwoFactor *bool   `json:"require_admin_two_factor"`
+	RegistrationMode      *string `json:"registration_mode"`
+	NetworkName           *string `json:"network_name"`
+	// ParrotDelay is in seconds
+	ParrotDelay *uint `json:"parrot_delay"`
+	// ClearParrotDelay goes back to the default parrot delay
+	ClearParrotDelay bool `json:"clear_parrot_delay"`
+	// DynamicTalkgroupTimeout is in minutes, zero to never unlink
+	DynamicTalkgroupTimeout *uint `json:"dynamic_talkgroup_timeout"`
+	// ClearDynamicTalkgroupTimeout goes back to the DYNAMIC_TALKGROUP_TIMEOUT environment variable
+	ClearDynamicTalkgroupTimeout bool    `json:"clear_dynamic_talkgroup_timeout"`
+	LastheardVisibility          *string `json:"lastheard_visibility"`
+	MaintenanceMessage           *string `json:"maintenance_message"`
+}
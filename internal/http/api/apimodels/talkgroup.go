@@ -9,6 +9,10 @@ type TalkgroupPost struct {
 type TalkgroupPatch struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// TransmitTimeout is in seconds, 0 for no limit
+	TransmitTimeout *uint `json:"transmit_timeout"`
+	// ClearTransmitTimeout goes back to the network's transmit time limit
+	ClearTransmitTimeout bool `json:"clear_transmit_timeout"`
 }
 
 type TalkgroupAdminAction struct {
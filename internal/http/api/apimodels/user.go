@@ -1,12 +1,19 @@
 package apimodels
 
-import "regexp"
+import (
+	"net/mail"
+	"regexp"
+)
 
 type UserRegistration struct {
 	DMRId    uint   `json:"id" binding:"required"`
 	Callsign string `json:"callsign" binding:"required"`
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// Email is required when the server sends email
+	Email string `json:"email"`
+	// InviteCode is required when registration is invite only
+	InviteCode string `json:"invite_code"`
 }
 
 var isValidUsernameCharset = regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`).MatchString
@@ -28,4 +35,11 @@ type UserPatch struct {
 	Callsign string `json:"callsign"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+// IsValidEmail checks an email address is a single bare address
+func IsValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
 }
@@ -0,0 +1,28 @@
+package audit
+
+import (
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Record adds an entry to the audit log for a change made through the API by the logged in user.
+// before and after are snapshots of the target, either may be nil.
+func Record(c *gin.Context, action string, targetType string, targetID uint, before interface{}, after interface{}) {
+	db := c.MustGet("DB").(*gorm.DB)
+	entry := models.AuditLog{
+		Source:     models.AuditSourceAPI,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     models.NewAuditValue(before),
+		After:      models.NewAuditValue(after),
+		IP:         c.ClientIP(),
+	}
+	if userID, ok := sessions.Default(c).Get("user_id").(uint); ok {
+		entry.ActorID = &userID
+		entry.ActorCallsign = models.FindUserByID(db, userID).Callsign
+	}
+	models.RecordAudit(db, entry)
+}
@@ -0,0 +1,335 @@
+package announcements
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-co-op/gocron"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// Roughly 10 minutes of audio
+const maxAnnouncementFrames = 10000
+
+// How long a user has to key up parrot after arming a recording
+const recordTimeout = 5 * time.Minute
+
+func GETAnnouncements(c *gin.Context) {
+	db := c.MustGet("PaginatedDB").(*gorm.DB)
+	cDb := c.MustGet("DB").(*gorm.DB)
+	announcements := models.ListAnnouncements(db)
+	total := models.CountAnnouncements(cDb)
+	c.JSON(http.StatusOK, gin.H{"total": total, "announcements": announcements})
+}
+
+func GETAnnouncement(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	announcement, ok := findAnnouncement(c, db)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, announcement)
+}
+
+func POSTAnnouncement(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	session := sessions.Default(c)
+	userID := session.Get("user_id")
+	if userID == nil {
+		klog.Error("userID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	var json apimodels.AnnouncementPost
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTAnnouncement: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	json.Name = strings.TrimSpace(json.Name)
+	if len(json.Name) == 0 || len(json.Name) > 40 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 40 characters"})
+		return
+	}
+	if len(json.Description) > 240 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Description must be less than 240 characters"})
+		return
+	}
+
+	announcement := models.Announcement{
+		Name:        json.Name,
+		Description: json.Description,
+		OwnerID:     userID.(uint),
+	}
+	err = db.Create(&announcement).Error
+	if err != nil {
+		klog.Errorf("POSTAnnouncement: Error creating announcement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating announcement"})
+		return
+	}
+	audit.Record(c, models.AuditAnnouncementCreate, models.AuditTargetAnnouncement, announcement.ID, nil, announcement)
+	c.JSON(http.StatusOK, models.FindAnnouncementByID(db, announcement.ID))
+}
+
+func DELETEAnnouncement(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	announcement, ok := findAnnouncement(c, db)
+	if !ok {
+		return
+	}
+	models.DeleteAnnouncement(db, announcement.ID)
+	models.PublishAnnouncementsReload(c.Request.Context(), redis)
+	audit.Record(c, models.AuditAnnouncementDelete, models.AuditTargetAnnouncement, announcement.ID, announcement, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Announcement deleted"})
+}
+
+// PUTAnnouncementAudio imports a recording in the stored frame format
+func PUTAnnouncementAudio(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	announcement, ok := findAnnouncement(c, db)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxAnnouncementFrames*models.AnnouncementFrameSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read recording"})
+		return
+	}
+	if len(data) == 0 || len(data)%models.AnnouncementFrameSize != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Recording must be a sequence of %d byte frames", models.AnnouncementFrameSize)})
+		return
+	}
+	if len(data) > maxAnnouncementFrames*models.AnnouncementFrameSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Recording is too long"})
+		return
+	}
+	frames := models.DecodeAnnouncementFrames(data)
+	for _, frame := range frames {
+		if frame.FrameType != dmrconst.FrameVoice && frame.FrameType != dmrconst.FrameVoiceSync && frame.FrameType != dmrconst.FrameDataSync {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Recording contains an invalid frame"})
+			return
+		}
+	}
+
+	before := gin.H{"frame_count": announcement.FrameCount}
+	announcement.Frames = data
+	announcement.FrameCount = uint(len(frames))
+	err = db.Save(&announcement).Error
+	if err != nil {
+		klog.Errorf("PUTAnnouncementAudio: Error saving announcement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving recording"})
+		return
+	}
+	audit.Record(c, models.AuditAnnouncementAudio, models.AuditTargetAnnouncement, announcement.ID, before, gin.H{"frame_count": announcement.FrameCount})
+	c.JSON(http.StatusOK, gin.H{"message": "Recording imported", "frame_count": announcement.FrameCount})
+}
+
+// GETAnnouncementAudio exports the recording in the stored frame format
+func GETAnnouncementAudio(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	announcement, ok := findAnnouncement(c, db)
+	if !ok {
+		return
+	}
+	if len(announcement.Frames) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Announcement has no recording"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=announcement-%d.ambe", announcement.ID))
+	c.Data(http.StatusOK, "application/octet-stream", announcement.Frames)
+}
+
+// POSTAnnouncementRecord records the user's next parrot call into the announcement
+func POSTAnnouncementRecord(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	session := sessions.Default(c)
+	userID := session.Get("user_id")
+	if userID == nil {
+		klog.Error("userID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	announcement, ok := findAnnouncement(c, db)
+	if !ok {
+		return
+	}
+
+	err := redis.Set(c.Request.Context(), models.AnnouncementRecordKey(userID.(uint)), announcement.ID, recordTimeout).Err()
+	if err != nil {
+		klog.Errorf("POSTAnnouncementRecord: Error arming recording: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting recording"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Key up Parrot (9990) within %d minutes to record the announcement", int(recordTimeout.Minutes()))})
+}
+
+func POSTAnnouncementPlay(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	announcement, ok := findAnnouncement(c, db)
+	if !ok {
+		return
+	}
+	if announcement.FrameCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Announcement has no recording"})
+		return
+	}
+
+	var json apimodels.AnnouncementTarget
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTAnnouncementPlay: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	if errMsg := validateTarget(db, json); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	err = models.QueueAnnouncement(c.Request.Context(), redis, models.AnnouncementPlayback{
+		AnnouncementID: announcement.ID,
+		TargetType:     json.TargetType,
+		TargetID:       json.TargetID,
+		TimeSlot:       json.Slot == 2,
+		SourceID:       json.SourceID,
+	})
+	if err != nil {
+		klog.Errorf("POSTAnnouncementPlay: Error queueing announcement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error queueing announcement"})
+		return
+	}
+	audit.Record(c, models.AuditAnnouncementPlay, models.AuditTargetAnnouncement, announcement.ID, nil, json)
+	c.JSON(http.StatusOK, gin.H{"message": "Announcement queued"})
+}
+
+func POSTAnnouncementSchedule(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	announcement, ok := findAnnouncement(c, db)
+	if !ok {
+		return
+	}
+
+	var json apimodels.AnnouncementSchedulePost
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTAnnouncementSchedule: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	if errMsg := validateTarget(db, json.AnnouncementTarget); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	// Let the scheduler parse the expression so we accept exactly what it will run
+	_, err = gocron.NewScheduler(time.UTC).Cron(json.Cron).Do(func() {})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cron expression"})
+		return
+	}
+
+	schedule := models.AnnouncementSchedule{
+		AnnouncementID: announcement.ID,
+		Cron:           json.Cron,
+		TargetType:     json.TargetType,
+		TargetID:       json.TargetID,
+		TimeSlot:       json.Slot == 2,
+		SourceID:       json.SourceID,
+		Enabled:        true,
+	}
+	if json.Enabled != nil {
+		schedule.Enabled = *json.Enabled
+	}
+	err = db.Create(&schedule).Error
+	if err != nil {
+		klog.Errorf("POSTAnnouncementSchedule: Error creating schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating schedule"})
+		return
+	}
+	models.PublishAnnouncementsReload(c.Request.Context(), redis)
+	audit.Record(c, models.AuditScheduleCreate, models.AuditTargetSchedule, schedule.ID, nil, schedule)
+	c.JSON(http.StatusOK, schedule)
+}
+
+func DELETEAnnouncementSchedule(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	announcement, ok := findAnnouncement(c, db)
+	if !ok {
+		return
+	}
+	scheduleID, err := strconv.ParseUint(c.Param("schedule"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return
+	}
+	schedule := models.FindAnnouncementSchedule(db, announcement.ID, uint(scheduleID))
+	if schedule.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Schedule does not exist"})
+		return
+	}
+	err = db.Delete(&schedule).Error
+	if err != nil {
+		klog.Errorf("DELETEAnnouncementSchedule: Error deleting schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting schedule"})
+		return
+	}
+	models.PublishAnnouncementsReload(c.Request.Context(), redis)
+	audit.Record(c, models.AuditScheduleDelete, models.AuditTargetSchedule, schedule.ID, schedule, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
+}
+
+func findAnnouncement(c *gin.Context, db *gorm.DB) (models.Announcement, bool) {
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid announcement ID"})
+		return models.Announcement{}, false
+	}
+	announcement := models.FindAnnouncementByID(db, uint(idUint64))
+	if announcement.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Announcement does not exist"})
+		return models.Announcement{}, false
+	}
+	return announcement, true
+}
+
+// validateTarget returns an error message if the playback target is invalid
+func validateTarget(db *gorm.DB, target apimodels.AnnouncementTarget) string {
+	switch target.TargetType {
+	case models.AnnouncementTargetTalkgroup:
+		if !models.TalkgroupIDExists(db, target.TargetID) {
+			return "Talkgroup does not exist"
+		}
+	case models.AnnouncementTargetRepeater:
+		if !models.RepeaterIDExists(db, target.TargetID) {
+			return "Repeater does not exist"
+		}
+	default:
+		return "Invalid target type"
+	}
+	if target.Slot != 0 && target.Slot != 1 && target.Slot != 2 {
+		return "Invalid slot"
+	}
+	if target.SourceID != 0 && !models.UserIDExists(db, target.SourceID) {
+		return "Source user does not exist"
+	}
+	return ""
+}
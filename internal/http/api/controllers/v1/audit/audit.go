@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GETAudit lists the audit log newest first, optionally filtered by actor, action and target
+func GETAudit(c *gin.Context) {
+	db := c.MustGet("PaginatedDB").(*gorm.DB)
+	cDb := c.MustGet("DB").(*gorm.DB)
+
+	filter := models.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+	}
+	if actor := c.Query("actor"); actor != "" {
+		actorID, err := strconv.ParseUint(actor, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor ID"})
+			return
+		}
+		filter.ActorID = uint(actorID)
+	}
+	if target := c.Query("target_id"); target != "" {
+		targetID, err := strconv.ParseUint(target, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target ID"})
+			return
+		}
+		filter.TargetID = uint(targetID)
+	}
+
+	logs := models.FindAuditLogs(db, filter)
+	total := models.CountAuditLogs(cDb, filter)
+	c.JSON(http.StatusOK, gin.H{"total": total, "audit": logs})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/USA-RedDragon/DMRHub/internal/models"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 	"k8s.io/klog/v2"
 )
@@ -43,17 +44,40 @@ func POSTLogin(c *gin.Context) {
 			c.JSON(http.StatusUnauthorized, gin.H{"status": 401, "error": "Authentication failed"})
 			return
 		}
+		redisClient := c.MustGet("Redis").(*redis.Client)
+		if models.LoginLocked(c.Request.Context(), redisClient, user.ID) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"status": 429, "error": "Too many failed logins, please try again later"})
+			return
+		}
 		verified, err := utils.VerifyPassword(json.Password, user.Password, config.GetConfig().PasswordSalt)
 		klog.Infof("POSTLogin: Password verified %v", verified)
+		if !verified || err != nil {
+			models.RecordLoginFailure(c.Request.Context(), redisClient, user.ID)
+		}
 		if verified && err == nil {
 			if user.Approved {
+				if user.TOTPEnabled {
+					// The password alone isn't a login, POSTLoginTOTP finishes it and clears the failures
+					startTwoFactorLogin(session, user.ID)
+					err = session.Save()
+					if err != nil {
+						klog.Errorf("POSTLogin: %v", err)
+						c.JSON(http.StatusInternalServerError, gin.H{"status": 500, "error": "Error saving session"})
+						return
+					}
+					c.JSON(http.StatusOK, gin.H{"status": 200, "message": "Two-factor authentication required", "two_factor_required": true})
+					return
+				}
+				session.Delete(pendingUserIDKey)
 				session.Set("user_id", user.ID)
+				session.Set(twoFactorKey, false)
 				err = session.Save()
 				if err != nil {
 					klog.Errorf("POSTLogin: %v", err)
 					c.JSON(http.StatusInternalServerError, gin.H{"status": 500, "error": "Error saving session"})
 					return
 				}
+				models.ClearLoginFailures(c.Request.Context(), redisClient, user.ID)
 				c.JSON(http.StatusOK, gin.H{"status": 200, "message": "Logged in"})
 				return
 			}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/email"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
+	sessionStore "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// GETVerifyEmail is the link in verification emails. Once a new user's address checks out,
+// the admins are told they're waiting for approval.
+func GETVerifyEmail(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	token, err := models.ConsumeEmailToken(db, c.Query("token"), models.EmailTokenVerify)
+	if errors.Is(err, models.ErrEmailTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification link is invalid or has expired"})
+		return
+	} else if err != nil {
+		klog.Errorf("GETVerifyEmail: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email"})
+		return
+	}
+	var user models.User
+	db.Find(&user, "id = ?", token.UserID)
+	// The user may have changed their address since the link was sent
+	if user.ID == 0 || !strings.EqualFold(user.Email, token.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification link is invalid or has expired"})
+		return
+	}
+	if !user.EmailVerified {
+		err = db.Model(&user).Update("email_verified", true).Error
+		if err != nil {
+			klog.Errorf("GETVerifyEmail: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email"})
+			return
+		}
+		models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+		if !user.Approved {
+			email.NotifyPendingApproval(db, user)
+		}
+	}
+	c.Redirect(http.StatusFound, "/?email_verified=true")
+}
+
+// POSTPasswordReset emails a password reset link to the verified address given. It answers
+// the same whether or not the address belongs to anyone, so it can't be used to find accounts.
+func POSTPasswordReset(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	var json apimodels.PasswordResetRequest
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTPasswordReset: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	if !email.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Password reset by email is not enabled, please contact an admin"})
+		return
+	}
+	user := models.FindUserByVerifiedEmail(db, strings.TrimSpace(json.Email))
+	if user.ID != 0 && !user.Suspended {
+		token, err := models.CreateEmailToken(db, user.ID, models.EmailTokenPasswordReset, user.Email, models.PasswordResetTTL)
+		if err != nil {
+			klog.Errorf("POSTPasswordReset: Error creating token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending password reset"})
+			return
+		}
+		email.Send(email.PasswordReset(user.Email, user.Callsign, token, models.PasswordResetTTL))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If that address belongs to an account, a password reset link is on its way"})
+}
+
+// POSTPasswordResetConfirm sets a new password with the token from a password reset email
+func POSTPasswordResetConfirm(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	var json apimodels.PasswordReset
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTPasswordResetConfirm: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	if strings.TrimSpace(json.Password) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password cannot be blank"})
+		return
+	}
+	token, err := models.ConsumeEmailToken(db, json.Token, models.EmailTokenPasswordReset)
+	if errors.Is(err, models.ErrEmailTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password reset link is invalid or has expired"})
+		return
+	} else if err != nil {
+		klog.Errorf("POSTPasswordResetConfirm: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password"})
+		return
+	}
+	var user models.User
+	db.Find(&user, "id = ?", token.UserID)
+	// The link only stands for the verified address it was sent to, which may have changed since
+	if user.ID == 0 || !user.EmailVerified || !strings.EqualFold(user.Email, token.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password reset link is invalid or has expired"})
+		return
+	}
+	err = db.Model(&models.User{}).Where("id = ?", token.UserID).
+		Update("password", utils.HashPassword(json.Password, config.GetConfig().PasswordSalt)).Error
+	if err != nil {
+		klog.Errorf("POSTPasswordResetConfirm: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password"})
+		return
+	}
+	// Whoever knew the old password is logged out and no longer locks the account
+	redisClient := c.MustGet("Redis").(*redis.Client)
+	err = sessionStore.RevokeAll(c.Request.Context(), redisClient, token.UserID, "")
+	if err != nil {
+		klog.Errorf("POSTPasswordResetConfirm: Error logging out user %d: %v", token.UserID, err)
+	}
+	models.ClearLoginFailures(c.Request.Context(), redisClient, token.UserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset, you can now log in"})
+}
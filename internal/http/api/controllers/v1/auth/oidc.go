@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/email"
+	sessionStore "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/USA-RedDragon/DMRHub/internal/oidc"
+	"github.com/USA-RedDragon/DMRHub/internal/userdb"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+const (
+	oidcStateKey = "oidc_state"
+	oidcNonceKey = "oidc_nonce"
+)
+
+var (
+	errOIDCCallsignLinked = errors.New("callsign is linked to another single sign-on account")
+	errOIDCNoAccount      = errors.New("no account matches and the provider did not send a valid DMR ID and callsign")
+	errOIDCIDTaken        = errors.New("DMR ID is already registered to another account")
+	errOIDCClosed         = errors.New("registration is not open to single sign-on logins")
+)
+
+// GETOIDCLogin sends the user to the identity provider to log in
+func GETOIDCLogin(c *gin.Context) {
+	provider, err := oidc.Default(c.Request.Context())
+	if errors.Is(err, oidc.ErrNotConfigured) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not enabled"})
+		return
+	} else if err != nil {
+		klog.Errorf("GETOIDCLogin: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Error contacting identity provider"})
+		return
+	}
+	state, err := oidc.NewState()
+	if err != nil {
+		klog.Errorf("GETOIDCLogin: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting login"})
+		return
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		klog.Errorf("GETOIDCLogin: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting login"})
+		return
+	}
+	session := sessions.Default(c)
+	session.Set(oidcStateKey, state)
+	session.Set(oidcNonceKey, nonce)
+	err = session.Save()
+	if err != nil {
+		klog.Errorf("GETOIDCLogin: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving session"})
+		return
+	}
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce))
+}
+
+// GETOIDCCallback finishes a single sign-on login when the identity provider sends the user back
+func GETOIDCCallback(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	provider, err := oidc.Default(c.Request.Context())
+	if errors.Is(err, oidc.ErrNotConfigured) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not enabled"})
+		return
+	} else if err != nil {
+		klog.Errorf("GETOIDCCallback: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Error contacting identity provider"})
+		return
+	}
+
+	// The state and nonce are only good for one try
+	session := sessions.Default(c)
+	state, _ := session.Get(oidcStateKey).(string)
+	nonce, _ := session.Get(oidcNonceKey).(string)
+	session.Delete(oidcStateKey)
+	session.Delete(oidcNonceKey)
+	err = session.Save()
+	if err != nil {
+		klog.Errorf("GETOIDCCallback: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving session"})
+		return
+	}
+	if state == "" || c.Query("state") != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login expired or was started elsewhere, please try again"})
+		return
+	}
+	if idpErr := c.Query("error"); idpErr != "" {
+		klog.Errorf("GETOIDCCallback: Identity provider returned %s: %s", idpErr, c.Query("error_description"))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), c.Query("code"), nonce)
+	if err != nil {
+		klog.Errorf("GETOIDCCallback: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	user, err := oidcUser(c, db, claims)
+	if err != nil {
+		klog.Errorf("GETOIDCCallback: subject %s: %v", claims.Subject(), err)
+		switch {
+		case errors.Is(err, errOIDCCallsignLinked), errors.Is(err, errOIDCIDTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "Your callsign or DMR ID is already linked to another account"})
+		case errors.Is(err, errOIDCNoAccount):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No account matches your identity provider login"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging in"})
+		}
+		return
+	}
+	if user.Suspended {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is suspended"})
+		return
+	}
+	if !user.Approved {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not approved"})
+		return
+	}
+
+	redirect := "/"
+	if user.TOTPEnabled {
+		// Accounts with two-factor authentication still need a code, the provider login stands in for the password
+		startTwoFactorLogin(session, user.ID)
+		redirect = "/?two_factor_required=true"
+	} else {
+		session.Set("user_id", user.ID)
+		session.Set(twoFactorKey, false)
+	}
+	err = session.Save()
+	if err != nil {
+		klog.Errorf("GETOIDCCallback: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving session"})
+		return
+	}
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// oidcUser finds the account for a provider login. Accounts are matched by subject, then linked by
+// callsign on first login, and finally created unapproved from the DMR ID and callsign claims.
+// Admin follows the provider's groups when admin groups are configured.
+func oidcUser(c *gin.Context, db *gorm.DB, claims oidc.Claims) (models.User, error) {
+	cfg := config.GetConfig()
+	subject := claims.Subject()
+	callsign := strings.ToUpper(strings.TrimSpace(claims.String(cfg.OIDCCallsignClaim)))
+
+	user := models.FindUserByOIDCSubject(db, subject)
+	if user.ID == 0 && callsign != "" {
+		user = models.FindUserByCallsign(db, callsign)
+		// The built in parrot and admin accounts are never linked to a provider login
+		if user.ID == 9990 || user.ID == 999999 {
+			return models.User{}, errOIDCNoAccount
+		}
+		if user.ID != 0 {
+			if user.OIDCSubject != nil {
+				return models.User{}, errOIDCCallsignLinked
+			}
+			err := db.Model(&user).Update("oidc_subject", subject).Error
+			if err != nil {
+				return models.User{}, err
+			}
+			klog.Infof("Linked user %d to single sign-on subject %s", user.ID, subject)
+		}
+	}
+	if user.ID == 0 {
+		// Provider logins have no way to give an invite code
+		mode := models.CurrentAppSettings().Registration()
+		if mode == models.RegistrationModeClosed || mode == models.RegistrationModeInvite {
+			return models.User{}, errOIDCClosed
+		}
+		dmrID := claims.Uint(cfg.OIDCDMRIDClaim)
+		if callsign == "" || !userdb.IsValidUserID(dmrID) || !userdb.IsInDB(dmrID, callsign) {
+			return models.User{}, errOIDCNoAccount
+		}
+		if models.UserIDExists(db, dmrID) {
+			return models.User{}, errOIDCIDTaken
+		}
+		username := claims.String("preferred_username")
+		var taken int64
+		db.Model(&models.User{}).Where("username = ?", username).Count(&taken)
+		if username == "" || taken > 0 {
+			username = callsign
+		}
+		user = models.User{
+			ID:          dmrID,
+			Callsign:    callsign,
+			Username:    username,
+			Approved:    mode == models.RegistrationModeAutoApprove,
+			Admin:       false,
+			OIDCSubject: &subject,
+		}
+		err := db.Create(&user).Error
+		if err != nil {
+			return models.User{}, err
+		}
+		klog.Infof("Created user %d from single sign-on subject %s", user.ID, subject)
+		if !user.Approved {
+			email.NotifyPendingApproval(db, user)
+		}
+	}
+
+	if len(cfg.OIDCAdminGroups) > 0 && user.ID != 999999 {
+		admin := claims.InAnyGroup(cfg.OIDCGroupsClaim, cfg.OIDCAdminGroups)
+		if admin != user.Admin {
+			before := user
+			err := db.Model(&user).Update("admin", admin).Error
+			if err != nil {
+				return models.User{}, err
+			}
+			user.Admin = admin
+			action := models.AuditUserDemote
+			if admin {
+				action = models.AuditUserPromote
+			} else {
+				// Sessions logged in elsewhere were started as an admin
+				err = sessionStore.RevokeAll(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID, sessions.Default(c).ID())
+				if err != nil {
+					klog.Errorf("Error logging out demoted user %d: %v", user.ID, err)
+				}
+			}
+			// Group changes come from the provider rather than whoever is logged in here
+			models.RecordAudit(db, models.AuditLog{
+				Source:     models.AuditSourceSystem,
+				Action:     action,
+				TargetType: models.AuditTargetUser,
+				TargetID:   user.ID,
+				Before:     models.NewAuditValue(before),
+				After:      models.NewAuditValue(user),
+				IP:         c.ClientIP(),
+			})
+		}
+	}
+	models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+	return user, nil
+}
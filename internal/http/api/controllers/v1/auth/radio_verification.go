@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// POSTRadioVerification hands an unapproved user a fresh code to private call from their radio.
+// They can't log in yet, so it takes the same credentials as POSTLogin.
+func POSTRadioVerification(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	var json apimodels.AuthLogin
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTRadioVerification: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	if (json.Username == "" && json.Callsign == "") || json.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username or Callsign and Password must be provided"})
+		return
+	}
+	var user models.User
+	if json.Username != "" {
+		db.Find(&user, "username = ?", json.Username)
+	} else {
+		db.Find(&user, "callsign = ?", json.Callsign)
+	}
+	if user.ID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	redisClient := c.MustGet("Redis").(*redis.Client)
+	if models.LoginLocked(c.Request.Context(), redisClient, user.ID) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed logins, please try again later"})
+		return
+	}
+	verified, err := utils.VerifyPassword(json.Password, user.Password, config.GetConfig().PasswordSalt)
+	if !verified || err != nil {
+		models.RecordLoginFailure(c.Request.Context(), redisClient, user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	// This isn't a login, so failures from earlier logins still stand
+	if user.Suspended {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is suspended"})
+		return
+	}
+	if user.RadioVerified || user.Approved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is already approved"})
+		return
+	}
+	code, err := models.CreateRadioVerification(c.Request.Context(), redisClient, user.ID)
+	if err != nil {
+		klog.Errorf("POSTRadioVerification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating radio verification code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":                       "Make a private call to the code from your radio to verify your DMR ID",
+		"radio_verification_id":         code,
+		"radio_verification_expires_in": int(models.RadioVerificationTTL.Seconds()),
+	})
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// pendingUserIDKey holds the user who got their password right but hasn't given a second factor yet
+	pendingUserIDKey     = "pending_user_id"
+	twoFactorAttemptsKey = "two_factor_attempts"
+	// twoFactorKey marks a session that logged in with a second factor
+	twoFactorKey = "two_factor"
+	// maxTwoFactorAttempts wrong codes sends the user back to entering their password. Wrong codes
+	// also count toward the account's lockout, which starting over with the password doesn't reset.
+	maxTwoFactorAttempts = 5
+)
+
+func startTwoFactorLogin(session sessions.Session, userID uint) {
+	session.Delete("user_id")
+	session.Set(twoFactorKey, false)
+	session.Set(pendingUserIDKey, userID)
+	session.Set(twoFactorAttemptsKey, 0)
+}
+
+// POSTLoginTOTP finishes a login with a code from the user's authenticator app or a recovery code
+func POSTLoginTOTP(c *gin.Context) {
+	session := sessions.Default(c)
+	db := c.MustGet("DB").(*gorm.DB)
+
+	var json apimodels.TOTPCode
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTLoginTOTP: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	userID, ok := session.Get(pendingUserIDKey).(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": 401, "error": "Log in with your password first"})
+		return
+	}
+	user := models.FindUserByID(db, userID)
+	if user.ID == 0 || !user.TOTPEnabled || !user.Approved || user.Suspended {
+		session.Clear()
+		_ = session.Save()
+		c.JSON(http.StatusUnauthorized, gin.H{"status": 401, "error": "Authentication failed"})
+		return
+	}
+
+	redisClient := c.MustGet("Redis").(*redis.Client)
+	if models.LoginLocked(c.Request.Context(), redisClient, user.ID) {
+		session.Clear()
+		_ = session.Save()
+		c.JSON(http.StatusTooManyRequests, gin.H{"status": 429, "error": "Too many failed logins, please try again later"})
+		return
+	}
+
+	if !models.VerifyTwoFactor(db, &user, json.Code) {
+		models.RecordLoginFailure(c.Request.Context(), redisClient, user.ID)
+		attempts, _ := session.Get(twoFactorAttemptsKey).(int)
+		attempts++
+		if attempts >= maxTwoFactorAttempts {
+			session.Clear()
+		} else {
+			session.Set(twoFactorAttemptsKey, attempts)
+		}
+		err = session.Save()
+		if err != nil {
+			klog.Errorf("POSTLoginTOTP: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"status": 401, "error": "Authentication failed"})
+		return
+	}
+
+	models.ClearLoginFailures(c.Request.Context(), redisClient, user.ID)
+	session.Delete(pendingUserIDKey)
+	session.Delete(twoFactorAttemptsKey)
+	session.Set("user_id", user.ID)
+	session.Set(twoFactorKey, true)
+	err = session.Save()
+	if err != nil {
+		klog.Errorf("POSTLoginTOTP: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": 500, "error": "Error saving session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": 200, "message": "Logged in"})
+}
@@ -0,0 +1,179 @@
+package bridges
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+func GETBridges(c *gin.Context) {
+	db := c.MustGet("PaginatedDB").(*gorm.DB)
+	cDb := c.MustGet("DB").(*gorm.DB)
+	bridges := models.ListBridges(db)
+	total := models.CountBridges(cDb)
+	c.JSON(http.StatusOK, gin.H{"total": total, "bridges": bridges})
+}
+
+func GETBridge(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bridge ID"})
+		return
+	}
+	if !models.BridgeIDExists(db, uint(idUint64)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bridge does not exist"})
+		return
+	}
+	c.JSON(http.StatusOK, models.FindBridgeByID(db, uint(idUint64)))
+}
+
+func POSTBridge(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	var json apimodels.BridgePost
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTBridge: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	json.Name = strings.TrimSpace(json.Name)
+	if len(json.Name) > 40 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be less than 40 characters"})
+		return
+	}
+	if json.SourceTalkgroupID == json.DestinationTalkgroupID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A talkgroup cannot be bridged to itself"})
+		return
+	}
+	if !models.TalkgroupIDExists(db, json.SourceTalkgroupID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source talkgroup does not exist"})
+		return
+	}
+	if !models.TalkgroupIDExists(db, json.DestinationTalkgroupID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Destination talkgroup does not exist"})
+		return
+	}
+	if json.StartsAt != nil && json.EndsAt != nil && !json.EndsAt.After(*json.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End time must be after start time"})
+		return
+	}
+
+	bridge := models.Bridge{
+		Name:                   json.Name,
+		SourceTalkgroupID:      json.SourceTalkgroupID,
+		DestinationTalkgroupID: json.DestinationTalkgroupID,
+		Bidirectional:          json.Bidirectional,
+		Enabled:                true,
+		StartsAt:               json.StartsAt,
+		EndsAt:                 json.EndsAt,
+	}
+	if json.Enabled != nil {
+		bridge.Enabled = *json.Enabled
+	}
+	err = db.Create(&bridge).Error
+	if err != nil {
+		klog.Errorf("POSTBridge: Error creating bridge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating bridge"})
+		return
+	}
+	models.PublishBridgesReload(c.Request.Context(), redis)
+	audit.Record(c, models.AuditBridgeCreate, models.AuditTargetBridge, bridge.ID, nil, bridge)
+	c.JSON(http.StatusOK, models.FindBridgeByID(db, bridge.ID))
+}
+
+func PATCHBridge(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bridge ID"})
+		return
+	}
+	bridge := models.FindBridgeByID(db, uint(idUint64))
+	if bridge.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bridge does not exist"})
+		return
+	}
+
+	var json apimodels.BridgePatch
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("PATCHBridge: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	before := bridge
+	if json.Name != nil {
+		name := strings.TrimSpace(*json.Name)
+		if len(name) > 40 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be less than 40 characters"})
+			return
+		}
+		bridge.Name = name
+	}
+	if json.Bidirectional != nil {
+		bridge.Bidirectional = *json.Bidirectional
+	}
+	if json.Enabled != nil {
+		bridge.Enabled = *json.Enabled
+	}
+	if json.ClearWindow {
+		bridge.StartsAt = nil
+		bridge.EndsAt = nil
+	}
+	if json.StartsAt != nil {
+		bridge.StartsAt = json.StartsAt
+	}
+	if json.EndsAt != nil {
+		bridge.EndsAt = json.EndsAt
+	}
+	if bridge.StartsAt != nil && bridge.EndsAt != nil && !bridge.EndsAt.After(*bridge.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "End time must be after start time"})
+		return
+	}
+
+	err = db.Save(&bridge).Error
+	if err != nil {
+		klog.Errorf("PATCHBridge: Error saving bridge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating bridge"})
+		return
+	}
+	models.PublishBridgesReload(c.Request.Context(), redis)
+	audit.Record(c, models.AuditBridgeUpdate, models.AuditTargetBridge, bridge.ID, before, bridge)
+	c.JSON(http.StatusOK, bridge)
+}
+
+func DELETEBridge(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bridge ID"})
+		return
+	}
+	if !models.BridgeIDExists(db, uint(idUint64)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bridge does not exist"})
+		return
+	}
+	before := models.FindBridgeByID(db, uint(idUint64))
+	models.DeleteBridge(db, uint(idUint64))
+	if db.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
+		return
+	}
+	models.PublishBridgesReload(c.Request.Context(), redis)
+	audit.Record(c, models.AuditBridgeDelete, models.AuditTargetBridge, uint(idUint64), before, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Bridge deleted"})
+}
@@ -0,0 +1,96 @@
+package invites
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+func GETInvites(c *gin.Context) {
+	db := c.MustGet("PaginatedDB").(*gorm.DB)
+	cDb := c.MustGet("DB").(*gorm.DB)
+	inviteCodes := models.ListInviteCodes(db)
+	total := models.CountInviteCodes(cDb)
+	c.JSON(http.StatusOK, gin.H{"total": total, "invites": inviteCodes})
+}
+
+// POSTInvite issues an invite code for registering while registration is invite only
+func POSTInvite(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	userID, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	var json apimodels.InviteCodePost
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTInvite: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	json.Note = strings.TrimSpace(json.Note)
+	if len(json.Note) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Note must be less than 100 characters"})
+		return
+	}
+	if json.ExpiresAt != nil && !json.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+	code, err := models.GenerateInviteCode()
+	if err != nil {
+		klog.Errorf("POSTInvite: Error generating invite code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating invite"})
+		return
+	}
+	inviteCode := models.InviteCode{
+		Code:        code,
+		Note:        json.Note,
+		MaxUses:     1,
+		ExpiresAt:   json.ExpiresAt,
+		CreatedByID: userID,
+	}
+	if json.MaxUses != nil {
+		inviteCode.MaxUses = *json.MaxUses
+	}
+	err = db.Create(&inviteCode).Error
+	if err != nil {
+		klog.Errorf("POSTInvite: Error creating invite code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating invite"})
+		return
+	}
+	audit.Record(c, models.AuditInviteCreate, models.AuditTargetInvite, inviteCode.ID, nil, inviteCode)
+	c.JSON(http.StatusOK, inviteCode)
+}
+
+func DELETEInvite(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+	inviteCode := models.FindInviteCodeByID(db, uint(idUint64))
+	if inviteCode.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invite does not exist"})
+		return
+	}
+	err = db.Delete(&inviteCode).Error
+	if err != nil {
+		klog.Errorf("DELETEInvite: Error deleting invite code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting invite"})
+		return
+	}
+	audit.Record(c, models.AuditInviteDelete, models.AuditTargetInvite, inviteCode.ID, inviteCode, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Invite deleted"})
+}
@@ -18,6 +18,10 @@ func GETLastheard(c *gin.Context) {
 	var calls []models.Call
 	var count int
 	if userID == nil {
+		if !models.CurrentAppSettings().LastheardIsPublic() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
 		// This is okay, we just query the latest public calls
 		calls = models.FindCalls(db)
 		count = models.CountCalls(cDb)
@@ -0,0 +1,286 @@
+package nets
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+func GETNets(c *gin.Context) {
+	db := c.MustGet("PaginatedDB").(*gorm.DB)
+	cDb := c.MustGet("DB").(*gorm.DB)
+	var nets []models.Net
+	var total int
+	if c.Query("active") == "true" {
+		nets = models.ListActiveNets(db)
+		total = models.CountActiveNets(cDb)
+	} else {
+		nets = models.ListNets(db)
+		total = models.CountNets(cDb)
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "nets": nets})
+}
+
+func GETNet(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid net ID"})
+		return
+	}
+	if !models.NetIDExists(db, uint(idUint64)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Net does not exist"})
+		return
+	}
+	c.JSON(http.StatusOK, models.FindNetByID(db, uint(idUint64)))
+}
+
+func POSTNetStart(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	session := sessions.Default(c)
+	userID := session.Get("user_id")
+	if userID == nil {
+		klog.Error("userID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
+		return
+	}
+	talkgroupID := uint(idUint64)
+	if !models.TalkgroupIDExists(db, talkgroupID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup does not exist"})
+		return
+	}
+
+	var json apimodels.NetStart
+	// The body is optional, a net can be started without a description
+	if c.Request.ContentLength > 0 {
+		err = c.ShouldBindJSON(&json)
+		if err != nil {
+			klog.Errorf("POSTNetStart: JSON data is invalid: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+			return
+		}
+	}
+
+	if models.ActiveNetExistsForTalkgroup(db, talkgroupID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A net is already active on this talkgroup"})
+		return
+	}
+
+	net := models.Net{
+		TalkgroupID: talkgroupID,
+		StartedByID: userID.(uint),
+		Description: json.Description,
+		StartTime:   time.Now(),
+		Active:      true,
+	}
+	err = db.Create(&net).Error
+	if err != nil {
+		klog.Errorf("POSTNetStart: Error creating net: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating net"})
+		return
+	}
+	net = models.FindNetByID(db, net.ID)
+	models.PublishNetEvent(c.Request.Context(), redis, models.NetEvent{
+		Type:  models.NetEventStarted,
+		NetID: net.ID,
+	})
+	audit.Record(c, models.AuditNetStart, models.AuditTargetNet, net.ID, nil, net)
+	c.JSON(http.StatusOK, net)
+}
+
+func POSTNetStop(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid net ID"})
+		return
+	}
+	net := models.FindNetByID(db, uint(idUint64))
+	if net.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Net does not exist"})
+		return
+	}
+	if !net.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Net is not active"})
+		return
+	}
+
+	before := net
+	now := time.Now()
+	net.EndTime = &now
+	net.Active = false
+	err = db.Save(&net).Error
+	if err != nil {
+		klog.Errorf("POSTNetStop: Error saving net: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error stopping net"})
+		return
+	}
+	models.PublishNetEvent(c.Request.Context(), redis, models.NetEvent{
+		Type:  models.NetEventClosed,
+		NetID: net.ID,
+	})
+	audit.Record(c, models.AuditNetStop, models.AuditTargetNet, net.ID, before, net)
+	c.JSON(http.StatusOK, net)
+}
+
+func GETNetCheckIns(c *gin.Context) {
+	db := c.MustGet("PaginatedDB").(*gorm.DB)
+	cDb := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid net ID"})
+		return
+	}
+	netID := uint(idUint64)
+	if !models.NetIDExists(cDb, netID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Net does not exist"})
+		return
+	}
+	checkIns := models.FindNetCheckIns(db, netID)
+	total := models.CountNetCheckIns(cDb, netID)
+	c.JSON(http.StatusOK, gin.H{"total": total, "check_ins": checkIns})
+}
+
+func PATCHNetCheckIn(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	checkIn, ok := findCheckIn(c, db)
+	if !ok {
+		return
+	}
+
+	var json apimodels.NetCheckInPatch
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("PATCHNetCheckIn: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	before := checkIn
+	checkIn.Notes = json.Notes
+	err = db.Save(&checkIn).Error
+	if err != nil {
+		klog.Errorf("PATCHNetCheckIn: Error saving check-in: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating check-in"})
+		return
+	}
+	models.PublishNetEvent(c.Request.Context(), redis, models.NetEvent{
+		Type:    models.NetEventCheckInUpdate,
+		NetID:   checkIn.NetID,
+		CheckIn: &checkIn,
+	})
+	audit.Record(c, models.AuditCheckInUpdate, models.AuditTargetCheckIn, checkIn.ID, before, checkIn)
+	c.JSON(http.StatusOK, checkIn)
+}
+
+func DELETENetCheckIn(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	checkIn, ok := findCheckIn(c, db)
+	if !ok {
+		return
+	}
+
+	err := db.Unscoped().Delete(&checkIn).Error
+	if err != nil {
+		klog.Errorf("DELETENetCheckIn: Error deleting check-in: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting check-in"})
+		return
+	}
+	models.PublishNetEvent(c.Request.Context(), redis, models.NetEvent{
+		Type:    models.NetEventCheckInDelete,
+		NetID:   checkIn.NetID,
+		CheckIn: &checkIn,
+	})
+	audit.Record(c, models.AuditCheckInDelete, models.AuditTargetCheckIn, checkIn.ID, checkIn, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Check-in deleted"})
+}
+
+func GETNetExport(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid net ID"})
+		return
+	}
+	net := models.FindNetByID(db, uint(idUint64))
+	if net.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Net does not exist"})
+		return
+	}
+	checkIns := models.FindNetCheckIns(db, net.ID)
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=net-%d.json", net.ID))
+		c.JSON(http.StatusOK, gin.H{"net": net, "check_ins": checkIns})
+	case "csv":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=net-%d.csv", net.ID))
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		writer := csv.NewWriter(c.Writer)
+		err = writer.Write([]string{"dmr_id", "callsign", "name", "repeater_id", "repeater_callsign", "calls", "first_heard", "last_heard", "notes"})
+		if err != nil {
+			klog.Errorf("GETNetExport: Error writing CSV: %v", err)
+			return
+		}
+		for _, checkIn := range checkIns {
+			err = writer.Write([]string{
+				strconv.FormatUint(uint64(checkIn.UserID), 10),
+				checkIn.Callsign,
+				checkIn.Name,
+				strconv.FormatUint(uint64(checkIn.RepeaterID), 10),
+				checkIn.RepeaterCallsign,
+				strconv.FormatUint(uint64(checkIn.Calls), 10),
+				checkIn.FirstHeard.UTC().Format(time.RFC3339),
+				checkIn.LastHeard.UTC().Format(time.RFC3339),
+				checkIn.Notes,
+			})
+			if err != nil {
+				klog.Errorf("GETNetExport: Error writing CSV: %v", err)
+				return
+			}
+		}
+		writer.Flush()
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export format"})
+	}
+}
+
+func findCheckIn(c *gin.Context, db *gorm.DB) (models.NetCheckIn, bool) {
+	netID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid net ID"})
+		return models.NetCheckIn{}, false
+	}
+	checkInID, err := strconv.ParseUint(c.Param("checkin"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid check-in ID"})
+		return models.NetCheckIn{}, false
+	}
+	checkIn := models.FindNetCheckIn(db, uint(netID), uint(checkInID))
+	if checkIn.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Check-in does not exist"})
+		return models.NetCheckIn{}, false
+	}
+	return checkIn, true
+}
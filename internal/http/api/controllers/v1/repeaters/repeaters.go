@@ -6,8 +6,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
 	"github.com/USA-RedDragon/DMRHub/internal/models"
 	"github.com/USA-RedDragon/DMRHub/internal/repeaterdb"
@@ -21,11 +24,26 @@ import (
 func GETRepeaters(c *gin.Context) {
 	db := c.MustGet("PaginatedDB").(*gorm.DB)
 	cDb := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
 	repeaters := models.ListRepeaters(db)
 	count := models.CountRepeaters(cDb)
+	models.LoadRepeaterStates(c.Request.Context(), redis, repeaters, true)
 	c.JSON(http.StatusOK, gin.H{"total": count, "repeaters": repeaters})
 }
 
+// GETConnectedRepeaters is the public list of repeaters currently connected to the server
+func GETConnectedRepeaters(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	repeaters, err := models.ListConnectedRepeaters(c.Request.Context(), db, redis)
+	if err != nil {
+		klog.Errorf("GETConnectedRepeaters: Error listing connected repeaters: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing connected repeaters"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(repeaters), "repeaters": repeaters})
+}
+
 func GETMyRepeaters(c *gin.Context) {
 	db := c.MustGet("PaginatedDB").(*gorm.DB)
 	cDb := c.MustGet("DB").(*gorm.DB)
@@ -47,6 +65,7 @@ func GETMyRepeaters(c *gin.Context) {
 	}
 
 	count := models.CountUserRepeaters(cDb, userID.(uint))
+	models.LoadRepeaterStates(c.Request.Context(), c.MustGet("Redis").(*redis.Client), repeaters, true)
 
 	c.JSON(http.StatusOK, gin.H{"total": count, "repeaters": repeaters})
 }
@@ -62,6 +81,14 @@ func GETRepeater(c *gin.Context) {
 	}
 	if models.RepeaterIDExists(db, uint(repeaterID)) {
 		repeater := models.FindRepeaterByID(db, uint(repeaterID))
+		// Only the owner and those who can see every repeater get to see where it's connecting from
+		showAddress := false
+		userID := sessions.Default(c).Get("user_id")
+		if userID != nil {
+			user := models.FindUserWithRoles(db, userID.(uint))
+			showAddress = user.HasPermission(models.PermissionRepeatersRead) || repeater.OwnerID == user.ID
+		}
+		repeater.LoadLiveState(c.Request.Context(), c.MustGet("Redis").(*redis.Client), showAddress)
 		c.JSON(http.StatusOK, repeater)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
@@ -75,14 +102,62 @@ func DELETERepeater(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
 		return
 	}
+	before := models.FindRepeaterByID(db, uint(idUint64))
 	models.DeleteRepeater(db, uint(idUint64))
 	if db.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 		return
 	}
+	models.InvalidateRepeaterCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), uint(idUint64))
+	audit.Record(c, models.AuditRepeaterDelete, models.AuditTargetRepeater, uint(idUint64), before, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Repeater deleted"})
 }
 
+func PATCHRepeater(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Repeater ID"})
+		return
+	}
+	if !models.RepeaterIDExists(db, uint(idUint64)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	repeater := models.FindRepeaterByID(db, uint(idUint64))
+
+	var json apimodels.RepeaterPatch
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("PATCHRepeater: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	before := repeater
+	if json.ClearDynamicTalkgroupTimeout {
+		repeater.DynamicTalkgroupTimeout = nil
+	} else if json.DynamicTalkgroupTimeout != nil {
+		// A week is plenty, anything longer should be a static talkgroup
+		if *json.DynamicTalkgroupTimeout > 7*24*60 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dynamic talkgroup timeout must be at most 10080 minutes"})
+			return
+		}
+		repeater.DynamicTalkgroupTimeout = json.DynamicTalkgroupTimeout
+	}
+
+	err = db.Model(&repeater).Select("DynamicTalkgroupTimeout").Updates(&repeater).Error
+	if err != nil {
+		klog.Errorf("PATCHRepeater: Error updating repeater: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating repeater"})
+		return
+	}
+	models.InvalidateRepeaterCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), repeater.RadioID)
+	audit.Record(c, models.AuditRepeaterUpdate, models.AuditTargetRepeater, repeater.RadioID, before, repeater)
+	repeater.LoadLiveState(c.Request.Context(), c.MustGet("Redis").(*redis.Client), true)
+	c.JSON(http.StatusOK, repeater)
+}
+
 func POSTRepeaterTalkgroups(c *gin.Context) {
 	db := c.MustGet("DB").(*gorm.DB)
 	redis := c.MustGet("Redis").(*redis.Client)
@@ -104,6 +179,7 @@ func POSTRepeaterTalkgroups(c *gin.Context) {
 	}
 	if models.RepeaterIDExists(db, repeaterID) {
 		repeater := models.FindRepeaterByID(db, repeaterID)
+		before := repeater
 		err := db.Model(&repeater).Association("TS1StaticTalkgroups").Replace(json.TS1StaticTalkgroups)
 		if err != nil {
 			klog.Errorf("POSTRepeaterTalkgroups: Error updating TS1StaticTalkgroups: %v", err)
@@ -158,6 +234,8 @@ func POSTRepeaterTalkgroups(c *gin.Context) {
 		}
 
 		db.Save(&repeater)
+		models.InvalidateRepeaterCache(c.Request.Context(), redis, repeater.RadioID)
+		audit.Record(c, models.AuditRepeaterTalkgroups, models.AuditTargetRepeater, repeater.RadioID, before, repeater)
 		repeater.CancelAllSubscriptions()
 		go repeater.ListenForCalls(c.Request.Context(), redis)
 		c.JSON(http.StatusOK, gin.H{"message": "Repeater talkgroups updated"})
@@ -278,6 +356,8 @@ func POSTRepeater(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 			return
 		}
+		models.InvalidateRepeaterCache(c.Request.Context(), redis, repeater.RadioID)
+		audit.Record(c, models.AuditRepeaterCreate, models.AuditTargetRepeater, repeater.RadioID, nil, repeater)
 		go repeater.ListenForCalls(c.Request.Context(), redis)
 		c.JSON(http.StatusOK, gin.H{"message": "Repeater created", "password": repeater.Password})
 	}
@@ -356,6 +436,33 @@ func POSTRepeaterLink(c *gin.Context) {
 	}
 	go repeater.ListenForCallsOn(c.Request.Context(), redis, talkgroup.ID)
 	db.Save(&repeater)
+	models.InvalidateRepeaterCache(c.Request.Context(), redis, repeater.RadioID)
+	audit.Record(c, models.AuditRepeaterLink, models.AuditTargetRepeater, repeater.RadioID, nil, auditLink(linkType, slot, talkgroup.ID))
+	if linkType == "dynamic" {
+		models.TouchDynamicTalkgroup(c.Request.Context(), redis, repeater.RadioID, slot == "2")
+		publishLinkEvent(c, models.RepeaterEventLink, repeater.RadioID, slot, talkgroup.ID)
+	}
+}
+
+func auditLink(linkType string, slot string, talkgroupID uint) models.AuditLink {
+	link := models.AuditLink{Type: linkType, Slot: 1, TalkgroupID: talkgroupID}
+	if slot == "2" {
+		link.Slot = 2
+	}
+	return link
+}
+
+func publishLinkEvent(c *gin.Context, eventType string, repeaterID uint, slot string, talkgroupID uint) {
+	slotNum := uint(1)
+	if slot == "2" {
+		slotNum = 2
+	}
+	models.PublishRepeaterEvent(c.Request.Context(), c.MustGet("Redis").(*redis.Client), models.RepeaterEvent{
+		Type:        eventType,
+		RepeaterID:  repeaterID,
+		Slot:        slotNum,
+		TalkgroupID: talkgroupID,
+	})
 }
 
 func POSTRepeaterUnlink(c *gin.Context) {
@@ -419,6 +526,8 @@ func POSTRepeaterUnlink(c *gin.Context) {
 			repeater.CancelSubscription(oldTGID)
 
 			db.Save(&repeater)
+			models.ClearDynamicTalkgroupActivity(c.Request.Context(), c.MustGet("Redis").(*redis.Client), repeater.RadioID, slot == "2")
+			publishLinkEvent(c, models.RepeaterEventUnlink, repeater.RadioID, slot, oldTGID)
 		case "2":
 			if repeater.TS2DynamicTalkgroupID == nil || *repeater.TS2DynamicTalkgroupID != talkgroup.ID {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup is not linked to repeater"})
@@ -432,6 +541,8 @@ func POSTRepeaterUnlink(c *gin.Context) {
 			repeater.CancelSubscription(oldTGID)
 
 			db.Save(&repeater)
+			models.ClearDynamicTalkgroupActivity(c.Request.Context(), c.MustGet("Redis").(*redis.Client), repeater.RadioID, slot == "2")
+			publishLinkEvent(c, models.RepeaterEventUnlink, repeater.RadioID, slot, oldTGID)
 		}
 	case "static":
 		switch slot {
@@ -484,5 +595,185 @@ func POSTRepeaterUnlink(c *gin.Context) {
 			}
 		}
 	}
+	models.InvalidateRepeaterCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), repeater.RadioID)
+	audit.Record(c, models.AuditRepeaterUnlink, models.AuditTargetRepeater, repeater.RadioID, auditLink(linkType, slot, talkgroup.ID), nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Timeslot unlinked"})
 }
+
+func GETRepeaterRewrites(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	repeaterID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Repeater ID"})
+		return
+	}
+	if !models.RepeaterIDExists(db, uint(repeaterID)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	c.JSON(http.StatusOK, models.FindRepeaterRewrites(db, uint(repeaterID)))
+}
+
+// Quality and connection history default to the last day and go back at most a week
+const (
+	defaultQualityHours = 24
+	maxQualityHours     = 7 * 24
+)
+
+func GETRepeaterQuality(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	repeaterID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Repeater ID"})
+		return
+	}
+	if !models.RepeaterIDExists(db, uint(repeaterID)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	hours := defaultQualityHours
+	if hoursParam := c.Query("hours"); hoursParam != "" {
+		hours, err = strconv.Atoi(hoursParam)
+		if err != nil || hours < 1 || hours > maxQualityHours {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Hours must be between 1 and %d", maxQualityHours)})
+			return
+		}
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	c.JSON(http.StatusOK, gin.H{
+		"repeater_id": repeaterID,
+		"since":       since,
+		"summary":     models.FindRepeaterQuality(db, uint(repeaterID), since),
+		"samples":     models.FindRepeaterQualitySamples(db, uint(repeaterID), since),
+	})
+}
+
+func GETRepeaterConnections(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	repeaterID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Repeater ID"})
+		return
+	}
+	if !models.RepeaterIDExists(db, uint(repeaterID)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+	hours := defaultQualityHours
+	if hoursParam := c.Query("hours"); hoursParam != "" {
+		hours, err = strconv.Atoi(hoursParam)
+		if err != nil || hours < 1 || hours > maxQualityHours {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Hours must be between 1 and %d", maxQualityHours)})
+			return
+		}
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	threshold := config.GetConfig().RepeaterFlapThreshold
+	drops := models.CountRepeaterDrops(db, uint(repeaterID), time.Now().Add(-config.GetConfig().RepeaterFlapWindow))
+	c.JSON(http.StatusOK, gin.H{
+		"repeater_id": repeaterID,
+		"since":       since,
+		"flapping":    threshold > 0 && drops >= int64(threshold),
+		"connections": models.FindRepeaterConnectionLogs(db, uint(repeaterID), since),
+	})
+}
+
+func POSTRepeaterRewrite(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	rid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Repeater ID"})
+		return
+	}
+	repeaterID := uint(rid)
+	if !models.RepeaterIDExists(db, repeaterID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Repeater does not exist"})
+		return
+	}
+
+	var json apimodels.RepeaterRewritePost
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTRepeaterRewrite: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	if json.Slot != 1 && json.Slot != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slot"})
+		return
+	}
+	// Local talkgroups are sent over the air as 24 bit IDs
+	if json.LocalTalkgroupID > 0xFFFFFF || json.LocalTalkgroupID == 4000 || json.LocalTalkgroupID == 9990 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid local talkgroup"})
+		return
+	}
+	if !models.TalkgroupIDExists(db, json.NetworkTalkgroupID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup does not exist"})
+		return
+	}
+
+	timeSlot := json.Slot == 2
+	for _, existing := range models.FindRepeaterRewrites(db, repeaterID) {
+		if existing.NetworkTalkgroupID == json.NetworkTalkgroupID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Talkgroup is already rewritten on this repeater"})
+			return
+		}
+		if existing.LocalTalkgroupID == json.LocalTalkgroupID && existing.TimeSlot == timeSlot {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Local talkgroup is already in use on this slot"})
+			return
+		}
+	}
+
+	rewrite := models.RepeaterRewrite{
+		RepeaterID:         repeaterID,
+		NetworkTalkgroupID: json.NetworkTalkgroupID,
+		LocalTalkgroupID:   json.LocalTalkgroupID,
+		TimeSlot:           timeSlot,
+	}
+	err = db.Create(&rewrite).Error
+	if err != nil {
+		klog.Errorf("POSTRepeaterRewrite: Error creating rewrite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating rewrite"})
+		return
+	}
+
+	models.InvalidateRepeaterCache(c.Request.Context(), redis, repeaterID)
+	audit.Record(c, models.AuditRewriteCreate, models.AuditTargetRewrite, rewrite.ID, nil, rewrite)
+	repeater := models.FindRepeaterByID(db, repeaterID)
+	go repeater.ListenForCalls(c.Request.Context(), redis)
+	c.JSON(http.StatusOK, rewrite)
+}
+
+func DELETERepeaterRewrite(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	redis := c.MustGet("Redis").(*redis.Client)
+	rid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Repeater ID"})
+		return
+	}
+	rewriteID, err := strconv.ParseUint(c.Param("rewrite"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rewrite ID"})
+		return
+	}
+	rewrite := models.FindRepeaterRewrite(db, uint(rid), uint(rewriteID))
+	if rewrite.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rewrite does not exist"})
+		return
+	}
+	err = db.Unscoped().Delete(&rewrite).Error
+	if err != nil {
+		klog.Errorf("DELETERepeaterRewrite: Error deleting rewrite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting rewrite"})
+		return
+	}
+
+	models.InvalidateRepeaterCache(c.Request.Context(), redis, uint(rid))
+	audit.Record(c, models.AuditRewriteDelete, models.AuditTargetRewrite, rewrite.ID, rewrite, nil)
+	repeater := models.FindRepeaterByID(db, uint(rid))
+	repeater.CancelSubscription(rewrite.NetworkTalkgroupID)
+	go repeater.ListenForCalls(c.Request.Context(), redis)
+	c.JSON(http.StatusOK, gin.H{"message": "Rewrite deleted"})
+}
@@ -0,0 +1,179 @@
+package roles
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// GETRoles lists the roles along with every permission a role can grant
+func GETRoles(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	roles := models.ListRoles(db)
+	c.JSON(http.StatusOK, gin.H{"total": len(roles), "roles": roles, "permissions": models.Permissions})
+}
+
+func POSTRole(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	var json apimodels.RolePost
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTRole: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	role := models.Role{
+		Name:        strings.TrimSpace(json.Name),
+		Description: strings.TrimSpace(json.Description),
+		Permissions: []string{},
+	}
+	if json.Permissions != nil {
+		role.Permissions = json.Permissions
+	}
+	if !validRole(c, db, role) {
+		return
+	}
+	err = db.Create(&role).Error
+	if err != nil {
+		klog.Errorf("POSTRole: Error creating role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating role"})
+		return
+	}
+	audit.Record(c, models.AuditRoleCreate, models.AuditTargetRole, role.ID, nil, role)
+	c.JSON(http.StatusOK, role)
+}
+
+func PATCHRole(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+	role := models.FindRoleByID(db, uint(idUint64))
+	if role.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role does not exist"})
+		return
+	}
+	var json apimodels.RolePatch
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("PATCHRole: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	before := role
+	if json.Name != nil {
+		role.Name = strings.TrimSpace(*json.Name)
+	}
+	if json.Description != nil {
+		role.Description = strings.TrimSpace(*json.Description)
+	}
+	if json.Permissions != nil {
+		role.Permissions = json.Permissions
+	}
+	if !validRole(c, db, role) {
+		return
+	}
+	err = db.Save(&role).Error
+	if err != nil {
+		klog.Errorf("PATCHRole: Error saving role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating role"})
+		return
+	}
+	audit.Record(c, models.AuditRoleUpdate, models.AuditTargetRole, role.ID, before, role)
+	c.JSON(http.StatusOK, role)
+}
+
+func DELETERole(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+	role := models.FindRoleByID(db, uint(idUint64))
+	if role.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role does not exist"})
+		return
+	}
+	err = models.DeleteRole(db, role.ID)
+	if err != nil {
+		klog.Errorf("DELETERole: Error deleting role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting role"})
+		return
+	}
+	audit.Record(c, models.AuditRoleDelete, models.AuditTargetRole, role.ID, role, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// POSTUserRoles replaces the roles given to a user
+func POSTUserRoles(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+	var json apimodels.UserRoles
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTUserRoles: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	user := models.FindUserWithRoles(db, uint(idUint64))
+	if user.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
+		return
+	}
+	if user.ID == 9990 || user.ID == 999999 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change the roles of a built in user"})
+		return
+	}
+	roles := []models.Role{}
+	for _, roleID := range json.RoleIDs {
+		role := models.FindRoleByID(db, roleID)
+		if role.ID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role does not exist"})
+			return
+		}
+		roles = append(roles, role)
+	}
+	before := user
+	err = models.SetUserRoles(db, &user, roles)
+	if err != nil {
+		klog.Errorf("POSTUserRoles: Error setting roles: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting roles"})
+		return
+	}
+	user.Roles = roles
+	audit.Record(c, models.AuditUserRoles, models.AuditTargetUser, user.ID, before, user)
+	c.JSON(http.StatusOK, gin.H{"message": "User roles updated"})
+}
+
+func validRole(c *gin.Context, db *gorm.DB, role models.Role) bool {
+	if role.Name == "" || len(role.Name) > 40 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 40 characters"})
+		return false
+	}
+	if models.RoleNameExists(db, role.Name, role.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name is already taken"})
+		return false
+	}
+	for _, permission := range role.Permissions {
+		if !models.IsValidPermission(permission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission " + permission})
+			return false
+		}
+	}
+	return true
+}
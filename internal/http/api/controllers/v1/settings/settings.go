@@ -0,0 +1,126 @@
+package settings
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+const (
+	maxNetworkNameLength        = 40
+	maxParrotDelay              = 30
+	maxDynamicTalkgroupTimeout  = 7 * 24 * 60
+	maxMaintenanceMessageLength = 500
+)
+
+// GETPublicSettings returns the settings the site needs before anyone logs in
+func GETPublicSettings(c *gin.Context) {
+	appSettings := models.CurrentAppSettings()
+	c.JSON(http.StatusOK, gin.H{
+		"network_name":         appSettings.Network(),
+		"registration_mode":    appSettings.Registration(),
+		"lastheard_visibility": appSettings.LastheardVisibility,
+		"maintenance_message":  appSettings.MaintenanceMessage,
+	})
+}
+
+func GETSettings(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	c.JSON(http.StatusOK, models.GetAppSettings(db))
+}
+
+func PATCHSettings(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	var json apimodels.SettingsPatch
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("PATCHSettings: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	appSettings := models.GetAppSettings(db)
+	if appSettings.ID == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading settings"})
+		return
+	}
+	before := appSettings
+
+	if json.RequireAdminTwoFactor != nil {
+		// Requiring it without having it would lock this session out of the settings it just changed
+		verified, _ := sessions.Default(c).Get("two_factor").(bool)
+		if *json.RequireAdminTwoFactor && !verified {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Log in with two-factor authentication before requiring it for admins"})
+			return
+		}
+		appSettings.RequireAdminTwoFactor = *json.RequireAdminTwoFactor
+	}
+	if json.RegistrationMode != nil {
+		if !models.IsValidRegistrationMode(*json.RegistrationMode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Registration mode must be one of approval, auto_approve, invite or closed"})
+			return
+		}
+		appSettings.RegistrationMode = *json.RegistrationMode
+	}
+
+	if json.NetworkName != nil {
+		name := strings.TrimSpace(*json.NetworkName)
+		if len(name) > maxNetworkNameLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Network name must be 40 characters or less"})
+			return
+		}
+		appSettings.NetworkName = name
+	}
+	if json.ClearParrotDelay {
+		appSettings.ParrotDelay = nil
+	} else if json.ParrotDelay != nil {
+		if *json.ParrotDelay > maxParrotDelay {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parrot delay must be 30 seconds or less"})
+			return
+		}
+		appSettings.ParrotDelay = json.ParrotDelay
+	}
+	if json.ClearDynamicTalkgroupTimeout {
+		appSettings.DynamicTalkgroupTimeout = nil
+	} else if json.DynamicTalkgroupTimeout != nil {
+		if *json.DynamicTalkgroupTimeout > maxDynamicTalkgroupTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dynamic talkgroup timeout must be a week or less"})
+			return
+		}
+		appSettings.DynamicTalkgroupTimeout = json.DynamicTalkgroupTimeout
+	}
+	if json.LastheardVisibility != nil {
+		if !models.IsValidLastheardVisibility(*json.LastheardVisibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Lastheard visibility must be public or users"})
+			return
+		}
+		appSettings.LastheardVisibility = *json.LastheardVisibility
+	}
+	if json.MaintenanceMessage != nil {
+		message := strings.TrimSpace(*json.MaintenanceMessage)
+		if len(message) > maxMaintenanceMessageLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Maintenance message must be 500 characters or less"})
+			return
+		}
+		appSettings.MaintenanceMessage = message
+	}
+
+	err = db.Save(&appSettings).Error
+	if err != nil {
+		klog.Errorf("PATCHSettings: Error saving settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving settings"})
+		return
+	}
+	audit.Record(c, models.AuditSettingsUpdate, models.AuditTargetSettings, appSettings.ID, before, appSettings)
+	// This instance answers with the new settings straight away, the others pick them up from the reload message
+	models.ReloadAppSettings(db)
+	models.PublishAppSettingsReload(c.Request.Context(), c.MustGet("Redis").(*redis.Client))
+	c.JSON(http.StatusOK, gin.H{"message": "Settings updated"})
+}
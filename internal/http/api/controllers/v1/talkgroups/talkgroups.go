@@ -6,9 +6,11 @@ import (
 	"strings"
 
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
 	"github.com/USA-RedDragon/DMRHub/internal/models"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 	"k8s.io/klog/v2"
 )
@@ -66,11 +68,14 @@ func DELETETalkgroup(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid talkgroup ID"})
 		return
 	}
+	before := models.FindTalkgroupByID(db, uint(idUint64))
 	models.DeleteTalkgroup(db, uint(idUint64))
 	if db.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 		return
 	}
+	models.InvalidateTalkgroupCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), uint(idUint64))
+	audit.Record(c, models.AuditTalkgroupDelete, models.AuditTargetTalkgroup, uint(idUint64), before, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Talkgroup deleted"})
 }
 
@@ -88,6 +93,8 @@ func POSTTalkgroupNCOs(c *gin.Context) {
 		return
 	}
 
+	before := userIDs(talkgroup.NCOs)
+
 	var json apimodels.TalkgroupAdminAction
 	err := c.ShouldBindJSON(&json)
 	if err != nil {
@@ -110,6 +117,8 @@ func POSTTalkgroupNCOs(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 				return
 			}
+			models.InvalidateTalkgroupCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), talkgroup.ID)
+			audit.Record(c, models.AuditTalkgroupNCOs, models.AuditTargetTalkgroup, talkgroup.ID, before, []uint{})
 			c.JSON(http.StatusOK, gin.H{"message": "Talkgroup admins cleared"})
 			return
 		}
@@ -144,6 +153,8 @@ func POSTTalkgroupNCOs(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 			return
 		}
+		models.InvalidateTalkgroupCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), talkgroup.ID)
+		audit.Record(c, models.AuditTalkgroupNCOs, models.AuditTargetTalkgroup, talkgroup.ID, before, json.UserIDs)
 		c.JSON(http.StatusOK, gin.H{"message": "User appointed as net control operator"})
 	}
 }
@@ -162,6 +173,8 @@ func POSTTalkgroupAdmins(c *gin.Context) {
 		return
 	}
 
+	before := userIDs(talkgroup.Admins)
+
 	var json apimodels.TalkgroupAdminAction
 	err := c.ShouldBindJSON(&json)
 	if err != nil {
@@ -184,6 +197,8 @@ func POSTTalkgroupAdmins(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 				return
 			}
+			models.InvalidateTalkgroupCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), talkgroup.ID)
+			audit.Record(c, models.AuditTalkgroupAdmins, models.AuditTargetTalkgroup, talkgroup.ID, before, []uint{})
 			c.JSON(http.StatusOK, gin.H{"message": "Talkgroup admins cleared"})
 			return
 		}
@@ -218,6 +233,8 @@ func POSTTalkgroupAdmins(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 			return
 		}
+		models.InvalidateTalkgroupCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), talkgroup.ID)
+		audit.Record(c, models.AuditTalkgroupAdmins, models.AuditTargetTalkgroup, talkgroup.ID, before, json.UserIDs)
 		c.JSON(http.StatusOK, gin.H{"message": "User appointed as admin"})
 	}
 }
@@ -242,6 +259,7 @@ func PATCHTalkgroup(c *gin.Context) {
 			return
 		}
 
+		before := talkgroup
 		if json.Name != "" {
 			// Validate length less than 20 characters
 			if len(json.Name) > 20 {
@@ -271,8 +289,15 @@ func PATCHTalkgroup(c *gin.Context) {
 			}
 			talkgroup.Description = json.Description
 		}
+		if json.ClearTransmitTimeout {
+			talkgroup.TransmitTimeout = nil
+		} else if json.TransmitTimeout != nil {
+			talkgroup.TransmitTimeout = json.TransmitTimeout
+		}
 
 		db.Save(&talkgroup)
+		models.InvalidateTalkgroupCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), talkgroup.ID)
+		audit.Record(c, models.AuditTalkgroupUpdate, models.AuditTargetTalkgroup, talkgroup.ID, before, talkgroup)
 	}
 }
 
@@ -320,6 +345,16 @@ func POSTTalkgroup(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 			return
 		}
+		models.InvalidateTalkgroupCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), talkgroup.ID)
+		audit.Record(c, models.AuditTalkgroupCreate, models.AuditTargetTalkgroup, talkgroup.ID, nil, talkgroup)
 		c.JSON(http.StatusOK, gin.H{"message": "Talkgroup created"})
 	}
 }
+
+func userIDs(users []models.User) []uint {
+	ids := make([]uint, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
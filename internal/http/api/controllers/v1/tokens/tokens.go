@@ -0,0 +1,121 @@
+package tokens
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// GETTokens lists the logged in user's API tokens, including expired and revoked ones
+func GETTokens(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	userID, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	tokens := models.ListUserAPITokens(db, userID)
+	c.JSON(http.StatusOK, gin.H{"total": len(tokens), "tokens": tokens})
+}
+
+// POSTToken creates an API token for the logged in user. The token is only ever returned here.
+func POSTToken(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	userID, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	var json apimodels.APITokenPost
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTToken: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	if len(json.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+		return
+	}
+	user := models.FindUserWithRoles(db, userID)
+	for _, scope := range json.Scopes {
+		if !models.IsValidAPITokenScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope " + scope})
+			return
+		}
+		if scope == models.APITokenScopeAdmin && !user.HasPermission(models.APITokenScopeAdminPermission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only users who can manage users can create admin tokens"})
+			return
+		}
+	}
+	if json.ExpiresAt != nil && !json.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	plain, hash, hint, err := models.GenerateAPIToken()
+	if err != nil {
+		klog.Errorf("POSTToken: Error generating token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+	twoFactor, _ := sessions.Default(c).Get("two_factor").(bool)
+	token := models.APIToken{
+		UserID:    userID,
+		TwoFactor: twoFactor,
+		Name:      json.Name,
+		Hint:      hint,
+		Hash:      hash,
+		Scopes:    json.Scopes,
+		ExpiresAt: json.ExpiresAt,
+	}
+	err = db.Create(&token).Error
+	if err != nil {
+		klog.Errorf("POSTToken: Error creating token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating token"})
+		return
+	}
+	audit.Record(c, models.AuditAPITokenCreate, models.AuditTargetAPIToken, token.ID, nil, token)
+	c.JSON(http.StatusOK, gin.H{"message": "Token created", "token": plain, "api_token": token})
+}
+
+// DELETEToken revokes an API token. Users can revoke their own tokens, admins can revoke anyone's.
+func DELETEToken(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	userID, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+	token := models.FindAPITokenByID(db, uint(id))
+	if token.ID == 0 || (token.UserID != userID && !models.UserHasPermission(db, userID, models.PermissionUsersManage)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token does not exist"})
+		return
+	}
+	if token.RevokedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+		return
+	}
+	err = models.RevokeAPIToken(db, token.ID)
+	if err != nil {
+		klog.Errorf("DELETEToken: Error revoking token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking token"})
+		return
+	}
+	after := models.FindAPITokenByID(db, token.ID)
+	audit.Record(c, models.AuditAPITokenRevoke, models.AuditTargetAPIToken, token.ID, token, after)
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
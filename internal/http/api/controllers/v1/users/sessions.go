@@ -0,0 +1,108 @@
+package users
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	sessionStore "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// GETUserSessions lists where the logged in user is logged in
+func GETUserSessions(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(uint)
+	if !ok {
+		klog.Error("userID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	userSessions, err := sessionStore.List(c.Request.Context(), c.MustGet("Redis").(*redis.Client), userID, session.ID())
+	if err != nil {
+		klog.Errorf("GETUserSessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(userSessions), "sessions": userSessions})
+}
+
+// DELETEUserSession logs out one of the logged in user's sessions
+func DELETEUserSession(c *gin.Context) {
+	userID, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		klog.Error("userID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	found, err := sessionStore.Revoke(c.Request.Context(), c.MustGet("Redis").(*redis.Client), userID, c.Param("id"))
+	if err != nil {
+		klog.Errorf("DELETEUserSession: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking session"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session does not exist"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// DELETEUserSessions logs the logged in user out everywhere but here
+func DELETEUserSessions(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(uint)
+	if !ok {
+		klog.Error("userID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+	err := sessionStore.RevokeAll(c.Request.Context(), c.MustGet("Redis").(*redis.Client), userID, session.ID())
+	if err != nil {
+		klog.Errorf("DELETEUserSessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked"})
+}
+
+// DELETEUserSessionsForce logs a user out of every session
+func DELETEUserSessionsForce(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+	user := models.FindUserByID(db, uint(userID))
+	if user.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
+		return
+	}
+	fromUserID, _ := sessions.Default(c).Get("user_id").(uint)
+	if (user.Admin || user.ID == 999999) && fromUserID != 999999 && fromUserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the super admin can log out an admin"})
+		return
+	}
+	if !forceLogout(c, user.ID) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking sessions"})
+		return
+	}
+	audit.Record(c, models.AuditUserForceLogout, models.AuditTargetUser, user.ID, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out"})
+}
+
+// forceLogout revokes all of a user's sessions, for when their access changes under them
+func forceLogout(c *gin.Context, userID uint) bool {
+	err := sessionStore.RevokeAll(c.Request.Context(), c.MustGet("Redis").(*redis.Client), userID, "")
+	if err != nil {
+		klog.Errorf("Error logging out user %d: %v", userID, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,218 @@
+package users
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/USA-RedDragon/DMRHub/internal/totp"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// POSTUserTOTP starts two-factor enrollment for the logged in user. It isn't turned on until
+// POSTUserTOTPConfirm sees a code from the new secret.
+func POSTUserTOTP(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	user, ok := sessionUser(c, db)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		klog.Errorf("POSTUserTOTP: Error generating secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating secret"})
+		return
+	}
+	err = db.Model(&user).Update("totp_secret", secret).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "uri": totp.URI(models.CurrentAppSettings().Network(), user.Callsign, secret)})
+}
+
+// POSTUserTOTPConfirm turns on two-factor authentication once the user proves their app has the secret
+func POSTUserTOTPConfirm(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	var json apimodels.TOTPCode
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTUserTOTPConfirm: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	user, ok := sessionUser(c, db)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor enrollment first"})
+		return
+	}
+	step, valid := totp.Validate(user.TOTPSecret, json.Code, time.Now(), 0)
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+	codes, hashes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		klog.Errorf("POSTUserTOTPConfirm: Error generating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+	err = db.Model(&user).Select("totp_enabled", "totp_last_step", "totp_recovery_codes").Updates(models.User{
+		TOTPEnabled:       true,
+		TOTPLastStep:      step,
+		TOTPRecoveryCodes: hashes,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Proving the code just now counts as logging in with it
+	session := sessions.Default(c)
+	session.Set("two_factor", true)
+	err = session.Save()
+	if err != nil {
+		klog.Errorf("POSTUserTOTPConfirm: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// POSTUserTOTPRecoveryCodes replaces the logged in user's recovery codes
+func POSTUserTOTPRecoveryCodes(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	var json apimodels.TOTPCode
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("POSTUserTOTPRecoveryCodes: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	user, ok := sessionUser(c, db)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !models.VerifyTwoFactor(db, &user, json.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+	codes, hashes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		klog.Errorf("POSTUserTOTPRecoveryCodes: Error generating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+	err = db.Model(&user).Select("totp_recovery_codes").Updates(models.User{TOTPRecoveryCodes: hashes}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recovery codes replaced", "recovery_codes": codes})
+}
+
+// DELETEUserTOTP turns off two-factor authentication for the logged in user, given a current code
+func DELETEUserTOTP(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	var json apimodels.TOTPCode
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		klog.Errorf("DELETEUserTOTP: JSON data is invalid: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+	user, ok := sessionUser(c, db)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !models.VerifyTwoFactor(db, &user, json.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+	err = models.DisableTOTP(db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	session := sessions.Default(c)
+	session.Set("two_factor", false)
+	err = session.Save()
+	if err != nil {
+		klog.Errorf("DELETEUserTOTP: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// DELETEUserTOTPReset turns off two-factor authentication for a user who lost their app and recovery codes.
+// Only the super admin can reset another admin.
+func DELETEUserTOTPReset(c *gin.Context) {
+	db := c.MustGet("DB").(*gorm.DB)
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+	var user models.User
+	db.Find(&user, "id = ?", userID)
+	if user.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
+		return
+	}
+	fromUserID, _ := sessions.Default(c).Get("user_id").(uint)
+	if (user.Admin || user.ID == 999999) && fromUserID != 999999 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the super admin can reset an admin's two-factor authentication"})
+		return
+	}
+	if !user.TOTPEnabled && user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	err = models.DisableTOTP(db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	before := user
+	user.TOTPEnabled = false
+	audit.Record(c, models.AuditUserTwoFactorReset, models.AuditTargetUser, user.ID, before, user)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+func sessionUser(c *gin.Context, db *gorm.DB) (models.User, bool) {
+	userID, ok := sessions.Default(c).Get("user_id").(uint)
+	if !ok {
+		klog.Error("userID not found")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return models.User{}, false
+	}
+	var user models.User
+	db.Find(&user, "id = ?", userID)
+	if user.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
+		return models.User{}, false
+	}
+	return user, true
+}
@@ -1,21 +1,26 @@
 package users
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"crypto/sha1" //#nosec G505 -- False positive, we are not using this for crypto, just HIBP
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/email"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/apimodels"
+	"github.com/USA-RedDragon/DMRHub/internal/http/api/audit"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/utils"
 	"github.com/USA-RedDragon/DMRHub/internal/models"
 	"github.com/USA-RedDragon/DMRHub/internal/userdb"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	gopwned "github.com/mavjs/goPwned"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 	"k8s.io/klog/v2"
 )
@@ -37,6 +42,15 @@ func POSTUser(c *gin.Context) {
 		klog.Errorf("POSTUser: JSON data is invalid: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
 	} else {
+		mode := models.CurrentAppSettings().Registration()
+		if mode == models.RegistrationModeClosed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is closed"})
+			return
+		}
+		if mode == models.RegistrationModeInvite && strings.TrimSpace(json.InviteCode) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An invite code is required to register"})
+			return
+		}
 		if !userdb.IsValidUserID(json.DMRId) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "DMR ID is not valid"})
 			return
@@ -57,6 +71,16 @@ func POSTUser(c *gin.Context) {
 			return
 		}
 
+		json.Email = strings.TrimSpace(json.Email)
+		if json.Email == "" && email.Enabled() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+			return
+		}
+		if json.Email != "" && !apimodels.IsValidEmail(json.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email is not valid"})
+			return
+		}
+
 		if config.GetConfig().HIBPAPIKey != "" {
 			goPwned := gopwned.NewClient(nil, config.GetConfig().HIBPAPIKey)
 			h := sha1.New() //#nosec G401 -- False positive, we are not using this for crypto, just HIBP
@@ -113,21 +137,63 @@ func POSTUser(c *gin.Context) {
 		// argon2 the password
 		hashedPassword := utils.HashPassword(json.Password, config.GetConfig().PasswordSalt)
 
-		// store the user in the database with Active = false
+		// The ID and callsign have already checked out against the user database, and an
+		// invite code means an admin vouched for them, so only approval mode waits on an admin
 		user = models.User{
 			Username: json.Username,
 			Password: hashedPassword,
 			Callsign: strings.ToUpper(json.Callsign),
 			ID:       json.DMRId,
-			Approved: false,
+			Approved: mode == models.RegistrationModeAutoApprove || mode == models.RegistrationModeInvite,
 			Admin:    false,
+			Email:    json.Email,
 		}
-		db.Create(&user)
-		if db.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if mode == models.RegistrationModeInvite {
+				err := models.RedeemInviteCode(tx, json.InviteCode, time.Now())
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Create(&user).Error
+		})
+		if errors.Is(err, models.ErrInviteCodeInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invite code is invalid, used up or expired"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+		message := "User created, please wait for admin approval"
+		if user.Approved {
+			message = "User created, you can now log in"
+		}
+		if email.Enabled() {
+			// Admins hear about unapproved users once their email address checks out
+			err = email.SendVerification(db, user)
+			if err != nil {
+				klog.Errorf("POSTUser: Error sending verification email: %v", err)
+			}
+			message = "User created, please verify your email address and wait for admin approval"
+			if user.Approved {
+				message = "User created, please verify your email address"
+			}
+		}
+		if user.Approved {
+			c.JSON(http.StatusOK, gin.H{"message": message})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "User created, please wait for admin approval"})
+		// A private call to the code from the user's radio approves them without waiting on an admin
+		response := gin.H{"message": message}
+		code, err := models.CreateRadioVerification(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+		if err != nil {
+			klog.Errorf("POSTUser: Error creating radio verification code: %v", err)
+		} else {
+			response["radio_verification_id"] = code
+			response["radio_verification_expires_in"] = int(models.RadioVerificationTTL.Seconds())
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -158,12 +224,16 @@ func POSTUserDemote(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
 		return
 	}
+	before := user
 	user.Admin = false
 	db.Save(&user)
 	if db.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 		return
 	}
+	models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+	forceLogout(c, user.ID)
+	audit.Record(c, models.AuditUserDemote, models.AuditTargetUser, user.ID, before, user)
 	c.JSON(http.StatusOK, gin.H{"message": "User demoted"})
 }
 
@@ -192,12 +262,15 @@ func POSTUserPromote(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot promote an unapproved user"})
 		return
 	}
+	before := user
 	user.Admin = true
 	db.Save(&user)
 	if db.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 		return
 	}
+	models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+	audit.Record(c, models.AuditUserPromote, models.AuditTargetUser, user.ID, before, user)
 	c.JSON(http.StatusOK, gin.H{"message": "User promoted"})
 }
 
@@ -229,12 +302,15 @@ func POSTUserUnsuspend(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
 		return
 	}
+	before := user
 	user.Suspended = false
 	db.Save(&user)
 	if db.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 		return
 	}
+	models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+	audit.Record(c, models.AuditUserUnsuspend, models.AuditTargetUser, user.ID, before, user)
 	c.JSON(http.StatusOK, gin.H{"message": "User unsuspended"})
 }
 
@@ -266,12 +342,16 @@ func POSTUserApprove(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
 		return
 	}
+	before := user
 	user.Approved = true
 	db.Save(&user)
 	if db.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 		return
 	}
+	models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+	audit.Record(c, models.AuditUserApprove, models.AuditTargetUser, user.ID, before, user)
+	email.NotifyUser(user, email.Approved)
 	c.JSON(http.StatusOK, gin.H{"message": "User approved"})
 }
 
@@ -286,6 +366,7 @@ func GETUser(c *gin.Context) {
 	}
 	if models.UserIDExists(db, uint(userID)) {
 		user := models.FindUserByID(db, uint(userID))
+		models.LoadUserRoles(db, &user)
 		c.JSON(http.StatusOK, user)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
@@ -340,6 +421,11 @@ func PATCHUser(c *gin.Context) {
 		klog.Errorf("PATCHUser: JSON data is invalid: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
 	} else {
+		// Credentials can only be changed from a logged in session
+		if _, ok := c.Get("APIToken"); ok && (json.Password != "" || json.Email != "") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API tokens cannot change passwords or email addresses"})
+			return
+		}
 		// Update callsign, username, and/or password
 		var user models.User
 		db.Find(&user, "id = ?", id)
@@ -351,6 +437,7 @@ func PATCHUser(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
 			return
 		}
+		before := user
 		if json.Callsign != "" {
 			matchesCallsign := false
 			// Check DMR ID is in the database
@@ -386,11 +473,30 @@ func PATCHUser(c *gin.Context) {
 			user.Password = utils.HashPassword(json.Password, config.GetConfig().PasswordSalt)
 		}
 
+		emailChanged := false
+		if json.Email != "" && !strings.EqualFold(json.Email, user.Email) {
+			if !apimodels.IsValidEmail(json.Email) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Email is not valid"})
+				return
+			}
+			user.Email = json.Email
+			user.EmailVerified = false
+			emailChanged = true
+		}
+
 		db.Save(&user)
 		if db.Error != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 			return
 		}
+		models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+		audit.Record(c, models.AuditUserUpdate, models.AuditTargetUser, user.ID, before, user)
+		if emailChanged {
+			err = email.SendVerification(db, user)
+			if err != nil {
+				klog.Errorf("PATCHUser: Error sending verification email: %v", err)
+			}
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "User updated"})
 	}
 }
@@ -402,11 +508,15 @@ func DELETEUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
+	before := models.FindUserByID(db, uint(idUint64))
 	models.DeleteUser(db, uint(idUint64))
 	if db.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 		return
 	}
+	models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), uint(idUint64))
+	forceLogout(c, uint(idUint64))
+	audit.Record(c, models.AuditUserDelete, models.AuditTargetUser, uint(idUint64), before, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 }
 
@@ -449,12 +559,17 @@ func POSTUserSuspend(c *gin.Context) {
 		return
 	}
 
+	before := user
 	user.Suspended = true
 	db.Save(&user)
 	if db.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": db.Error.Error()})
 		return
 	}
+	models.InvalidateUserCache(c.Request.Context(), c.MustGet("Redis").(*redis.Client), user.ID)
+	forceLogout(c, user.ID)
+	audit.Record(c, models.AuditUserSuspend, models.AuditTargetUser, user.ID, before, user)
+	email.NotifyUser(user, email.Suspended)
 	c.JSON(http.StatusOK, gin.H{"message": "User suspended"})
 }
 
@@ -478,5 +593,12 @@ func GETUserSelf(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	models.LoadUserRoles(db, &user)
+	// Only the user themselves gets to see their email address
+	c.JSON(http.StatusOK, struct {
+		models.User
+		Email         string   `json:"email"`
+		EmailVerified bool     `json:"email_verified"`
+		Permissions   []string `json:"permissions"`
+	}{user, user.Email, user.EmailVerified, user.Permissions()})
 }
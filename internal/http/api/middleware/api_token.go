@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// APITokenProvider lets a personal API token sent as a bearer token stand in for a login.
+// The token's user is put in the request's session, which is never saved, so the Require*
+// handlers and controllers treat the request like any other from that user.
+func APITokenProvider() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			c.Next()
+			return
+		}
+		db := c.MustGet("DB").(*gorm.DB)
+		now := time.Now()
+		token, ok := models.FindAPIToken(db, strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+		if !ok || !token.Active(now) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			return
+		}
+		span := trace.SpanFromContext(c.Request.Context())
+		if span.IsRecording() {
+			span.SetAttributes(
+				attribute.Int("api_token.id", int(token.ID)),
+			)
+		}
+		if !token.Allows(c.Request.Method, c.FullPath()) {
+			klog.Errorf("API token %d does not allow %s %s", token.ID, c.Request.Method, c.FullPath())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API token does not have the required scope"})
+			return
+		}
+		models.TouchAPIToken(db, token, now, c.ClientIP())
+
+		session := sessions.Default(c)
+		session.Set("user_id", token.UserID)
+		session.Set("two_factor", token.TwoFactor)
+		c.Set("APIToken", token)
+		c.Next()
+	}
+}
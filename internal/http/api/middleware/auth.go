@@ -14,13 +14,20 @@ import (
 	"k8s.io/klog/v2"
 )
 
-func RequireAdminOrTGOwner() gin.HandlerFunc {
+// Access lets a user through a permission check on a route about something they're responsible for,
+// like their own account or a repeater they own, without holding the permission network wide.
+type Access func(c *gin.Context, db *gorm.DB, user models.User) bool
+
+// RequirePermission is the authorization check for every route that needs a login. The user needs
+// the permission, or to pass one of the access checks for the resource the route is about.
+// Permissions beyond logging in count as privileged and are subject to the two-factor requirement.
+func RequirePermission(permission string, access ...Access) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
-		userID := session.Get("user_id")
-		if userID == nil {
+		userID, ok := session.Get("user_id").(uint)
+		if !ok {
 			if config.GetConfig().Debug {
-				klog.Error("RequireAdminOrTGOwner: Failed to get user_id from session")
+				klog.Errorf("RequirePermission(%s): Failed to get user_id from session", permission)
 			}
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 			return
@@ -29,287 +36,120 @@ func RequireAdminOrTGOwner() gin.HandlerFunc {
 		span := trace.SpanFromContext(ctx)
 		if span.IsRecording() {
 			span.SetAttributes(
-				attribute.String("http.auth", "RequireAdminOrTGOwner"),
-				attribute.Int("user.id", int(userID.(uint))),
+				attribute.String("http.auth", "RequirePermission"),
+				attribute.String("http.auth.permission", permission),
+				attribute.Int("user.id", int(userID)),
 			)
 		}
 
-		valid := false
-		// Open up the DB and check if the user is an admin
 		db := c.MustGet("DB").(*gorm.DB).WithContext(ctx)
-		var user models.User
-		db.Find(&user, "id = ?", userID.(uint))
+		user := models.FindUserWithRoles(db, userID)
 		if span.IsRecording() {
 			span.SetAttributes(
 				attribute.Bool("user.admin", user.Admin),
 			)
 		}
-		if user.Admin && user.Approved && !user.Suspended {
-			valid = true
-		}
-
-		// Check if the user is the owner of any talkgroups
-		talkgroups, err := models.FindTalkgroupsByOwnerID(db, userID.(uint))
-		if err != nil {
-			klog.Error(err)
+		if !user.Approved || user.Suspended {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 			return
 		}
-		if len(talkgroups) > 0 && user.Approved && !user.Suspended {
-			valid = true
-		}
-
-		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-		}
-	}
-}
 
-func RequireAdmin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		userID := session.Get("user_id")
-		if userID == nil {
-			if config.GetConfig().Debug {
-				klog.Error("RequireAdmin: Failed to get user_id from session")
+		if user.HasPermission(permission) {
+			if permission != models.PermissionLogin && !twoFactorSatisfied(c) {
+				// The user may still be responsible for this particular resource
+				for _, check := range access {
+					if check(c, db, user) {
+						return
+					}
+				}
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication required"})
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 			return
 		}
-		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.String("http.auth", "RequireAdmin"),
-				attribute.Int("user.id", int(userID.(uint))),
-			)
-		}
-
-		valid := false
-		// Open up the DB and check if the user is an admin
-		db := c.MustGet("DB").(*gorm.DB).WithContext(ctx)
-		var user models.User
-		db.Find(&user, "id = ?", userID.(uint))
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.Bool("user.admin", user.Admin),
-			)
-		}
-		if user.Admin && user.Approved && !user.Suspended {
-			valid = true
-		}
-
-		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-		}
-	}
-}
-
-func RequireSuperAdmin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ctx := c.Request.Context()
-		session := sessions.Default(c)
-		userID := session.Get("user_id")
-		if userID == nil {
-			if config.GetConfig().Debug {
-				klog.Error("RequireSuperAdmin: Failed to get user_id from session")
+		for _, check := range access {
+			if check(c, db, user) {
+				return
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-			return
-		}
-		span := trace.SpanFromContext(ctx)
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.String("http.auth", "RequireAdmin"),
-				attribute.Int("user.id", int(userID.(uint))),
-			)
-		}
-		if userID.(uint) != 999999 {
-			klog.Error("User is not a super admin")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 	}
 }
 
+// RequireLogin lets in any approved user who isn't suspended
 func RequireLogin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		userID := session.Get("user_id")
-		if userID == nil {
-			if config.GetConfig().Debug {
-				klog.Error("RequireLogin: Failed to get user_id from session")
-			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-			return
-		}
-		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.String("http.auth", "RequireLogin"),
-				attribute.Int("user.id", int(userID.(uint))),
-			)
-		}
-
-		valid := false
-		// Open up the DB and check if the user exists
-		db := c.MustGet("DB").(*gorm.DB).WithContext(ctx)
-		var user models.User
-		db.Find(&user, "id = ?", userID.(uint))
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.Bool("user.admin", user.Admin),
-			)
-		}
-		if user.Approved && !user.Suspended {
-			valid = true
-		}
-
-		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-		}
-	}
+	return RequirePermission(models.PermissionLogin)
 }
 
-func RequireRepeaterOwnerOrAdmin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		id := c.Param("id")
-		userID := session.Get("user_id")
-		if userID == nil {
-			if config.GetConfig().Debug {
-				klog.Error("RequireRepeaterOwnerOrAdmin: Failed to get user_id from session")
-			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-			return
-		}
-		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.String("http.auth", "RequireRepeaterOwnerOrAdmin"),
-				attribute.Int("user.id", int(userID.(uint))),
-			)
-		}
+// Self is the user the route's :id is about
+func Self(c *gin.Context, db *gorm.DB, user models.User) bool {
+	return c.Param("id") == fmt.Sprintf("%d", user.ID)
+}
 
-		valid := false
-		db := c.MustGet("DB").(*gorm.DB).WithContext(ctx)
-		// Open up the DB and check if the user is an admin or if they own repeater with id = id
-		var user models.User
-		db.Find(&user, "id = ?", userID.(uint))
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.Bool("user.admin", user.Admin),
-			)
-		}
-		if user.Approved && !user.Suspended && user.Admin {
-			valid = true
-		} else {
-			var repeater models.Repeater
-			db.Find(&repeater, "radio_id = ?", id)
-			if repeater.OwnerID == user.ID && !user.Suspended && user.Approved {
-				valid = true
-			}
-		}
+// RepeaterOwner owns the repeater with the route's :id
+func RepeaterOwner(c *gin.Context, db *gorm.DB, user models.User) bool {
+	var repeater models.Repeater
+	db.Find(&repeater, "radio_id = ?", c.Param("id"))
+	return repeater.RadioID != 0 && repeater.OwnerID == user.ID
+}
 
-		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+// TalkgroupOwner is an admin of the talkgroup with the route's :id
+func TalkgroupOwner(c *gin.Context, db *gorm.DB, user models.User) bool {
+	var talkgroup models.Talkgroup
+	db.Preload("Admins").Find(&talkgroup, "id = ?", c.Param("id"))
+	for _, admin := range talkgroup.Admins {
+		if admin.ID == user.ID {
+			return true
 		}
 	}
+	return false
 }
 
-func RequireTalkgroupOwnerOrAdmin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		id := c.Param("id")
-		userID := session.Get("user_id")
-		if userID == nil {
-			if config.GetConfig().Debug {
-				klog.Error("RequireTalkgroupOwnerOrAdmin: Failed to get user_id from session")
-			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-			return
-		}
-		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.String("http.auth", "RequireTalkgroupOwnerOrAdmin"),
-				attribute.Int("user.id", int(userID.(uint))),
-			)
-		}
-
-		valid := false
-		db := c.MustGet("DB").(*gorm.DB).WithContext(ctx)
-		// Open up the DB and check if the user is an admin or if they own talkgroup with id = id
-		var user models.User
-		db.Find(&user, "id = ?", userID.(uint))
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.Bool("user.admin", user.Admin),
-			)
-		}
-		if user.Admin && !user.Suspended && user.Approved {
-			valid = true
-		} else {
-			var talkgroup models.Talkgroup
-			db.Preload("Admins").Find(&talkgroup, "id = ?", id)
-			for _, admin := range talkgroup.Admins {
-				if admin.ID == user.ID && !user.Suspended && user.Approved {
-					valid = true
-					break
-				}
-			}
-		}
-
-		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-		}
+// AnyTalkgroupOwner is an admin of at least one talkgroup
+func AnyTalkgroupOwner(c *gin.Context, db *gorm.DB, user models.User) bool {
+	talkgroups, err := models.FindTalkgroupsByOwnerID(db, user.ID)
+	if err != nil {
+		klog.Error(err)
+		return false
 	}
+	return len(talkgroups) > 0
 }
 
-func RequireSelfOrAdmin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		id := c.Param("id")
-		userID := session.Get("user_id")
-		if userID == nil {
-			if config.GetConfig().Debug {
-				klog.Error("RequireSelfOrAdmin: Failed to get user_id from session")
-			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-			return
-		}
-		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.String("http.auth", "RequireSelfOrAdmin"),
-				attribute.Int("user.id", int(userID.(uint))),
-			)
-		}
+// TalkgroupNetControl may run nets on the talkgroup with the route's :id
+func TalkgroupNetControl(c *gin.Context, db *gorm.DB, user models.User) bool {
+	return isTalkgroupNetControl(db, user, c.Param("id"))
+}
 
-		valid := false
+// NetControl may run the net with the route's :id
+func NetControl(c *gin.Context, db *gorm.DB, user models.User) bool {
+	var net models.Net
+	db.Find(&net, "id = ?", c.Param("id"))
+	return net.ID != 0 && isTalkgroupNetControl(db, user, fmt.Sprintf("%d", net.TalkgroupID))
+}
 
-		db := c.MustGet("DB").(*gorm.DB).WithContext(ctx)
-		// Open up the DB and check if the user is an admin or if their ID matches id
-		var user models.User
-		db.Find(&user, "id = ?", userID.(uint))
-		if span.IsRecording() {
-			span.SetAttributes(
-				attribute.Bool("user.admin", user.Admin),
-			)
+// isTalkgroupNetControl checks if the user may run nets on the talkgroup,
+// either as a talkgroup admin or a net control operator
+func isTalkgroupNetControl(db *gorm.DB, user models.User, talkgroupID string) bool {
+	var talkgroup models.Talkgroup
+	db.Preload("Admins").Preload("NCOs").Find(&talkgroup, "id = ?", talkgroupID)
+	for _, admin := range talkgroup.Admins {
+		if admin.ID == user.ID {
+			return true
 		}
-		if user.Admin && !user.Suspended && user.Approved {
-			valid = true
-		} else {
-			if id == fmt.Sprintf("%d", user.ID) && !user.Suspended && user.Approved {
-				valid = true
-			}
+	}
+	for _, nco := range talkgroup.NCOs {
+		if nco.ID == user.ID {
+			return true
 		}
+	}
+	return false
+}
 
-		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-		}
+// twoFactorSatisfied reports whether the session may use privileged permissions. When the network requires
+// two-factor authentication for admins, that takes a session that logged in with a second factor.
+func twoFactorSatisfied(c *gin.Context) bool {
+	if !models.CurrentAppSettings().RequireAdminTwoFactor {
+		return true
 	}
+	verified, _ := sessions.Default(c).Get("two_factor").(bool)
+	return verified
 }
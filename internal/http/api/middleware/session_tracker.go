@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"time"
+
+	sessionStore "github.com/USA-RedDragon/DMRHub/internal/http/sessions"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// SessionTracker keeps track of logged in sessions so users can see and revoke them.
+// It looks at the session after the handler runs, so logins and logouts are picked up.
+func SessionTracker(redisClient *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		before, _ := session.Get("user_id").(uint)
+		c.Next()
+
+		// API token requests borrow the session without saving it
+		if _, ok := c.Get("APIToken"); ok {
+			return
+		}
+		sessionID := session.ID()
+		if sessionID == "" {
+			return
+		}
+		userID, _ := session.Get("user_id").(uint)
+		if before != 0 && userID != before {
+			err := sessionStore.Forget(c.Request.Context(), redisClient, before, sessionID)
+			if err != nil {
+				klog.Errorf("Error forgetting session for user %d: %v", before, err)
+			}
+		}
+		if userID != 0 {
+			err := sessionStore.Track(c.Request.Context(), redisClient, userID, sessionID, c.ClientIP(), c.Request.UserAgent(), time.Now())
+			if err != nil {
+				klog.Errorf("Error tracking session for user %d: %v", userID, err)
+			}
+		}
+	}
+}
@@ -2,12 +2,21 @@ package api
 
 import (
 	v1Controllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1"
+	v1AnnouncementsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/announcements"
+	v1AuditControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/audit"
 	v1AuthControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/auth"
+	v1BridgesControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/bridges"
+	v1InvitesControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/invites"
 	v1LastheardControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/lastheard"
+	v1NetsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/nets"
 	v1RepeatersControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/repeaters"
+	v1RolesControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/roles"
+	v1SettingsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/settings"
 	v1TalkgroupsControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/talkgroups"
+	v1TokensControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/tokens"
 	v1UsersControllers "github.com/USA-RedDragon/DMRHub/internal/http/api/controllers/v1/users"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/middleware"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,67 +24,151 @@ import (
 func ApplyRoutes(router *gin.Engine, ratelimit gin.HandlerFunc) {
 	apiV1 := router.Group("/api/v1")
 	apiV1.Use(ratelimit)
+	apiV1.Use(middleware.APITokenProvider())
 	v1(apiV1)
 }
 
 func v1(group *gin.RouterGroup) {
 	v1Auth := group.Group("/auth")
 	v1Auth.POST("/login", v1AuthControllers.POSTLogin)
+	v1Auth.POST("/login/totp", v1AuthControllers.POSTLoginTOTP)
 	v1Auth.GET("/logout", v1AuthControllers.GETLogout)
+	v1Auth.GET("/verify-email", v1AuthControllers.GETVerifyEmail)
+	v1Auth.POST("/password-reset", v1AuthControllers.POSTPasswordReset)
+	v1Auth.POST("/password-reset/confirm", v1AuthControllers.POSTPasswordResetConfirm)
+	v1Auth.POST("/radio-verification", v1AuthControllers.POSTRadioVerification)
+	v1Auth.GET("/oidc/login", v1AuthControllers.GETOIDCLogin)
+	v1Auth.GET("/oidc/callback", v1AuthControllers.GETOIDCCallback)
 
 	v1Repeaters := group.Group("/repeaters")
 	// Paginated
-	v1Repeaters.GET("", middleware.RequireAdmin(), v1RepeatersControllers.GETRepeaters)
+	v1Repeaters.GET("", middleware.RequirePermission(models.PermissionRepeatersRead), v1RepeatersControllers.GETRepeaters)
 	// Paginated
-	v1Repeaters.GET("/my", middleware.RequireLogin(), v1RepeatersControllers.GETMyRepeaters)
-	v1Repeaters.POST("", middleware.RequireLogin(), v1RepeatersControllers.POSTRepeater)
-	v1Repeaters.POST("/:id/link/:type/:slot/:target", middleware.RequireRepeaterOwnerOrAdmin(), v1RepeatersControllers.POSTRepeaterLink)
-	v1Repeaters.POST("/:id/unlink/:type/:slot/:target", middleware.RequireRepeaterOwnerOrAdmin(), v1RepeatersControllers.POSTRepeaterUnlink)
-	v1Repeaters.POST("/:id/talkgroups", middleware.RequireRepeaterOwnerOrAdmin(), v1RepeatersControllers.POSTRepeaterTalkgroups)
-	v1Repeaters.GET("/:id", middleware.RequireLogin(), v1RepeatersControllers.GETRepeater)
-	v1Repeaters.DELETE("/:id", middleware.RequireRepeaterOwnerOrAdmin(), v1RepeatersControllers.DELETERepeater)
+	v1Repeaters.GET("/my", middleware.RequirePermission(models.PermissionLogin), v1RepeatersControllers.GETMyRepeaters)
+	v1Repeaters.GET("/connected", v1RepeatersControllers.GETConnectedRepeaters)
+	v1Repeaters.POST("", middleware.RequirePermission(models.PermissionLogin), v1RepeatersControllers.POSTRepeater)
+	v1Repeaters.POST("/:id/link/:type/:slot/:target", middleware.RequirePermission(models.PermissionRepeatersManage, middleware.RepeaterOwner), v1RepeatersControllers.POSTRepeaterLink)
+	v1Repeaters.POST("/:id/unlink/:type/:slot/:target", middleware.RequirePermission(models.PermissionRepeatersManage, middleware.RepeaterOwner), v1RepeatersControllers.POSTRepeaterUnlink)
+	v1Repeaters.POST("/:id/talkgroups", middleware.RequirePermission(models.PermissionRepeatersManage, middleware.RepeaterOwner), v1RepeatersControllers.POSTRepeaterTalkgroups)
+	v1Repeaters.GET("/:id/rewrites", middleware.RequirePermission(models.PermissionRepeatersRead, middleware.RepeaterOwner), v1RepeatersControllers.GETRepeaterRewrites)
+	v1Repeaters.POST("/:id/rewrites", middleware.RequirePermission(models.PermissionRepeatersManage, middleware.RepeaterOwner), v1RepeatersControllers.POSTRepeaterRewrite)
+	v1Repeaters.DELETE("/:id/rewrites/:rewrite", middleware.RequirePermission(models.PermissionRepeatersManage, middleware.RepeaterOwner), v1RepeatersControllers.DELETERepeaterRewrite)
+	v1Repeaters.GET("/:id/quality", middleware.RequirePermission(models.PermissionRepeatersRead, middleware.RepeaterOwner), v1RepeatersControllers.GETRepeaterQuality)
+	v1Repeaters.GET("/:id/connections", middleware.RequirePermission(models.PermissionRepeatersRead, middleware.RepeaterOwner), v1RepeatersControllers.GETRepeaterConnections)
+	v1Repeaters.GET("/:id", middleware.RequirePermission(models.PermissionLogin), v1RepeatersControllers.GETRepeater)
+	v1Repeaters.PATCH("/:id", middleware.RequirePermission(models.PermissionRepeatersManage, middleware.RepeaterOwner), v1RepeatersControllers.PATCHRepeater)
+	v1Repeaters.DELETE("/:id", middleware.RequirePermission(models.PermissionRepeatersManage, middleware.RepeaterOwner), v1RepeatersControllers.DELETERepeater)
 
 	v1Talkgroups := group.Group("/talkgroups")
 	// Paginated
-	v1Talkgroups.GET("", middleware.RequireLogin(), v1TalkgroupsControllers.GETTalkgroups)
+	v1Talkgroups.GET("", middleware.RequirePermission(models.PermissionLogin), v1TalkgroupsControllers.GETTalkgroups)
 	// Paginated
-	v1Talkgroups.GET("/my", middleware.RequireLogin(), v1TalkgroupsControllers.GETMyTalkgroups)
-	v1Talkgroups.POST("", middleware.RequireAdmin(), v1TalkgroupsControllers.POSTTalkgroup)
-	v1Talkgroups.POST("/:id/admins", middleware.RequireAdmin(), v1TalkgroupsControllers.POSTTalkgroupAdmins)
-	v1Talkgroups.POST("/:id/ncos", middleware.RequireTalkgroupOwnerOrAdmin(), v1TalkgroupsControllers.POSTTalkgroupNCOs)
-	v1Talkgroups.GET("/:id", middleware.RequireLogin(), v1TalkgroupsControllers.GETTalkgroup)
-	v1Talkgroups.PATCH("/:id", middleware.RequireTalkgroupOwnerOrAdmin(), v1TalkgroupsControllers.PATCHTalkgroup)
-	v1Talkgroups.DELETE("/:id", middleware.RequireAdmin(), v1TalkgroupsControllers.DELETETalkgroup)
+	v1Talkgroups.GET("/my", middleware.RequirePermission(models.PermissionLogin), v1TalkgroupsControllers.GETMyTalkgroups)
+	v1Talkgroups.POST("", middleware.RequirePermission(models.PermissionTalkgroupsManage), v1TalkgroupsControllers.POSTTalkgroup)
+	v1Talkgroups.POST("/:id/admins", middleware.RequirePermission(models.PermissionTalkgroupsManage), v1TalkgroupsControllers.POSTTalkgroupAdmins)
+	v1Talkgroups.POST("/:id/ncos", middleware.RequirePermission(models.PermissionTalkgroupsManage, middleware.TalkgroupOwner), v1TalkgroupsControllers.POSTTalkgroupNCOs)
+	v1Talkgroups.GET("/:id", middleware.RequirePermission(models.PermissionLogin), v1TalkgroupsControllers.GETTalkgroup)
+	v1Talkgroups.PATCH("/:id", middleware.RequirePermission(models.PermissionTalkgroupsManage, middleware.TalkgroupOwner), v1TalkgroupsControllers.PATCHTalkgroup)
+	v1Talkgroups.DELETE("/:id", middleware.RequirePermission(models.PermissionTalkgroupsManage), v1TalkgroupsControllers.DELETETalkgroup)
+	v1Talkgroups.POST("/:id/net/start", middleware.RequirePermission(models.PermissionNetsManage, middleware.TalkgroupNetControl), v1NetsControllers.POSTNetStart)
+
+	v1Bridges := group.Group("/bridges")
+	// Paginated
+	v1Bridges.GET("", middleware.RequirePermission(models.PermissionBridgesManage), v1BridgesControllers.GETBridges)
+	v1Bridges.POST("", middleware.RequirePermission(models.PermissionBridgesManage), v1BridgesControllers.POSTBridge)
+	v1Bridges.GET("/:id", middleware.RequirePermission(models.PermissionBridgesManage), v1BridgesControllers.GETBridge)
+	v1Bridges.PATCH("/:id", middleware.RequirePermission(models.PermissionBridgesManage), v1BridgesControllers.PATCHBridge)
+	v1Bridges.DELETE("/:id", middleware.RequirePermission(models.PermissionBridgesManage), v1BridgesControllers.DELETEBridge)
+
+	v1Announcements := group.Group("/announcements")
+	// Paginated
+	v1Announcements.GET("", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.GETAnnouncements)
+	v1Announcements.POST("", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.POSTAnnouncement)
+	v1Announcements.GET("/:id", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.GETAnnouncement)
+	v1Announcements.DELETE("/:id", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.DELETEAnnouncement)
+	v1Announcements.GET("/:id/audio", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.GETAnnouncementAudio)
+	v1Announcements.PUT("/:id/audio", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.PUTAnnouncementAudio)
+	v1Announcements.POST("/:id/record", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.POSTAnnouncementRecord)
+	v1Announcements.POST("/:id/play", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.POSTAnnouncementPlay)
+	v1Announcements.POST("/:id/schedules", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.POSTAnnouncementSchedule)
+	v1Announcements.DELETE("/:id/schedules/:schedule", middleware.RequirePermission(models.PermissionAnnouncementManage), v1AnnouncementsControllers.DELETEAnnouncementSchedule)
+
+	v1Nets := group.Group("/nets")
+	// Paginated
+	v1Nets.GET("", middleware.RequirePermission(models.PermissionLogin), v1NetsControllers.GETNets)
+	v1Nets.GET("/:id", middleware.RequirePermission(models.PermissionLogin), v1NetsControllers.GETNet)
+	v1Nets.POST("/:id/stop", middleware.RequirePermission(models.PermissionNetsManage, middleware.NetControl), v1NetsControllers.POSTNetStop)
+	// Paginated
+	v1Nets.GET("/:id/checkins", middleware.RequirePermission(models.PermissionLogin), v1NetsControllers.GETNetCheckIns)
+	v1Nets.PATCH("/:id/checkins/:checkin", middleware.RequirePermission(models.PermissionNetsManage, middleware.NetControl), v1NetsControllers.PATCHNetCheckIn)
+	v1Nets.DELETE("/:id/checkins/:checkin", middleware.RequirePermission(models.PermissionNetsManage, middleware.NetControl), v1NetsControllers.DELETENetCheckIn)
+	v1Nets.GET("/:id/export", middleware.RequirePermission(models.PermissionLogin), v1NetsControllers.GETNetExport)
 
 	v1Users := group.Group("/users")
 	// Paginated
-	v1Users.GET("", middleware.RequireAdminOrTGOwner(), v1UsersControllers.GETUsers)
+	v1Users.GET("", middleware.RequirePermission(models.PermissionUsersRead, middleware.AnyTalkgroupOwner), v1UsersControllers.GETUsers)
 	v1Users.POST("", v1UsersControllers.POSTUser)
-	v1Users.GET("/me", middleware.RequireLogin(), v1UsersControllers.GETUserSelf)
+	v1Users.GET("/me", middleware.RequirePermission(models.PermissionLogin), v1UsersControllers.GETUserSelf)
+	v1Users.POST("/me/totp", middleware.RequirePermission(models.PermissionLogin), v1UsersControllers.POSTUserTOTP)
+	v1Users.POST("/me/totp/confirm", middleware.RequirePermission(models.PermissionLogin), v1UsersControllers.POSTUserTOTPConfirm)
+	v1Users.POST("/me/totp/recovery-codes", middleware.RequirePermission(models.PermissionLogin), v1UsersControllers.POSTUserTOTPRecoveryCodes)
+	v1Users.DELETE("/me/totp", middleware.RequirePermission(models.PermissionLogin), v1UsersControllers.DELETEUserTOTP)
+	v1Users.GET("/me/sessions", middleware.RequirePermission(models.PermissionLogin), v1UsersControllers.GETUserSessions)
+	v1Users.DELETE("/me/sessions", middleware.RequirePermission(models.PermissionLogin), v1UsersControllers.DELETEUserSessions)
+	v1Users.DELETE("/me/sessions/:id", middleware.RequirePermission(models.PermissionLogin), v1UsersControllers.DELETEUserSession)
 	// Paginated
-	v1Users.GET("/admins", middleware.RequireSuperAdmin(), v1UsersControllers.GETUserAdmins)
+	v1Users.GET("/admins", middleware.RequirePermission(models.PermissionUsersAdmin), v1UsersControllers.GETUserAdmins)
 	// Paginated
-	v1Users.GET("/suspended", middleware.RequireAdmin(), v1UsersControllers.GETUserSuspended)
-	v1Users.GET("/unapproved", middleware.RequireAdmin(), v1UsersControllers.GETUserUnapproved)
-	v1Users.POST("/promote/:id", middleware.RequireSuperAdmin(), v1UsersControllers.POSTUserPromote)
-	v1Users.POST("/demote/:id", middleware.RequireSuperAdmin(), v1UsersControllers.POSTUserDemote)
-	v1Users.POST("/approve/:id", middleware.RequireAdmin(), v1UsersControllers.POSTUserApprove)
-	v1Users.POST("/unsuspend/:id", middleware.RequireAdmin(), v1UsersControllers.POSTUserUnsuspend)
-	v1Users.POST("/suspend/:id", middleware.RequireAdmin(), v1UsersControllers.POSTUserSuspend)
-	v1Users.GET("/:id", middleware.RequireSelfOrAdmin(), v1UsersControllers.GETUser)
-	v1Users.PATCH("/:id", middleware.RequireSelfOrAdmin(), v1UsersControllers.PATCHUser)
-	v1Users.DELETE("/:id", middleware.RequireSuperAdmin(), v1UsersControllers.DELETEUser)
+	v1Users.GET("/suspended", middleware.RequirePermission(models.PermissionUsersSuspend), v1UsersControllers.GETUserSuspended)
+	v1Users.GET("/unapproved", middleware.RequirePermission(models.PermissionUsersApprove), v1UsersControllers.GETUserUnapproved)
+	v1Users.POST("/promote/:id", middleware.RequirePermission(models.PermissionUsersAdmin), v1UsersControllers.POSTUserPromote)
+	v1Users.POST("/demote/:id", middleware.RequirePermission(models.PermissionUsersAdmin), v1UsersControllers.POSTUserDemote)
+	v1Users.POST("/approve/:id", middleware.RequirePermission(models.PermissionUsersApprove), v1UsersControllers.POSTUserApprove)
+	v1Users.POST("/unsuspend/:id", middleware.RequirePermission(models.PermissionUsersSuspend), v1UsersControllers.POSTUserUnsuspend)
+	v1Users.POST("/suspend/:id", middleware.RequirePermission(models.PermissionUsersSuspend), v1UsersControllers.POSTUserSuspend)
+	v1Users.GET("/:id", middleware.RequirePermission(models.PermissionUsersRead, middleware.Self), v1UsersControllers.GETUser)
+	v1Users.PATCH("/:id", middleware.RequirePermission(models.PermissionUsersManage, middleware.Self), v1UsersControllers.PATCHUser)
+	v1Users.DELETE("/:id", middleware.RequirePermission(models.PermissionUsersDelete), v1UsersControllers.DELETEUser)
+	v1Users.DELETE("/:id/totp", middleware.RequirePermission(models.PermissionUsersManage), v1UsersControllers.DELETEUserTOTPReset)
+	v1Users.DELETE("/:id/sessions", middleware.RequirePermission(models.PermissionUsersManage), v1UsersControllers.DELETEUserSessionsForce)
+	v1Users.POST("/:id/roles", middleware.RequirePermission(models.PermissionRolesManage), v1RolesControllers.POSTUserRoles)
 
 	v1Lastheard := group.Group("/lastheard")
 	// Returns the lastheard data for the server, adds personal data if logged in
 	// Paginated
 	v1Lastheard.GET("", v1LastheardControllers.GETLastheard)
 	// Paginated
-	v1Lastheard.GET("/user/:id", middleware.RequireSelfOrAdmin(), v1LastheardControllers.GETLastheardUser)
+	v1Lastheard.GET("/user/:id", middleware.RequirePermission(models.PermissionUsersRead, middleware.Self), v1LastheardControllers.GETLastheardUser)
 	// Paginated
-	v1Lastheard.GET("/repeater/:id", middleware.RequireRepeaterOwnerOrAdmin(), v1LastheardControllers.GETLastheardRepeater)
+	v1Lastheard.GET("/repeater/:id", middleware.RequirePermission(models.PermissionRepeatersRead, middleware.RepeaterOwner), v1LastheardControllers.GETLastheardRepeater)
+	// Paginated
+	v1Lastheard.GET("/talkgroup/:id", middleware.RequirePermission(models.PermissionLogin), v1LastheardControllers.GETLastheardTalkgroup)
+
+	v1Tokens := group.Group("/tokens")
+	v1Tokens.GET("", middleware.RequirePermission(models.PermissionLogin), v1TokensControllers.GETTokens)
+	v1Tokens.POST("", middleware.RequirePermission(models.PermissionLogin), v1TokensControllers.POSTToken)
+	v1Tokens.DELETE("/:id", middleware.RequirePermission(models.PermissionLogin), v1TokensControllers.DELETEToken)
+
+	v1Invites := group.Group("/invites")
+	// Paginated
+	v1Invites.GET("", middleware.RequirePermission(models.PermissionUsersApprove), v1InvitesControllers.GETInvites)
+	v1Invites.POST("", middleware.RequirePermission(models.PermissionUsersApprove), v1InvitesControllers.POSTInvite)
+	v1Invites.DELETE("/:id", middleware.RequirePermission(models.PermissionUsersApprove), v1InvitesControllers.DELETEInvite)
+
+	v1Roles := group.Group("/roles")
+	v1Roles.GET("", middleware.RequirePermission(models.PermissionRolesManage), v1RolesControllers.GETRoles)
+	v1Roles.POST("", middleware.RequirePermission(models.PermissionRolesManage), v1RolesControllers.POSTRole)
+	v1Roles.PATCH("/:id", middleware.RequirePermission(models.PermissionRolesManage), v1RolesControllers.PATCHRole)
+	v1Roles.DELETE("/:id", middleware.RequirePermission(models.PermissionRolesManage), v1RolesControllers.DELETERole)
+
+	v1Settings := group.Group("/settings")
+	// Returns the settings the site needs before logging in
+	v1Settings.GET("/public", v1SettingsControllers.GETPublicSettings)
+	v1Settings.GET("", middleware.RequirePermission(models.PermissionSettingsManage), v1SettingsControllers.GETSettings)
+	v1Settings.PATCH("", middleware.RequirePermission(models.PermissionSettingsManage), v1SettingsControllers.PATCHSettings)
+
 	// Paginated
-	v1Lastheard.GET("/talkgroup/:id", middleware.RequireLogin(), v1LastheardControllers.GETLastheardTalkgroup)
+	group.GET("/audit", middleware.RequirePermission(models.PermissionAuditRead), v1AuditControllers.GETAudit)
 
 	group.GET("/version", v1Controllers.GETVersion)
 	group.GET("/ping", v1Controllers.GETPing)
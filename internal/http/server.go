@@ -81,6 +81,7 @@ func Start(db *gorm.DB, redisClient *realredis.Client) {
 
 	sessionStore, _ := redis.NewStore(redisClient, []byte(""), config.GetConfig().Secret)
 	r.Use(sessions.Sessions("sessions", sessionStore))
+	r.Use(middleware.SessionTracker(redisClient))
 
 	ws.ApplyRoutes(r, ratelimitMW)
 
@@ -28,6 +28,9 @@ import (
 // Amount of time for cookies/redis keys to expire.
 var sessionExpire = 86400 * 30
 
+// defaultKeyPrefix is where sessions are kept in redis unless SetKeyPrefix changes it.
+const defaultKeyPrefix = "session_"
+
 // SessionSerializer provides an interface hook for alternative serializers
 type SessionSerializer interface {
 	Deserialize(d []byte, ss *sessions.Session) error
@@ -154,7 +157,7 @@ func NewRediStore(db *redis.Client, keyPairs ...[]byte) (*RediStore, error) {
 		},
 		DefaultMaxAge: 60 * 20, // 20 minutes seems like a reasonable default
 		maxLength:     4096,
-		keyPrefix:     "session_",
+		keyPrefix:     defaultKeyPrefix,
 		serializer:    GobSerializer{},
 	}
 	_, err := rs.ping(context.Background())
@@ -0,0 +1,162 @@
+package sessions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionInfoPrefix  = "session-info_"
+	userSessionsPrefix = "user-sessions:"
+	// trackInterval keeps every request from writing when a session was last seen
+	trackInterval = time.Minute
+)
+
+// UserSession describes a logged in session. The session ID is a secret, so sessions
+// are told apart by a hash of it instead.
+type UserSession struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
+
+// Handle is the public name of a session ID
+func Handle(sessionID string) string {
+	hash := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(hash[:8])
+}
+
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("%s%d", userSessionsPrefix, userID)
+}
+
+// Track records that the user's session was used, at most once a minute unless the IP changes.
+// Sessions that were revoked or have expired are left alone.
+func Track(ctx context.Context, db *redis.Client, userID uint, sessionID string, ip string, userAgent string, now time.Time) error {
+	infoKey := sessionInfoPrefix + sessionID
+	info, err := db.HGetAll(ctx, infoKey).Result()
+	if err != nil {
+		return err
+	}
+	if lastSeen, err := time.Parse(time.RFC3339, info["last_seen_at"]); err == nil && now.Sub(lastSeen) < trackInterval && info["ip"] == ip {
+		return nil
+	}
+	exists, err := db.Exists(ctx, defaultKeyPrefix+sessionID).Result()
+	if err != nil || exists == 0 {
+		return err
+	}
+	fields := map[string]interface{}{
+		"user_id":      userID,
+		"last_seen_at": now.Format(time.RFC3339),
+		"ip":           ip,
+		"user_agent":   userAgent,
+	}
+	if info["created_at"] == "" {
+		fields["created_at"] = now.Format(time.RFC3339)
+	}
+	expire := time.Duration(sessionExpire) * time.Second
+	pipe := db.TxPipeline()
+	pipe.HSet(ctx, infoKey, fields)
+	pipe.Expire(ctx, infoKey, expire)
+	pipe.SAdd(ctx, userSessionsKey(userID), sessionID)
+	pipe.Expire(ctx, userSessionsKey(userID), expire)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Forget stops tracking a session that logged out
+func Forget(ctx context.Context, db *redis.Client, userID uint, sessionID string) error {
+	pipe := db.TxPipeline()
+	pipe.Del(ctx, sessionInfoPrefix+sessionID)
+	pipe.SRem(ctx, userSessionsKey(userID), sessionID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// List returns the user's logged in sessions, most recently seen first, dropping any that have expired
+func List(ctx context.Context, db *redis.Client, userID uint, currentID string) ([]UserSession, error) {
+	ids, err := db.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	userSessions := []UserSession{}
+	for _, id := range ids {
+		exists, err := db.Exists(ctx, defaultKeyPrefix+id).Result()
+		if err != nil {
+			return nil, err
+		}
+		info, err := db.HGetAll(ctx, sessionInfoPrefix+id).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 || len(info) == 0 {
+			if err := Forget(ctx, db, userID, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		createdAt, _ := time.Parse(time.RFC3339, info["created_at"])
+		lastSeenAt, _ := time.Parse(time.RFC3339, info["last_seen_at"])
+		userSessions = append(userSessions, UserSession{
+			ID:         Handle(id),
+			CreatedAt:  createdAt,
+			LastSeenAt: lastSeenAt,
+			IP:         info["ip"],
+			UserAgent:  info["user_agent"],
+			Current:    id == currentID,
+		})
+	}
+	sort.Slice(userSessions, func(i, j int) bool {
+		return userSessions[i].LastSeenAt.After(userSessions[j].LastSeenAt)
+	})
+	return userSessions, nil
+}
+
+// Revoke logs out the user's session with the given handle, reporting whether there was one
+func Revoke(ctx context.Context, db *redis.Client, userID uint, handle string) (bool, error) {
+	ids, err := db.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		if Handle(id) == handle {
+			return true, revoke(ctx, db, userID, id)
+		}
+	}
+	return false, nil
+}
+
+// RevokeAll logs out every session of the user except the one given, which can be empty
+func RevokeAll(ctx context.Context, db *redis.Client, userID uint, exceptID string) error {
+	ids, err := db.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == exceptID {
+			continue
+		}
+		if err := revoke(ctx, db, userID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revoke deletes the session itself, so its cookie no longer logs anyone in
+func revoke(ctx context.Context, db *redis.Client, userID uint, sessionID string) error {
+	err := db.Del(ctx, defaultKeyPrefix+sessionID).Err()
+	if err != nil {
+		return err
+	}
+	return Forget(ctx, db, userID, sessionID)
+}
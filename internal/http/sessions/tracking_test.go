@@ -0,0 +1,20 @@
+package sessions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandle(t *testing.T) {
+	id := "4RGLSBQXNHBIJMLWGCRO5UXDJ6OCBRBIRFOZ3WMWGSSZGXAIXFQA"
+	handle := Handle(id)
+	if handle != Handle(id) {
+		t.Error("Handle is not stable")
+	}
+	if len(handle) != 16 || strings.Contains(id, handle) {
+		t.Errorf("Unexpected handle %s", handle)
+	}
+	if handle == Handle(id+"A") {
+		t.Error("Different sessions have the same handle")
+	}
+}
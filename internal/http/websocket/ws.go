@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/USA-RedDragon/DMRHub/internal/config"
 	"github.com/USA-RedDragon/DMRHub/internal/http/api/middleware"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -94,6 +96,13 @@ func (h *WSHandler) pingHandler(ctx context.Context, w http.ResponseWriter, r *h
 }
 
 func (h *WSHandler) repeaterHandler(ctx context.Context, db *gorm.DB, session sessions.Session, w http.ResponseWriter, r *http.Request) {
+	userIDIface := session.Get("user_id")
+	if userIDIface == nil {
+		klog.Error("repeaterHandler: Failed to get user_id from session")
+		return
+	}
+	user := models.FindUserWithRoles(db, userIDIface.(uint))
+
 	conn, err := h.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		klog.Errorf("Failed to set websocket upgrade: %v", err)
@@ -106,18 +115,53 @@ func (h *WSHandler) repeaterHandler(ctx context.Context, db *gorm.DB, session se
 		}
 	}()
 
+	// Users who can see every repeater get them all, everyone else only the repeaters they own
+	var pubsub *redis.PubSub
+	if user.HasPermission(models.PermissionRepeatersRead) {
+		pubsub = h.redis.PSubscribe(ctx, models.RepeaterEventsChannelPattern)
+		defer func() {
+			err := pubsub.PUnsubscribe(ctx, models.RepeaterEventsChannelPattern)
+			if err != nil {
+				klog.Errorf("Failed to unsubscribe from repeater events: %v", err)
+			}
+		}()
+	} else {
+		var channels []string
+		for _, repeater := range models.GetUserRepeaters(db, user.ID) {
+			channels = append(channels, models.RepeaterEventsChannel(repeater.RadioID))
+		}
+		pubsub = h.redis.Subscribe(ctx, channels...)
+		defer func() {
+			err := pubsub.Unsubscribe(ctx, channels...)
+			if err != nil {
+				klog.Errorf("Failed to unsubscribe from repeater events: %v", err)
+			}
+		}()
+	}
+	defer func() {
+		err := pubsub.Close()
+		if err != nil {
+			klog.Errorf("Failed to close pubsub: %v", err)
+		}
+	}()
+
 	readFailed := make(chan string)
 	go func() {
 		for {
-			t, msg, err := conn.ReadMessage()
+			_, _, err := conn.ReadMessage()
 			if err != nil {
 				readFailed <- "read failed"
 				break
 			}
-			err = conn.WriteMessage(t, msg)
-			if err != nil {
+		}
+	}()
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
+				klog.Errorf("Failed to write message to websocket: %v", err)
 				readFailed <- "write failed"
-				break
+				return
 			}
 		}
 	}()
@@ -144,6 +188,9 @@ func (h *WSHandler) callHandler(ctx context.Context, db *gorm.DB, session sessio
 	userIDIface := session.Get("user_id")
 	var pubsub *redis.PubSub
 	if userIDIface == nil {
+		if !models.CurrentAppSettings().LastheardIsPublic() {
+			return
+		}
 		// User ID not found, subscribe to TG calls
 		pubsub = h.redis.Subscribe(ctx, "calls")
 		defer func() {
@@ -196,6 +243,59 @@ func (h *WSHandler) callHandler(ctx context.Context, db *gorm.DB, session sessio
 	}
 }
 
+func (h *WSHandler) netHandler(ctx context.Context, netID uint, w http.ResponseWriter, r *http.Request) {
+	conn, err := h.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		klog.Errorf("Failed to set websocket upgrade: %v", err)
+		return
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			klog.Errorf("Failed to close websocket: %v", err)
+		}
+	}()
+
+	channel := fmt.Sprintf("nets:%d", netID)
+	pubsub := h.redis.Subscribe(ctx, channel)
+	defer func() {
+		err := pubsub.Unsubscribe(ctx, channel)
+		if err != nil {
+			klog.Errorf("Failed to unsubscribe from %s: %v", channel, err)
+		}
+		err = pubsub.Close()
+		if err != nil {
+			klog.Errorf("Failed to close pubsub: %v", err)
+		}
+	}()
+
+	readFailed := make(chan string)
+	go func() {
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				readFailed <- "read failed"
+				break
+			}
+		}
+	}()
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
+				klog.Errorf("Failed to write message to websocket: %v", err)
+				readFailed <- "write failed"
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-readFailed:
+	}
+}
+
 func (h *WSHandler) ApplyRoutes(r *gin.Engine, ratelimit gin.HandlerFunc) {
 	r.GET("/ws/repeaters", middleware.RequireLogin(), ratelimit, func(c *gin.Context) {
 		db := c.MustGet("DB").(*gorm.DB)
@@ -212,4 +312,13 @@ func (h *WSHandler) ApplyRoutes(r *gin.Engine, ratelimit gin.HandlerFunc) {
 		session := sessions.Default(c)
 		h.callHandler(c.Request.Context(), db, session, c.Writer, c.Request)
 	})
+
+	r.GET("/ws/nets/:id", middleware.RequireLogin(), ratelimit, func(c *gin.Context) {
+		netID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid net ID"})
+			return
+		}
+		h.netHandler(c.Request.Context(), uint(netID), c.Writer, c.Request)
+	})
 }
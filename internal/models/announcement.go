@@ -0,0 +1,170 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// AnnouncementFrameSize is the size of one stored frame: a byte holding the
+// frame type in the high nibble and the data type or voice sequence in the low
+// nibble, followed by the 33 byte DMR burst
+const AnnouncementFrameSize = 34
+
+// Announcement targets
+const (
+	AnnouncementTargetTalkgroup = "talkgroup"
+	AnnouncementTargetRepeater  = "repeater"
+)
+
+// AnnouncementsReloadChannel is published to whenever announcement schedules change
+const AnnouncementsReloadChannel = "announcements:reload"
+
+// AnnouncementsQueue is the Redis list of announcements waiting to be played
+const AnnouncementsQueue = "announcements:queue"
+
+// AnnouncementRecordKey holds the announcement a user's next parrot call is recorded into
+func AnnouncementRecordKey(userID uint) string {
+	return fmt.Sprintf("announcements:record:%d", userID)
+}
+
+// Announcement is a recorded voice clip that can be played onto the network
+type Announcement struct {
+	ID          uint                   `json:"id" gorm:"primaryKey"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	OwnerID     uint                   `json:"-"`
+	Owner       User                   `json:"owner" gorm:"foreignKey:OwnerID"`
+	Frames      []byte                 `json:"-"`
+	FrameCount  uint                   `json:"frame_count"`
+	Schedules   []AnnouncementSchedule `json:"schedules" gorm:"foreignKey:AnnouncementID"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"-"`
+	DeletedAt   gorm.DeletedAt         `json:"-" gorm:"index"`
+}
+
+// AnnouncementSchedule plays an announcement on a cron schedule
+type AnnouncementSchedule struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	AnnouncementID uint       `json:"announcement_id" gorm:"index"`
+	Cron           string     `json:"cron"`
+	TargetType     string     `json:"target_type"`
+	TargetID       uint       `json:"target_id"`
+	TimeSlot       bool       `json:"time_slot"`
+	SourceID       uint       `json:"source_id"`
+	Enabled        bool       `json:"enabled"`
+	LastPlayed     *time.Time `json:"last_played"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"-"`
+}
+
+// AnnouncementPlayback is a request to play an announcement, queued in Redis
+type AnnouncementPlayback struct {
+	AnnouncementID uint   `json:"announcement_id"`
+	ScheduleID     uint   `json:"schedule_id,omitempty"`
+	TargetType     string `json:"target_type"`
+	TargetID       uint   `json:"target_id"`
+	TimeSlot       bool   `json:"time_slot"`
+	SourceID       uint   `json:"source_id"`
+}
+
+// AnnouncementFrame is a single stored burst of an announcement
+type AnnouncementFrame struct {
+	FrameType   dmrconst.FrameType
+	DTypeOrVSeq uint
+	DMRData     [33]byte
+}
+
+// EncodeAnnouncementFrames packs frames into the stored announcement format
+func EncodeAnnouncementFrames(frames []AnnouncementFrame) []byte {
+	data := make([]byte, 0, len(frames)*AnnouncementFrameSize)
+	for _, frame := range frames {
+		data = append(data, byte(frame.FrameType)<<4|byte(frame.DTypeOrVSeq&0xF))
+		data = append(data, frame.DMRData[:]...)
+	}
+	return data
+}
+
+// DecodeAnnouncementFrames unpacks the stored announcement format, ignoring any trailing partial frame
+func DecodeAnnouncementFrames(data []byte) []AnnouncementFrame {
+	frames := make([]AnnouncementFrame, 0, len(data)/AnnouncementFrameSize)
+	for i := 0; i+AnnouncementFrameSize <= len(data); i += AnnouncementFrameSize {
+		frame := AnnouncementFrame{
+			FrameType:   dmrconst.FrameType(data[i] >> 4),
+			DTypeOrVSeq: uint(data[i] & 0xF),
+		}
+		copy(frame.DMRData[:], data[i+1:i+AnnouncementFrameSize])
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// QueueAnnouncement asks one of the DMR servers to play an announcement
+func QueueAnnouncement(ctx context.Context, redis *redis.Client, playback AnnouncementPlayback) error {
+	playbackJSON, err := json.Marshal(playback)
+	if err != nil {
+		return err
+	}
+	return redis.RPush(ctx, AnnouncementsQueue, playbackJSON).Err()
+}
+
+// PublishAnnouncementsReload tells every DMR server instance to reload its announcement schedules
+func PublishAnnouncementsReload(ctx context.Context, redis *redis.Client) {
+	_, err := redis.Publish(ctx, AnnouncementsReloadChannel, "reload").Result()
+	if err != nil {
+		klog.Errorf("Error publishing announcement reload: %v", err)
+	}
+}
+
+func ListAnnouncements(db *gorm.DB) []Announcement {
+	var announcements []Announcement
+	db.Preload("Owner").Preload("Schedules").Order("id asc").Find(&announcements)
+	return announcements
+}
+
+func CountAnnouncements(db *gorm.DB) int {
+	var count int64
+	db.Model(&Announcement{}).Count(&count)
+	return int(count)
+}
+
+func AnnouncementIDExists(db *gorm.DB, id uint) bool {
+	var count int64
+	db.Model(&Announcement{}).Where("id = ?", id).Limit(1).Count(&count)
+	return count > 0
+}
+
+func FindAnnouncementByID(db *gorm.DB, ID uint) Announcement {
+	var announcement Announcement
+	db.Preload("Owner").Preload("Schedules").First(&announcement, ID)
+	return announcement
+}
+
+func ListEnabledAnnouncementSchedules(db *gorm.DB) []AnnouncementSchedule {
+	var schedules []AnnouncementSchedule
+	db.Where("enabled = ?", true).Order("id asc").Find(&schedules)
+	return schedules
+}
+
+func FindAnnouncementSchedule(db *gorm.DB, announcementID uint, ID uint) AnnouncementSchedule {
+	var schedule AnnouncementSchedule
+	db.Where("announcement_id = ?", announcementID).First(&schedule, ID)
+	return schedule
+}
+
+func DeleteAnnouncement(db *gorm.DB, id uint) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tx.Unscoped().Where("announcement_id = ?", id).Delete(&AnnouncementSchedule{})
+		tx.Unscoped().Delete(&Announcement{ID: id})
+		return nil
+	})
+	if err != nil {
+		klog.Errorf("Error deleting announcement: %s", err)
+	}
+}
@@ -0,0 +1,33 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnnouncementFrames(t *testing.T) {
+	frames := []models.AnnouncementFrame{
+		{FrameType: dmrconst.FrameDataSync, DTypeOrVSeq: uint(dmrconst.DTypeVoiceHead), DMRData: [33]byte{1, 2, 3}},
+		{FrameType: dmrconst.FrameVoiceSync, DTypeOrVSeq: 0, DMRData: [33]byte{4, 5, 6}},
+		{FrameType: dmrconst.FrameVoice, DTypeOrVSeq: 5, DMRData: [33]byte{7, 8, 9}},
+		{FrameType: dmrconst.FrameDataSync, DTypeOrVSeq: uint(dmrconst.DTypeVoiceTerm), DMRData: [33]byte{10, 11, 12}},
+	}
+	data := models.EncodeAnnouncementFrames(frames)
+	if len(data) != len(frames)*models.AnnouncementFrameSize {
+		t.Fatalf("Expected %d bytes, got %d", len(frames)*models.AnnouncementFrameSize, len(data))
+	}
+	if data[0] != 0x21 {
+		t.Errorf("Expected a voice header to be stored as 0x21, got %#x", data[0])
+	}
+	if !cmp.Equal(frames, models.DecodeAnnouncementFrames(data)) {
+		t.Error("Announcement frames did not survive a round trip")
+	}
+
+	// A truncated upload drops the partial frame
+	if decoded := models.DecodeAnnouncementFrames(data[:len(data)-1]); len(decoded) != len(frames)-1 {
+		t.Errorf("Expected %d frames from truncated data, got %d", len(frames)-1, len(decoded))
+	}
+}
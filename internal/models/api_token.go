@@ -0,0 +1,152 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// API token scopes
+const (
+	// APITokenScopeLastheard allows reading the lastheard endpoints
+	APITokenScopeLastheard = "lastheard:read"
+	// APITokenScopeRepeaters allows managing the user's repeaters
+	APITokenScopeRepeaters = "repeaters"
+	// APITokenScopeAdmin allows everything the user could do when logged in
+	APITokenScopeAdmin = "admin"
+)
+
+// APITokenScopeAdminPermission is needed to create an admin token, as it carries the power to manage other users
+const APITokenScopeAdminPermission = PermissionUsersManage
+
+// APITokenPrefix starts every API token so they're easy to recognize in configs and leaks
+const APITokenPrefix = "dmrhub_"
+
+// apiTokenUseInterval keeps every request made with a token from writing its last use
+const apiTokenUseInterval = time.Minute
+
+var apiTokenScopes = []string{APITokenScopeLastheard, APITokenScopeRepeaters, APITokenScopeAdmin}
+
+// APIToken is a personal token a user can send as a bearer token instead of logging in.
+// Only a hash of the token is stored, the token itself is shown once when created.
+type APIToken struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Hash       string     `json:"-" gorm:"uniqueIndex"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// TwoFactor is set when the token was created from a session that logged in with a second factor
+	TwoFactor bool      `json:"two_factor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func IsValidAPITokenScope(scope string) bool {
+	for _, s := range apiTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func HashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateAPIToken creates a new random token, returning it along with its hash and a hint to tell it apart
+func GenerateAPIToken() (string, string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashAPIToken(token), token[:len(APITokenPrefix)+4], nil
+}
+
+// Active reports whether the token can still be used
+func (t APIToken) Active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
+
+// Allows reports whether the token's scopes cover a request to the given route.
+// Tokens can never manage tokens, sessions or two-factor authentication, for the token's
+// user or anyone else, that takes a logged in session. PATCHUser likewise refuses
+// password and email changes made with a token.
+func (t APIToken) Allows(method string, route string) bool {
+	if strings.HasPrefix(route, "/api/v1/tokens") || strings.HasPrefix(route, "/api/v1/users/me/totp") ||
+		strings.HasPrefix(route, "/api/v1/users/me/sessions") ||
+		route == "/api/v1/users/:id/totp" || route == "/api/v1/users/:id/sessions" {
+		return false
+	}
+	for _, scope := range t.Scopes {
+		switch scope {
+		case APITokenScopeAdmin:
+			return true
+		case APITokenScopeRepeaters:
+			if strings.HasPrefix(route, "/api/v1/repeaters") {
+				return true
+			}
+		case APITokenScopeLastheard:
+			if method == "GET" && strings.HasPrefix(route, "/api/v1/lastheard") {
+				return true
+			}
+		}
+	}
+	// Any token can look up who it belongs to
+	return method == "GET" && route == "/api/v1/users/me"
+}
+
+// FindAPIToken looks up a token by its plain text value
+func FindAPIToken(db *gorm.DB, token string) (APIToken, bool) {
+	var apiToken APIToken
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return apiToken, false
+	}
+	db.Where("hash = ?", HashAPIToken(token)).Limit(1).Find(&apiToken)
+	return apiToken, apiToken.ID != 0
+}
+
+func FindAPITokenByID(db *gorm.DB, id uint) APIToken {
+	var apiToken APIToken
+	db.Find(&apiToken, "id = ?", id)
+	return apiToken
+}
+
+func ListUserAPITokens(db *gorm.DB, userID uint) []APIToken {
+	var tokens []APIToken
+	db.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens)
+	return tokens
+}
+
+// TouchAPIToken records a use of the token, at most once a minute
+func TouchAPIToken(db *gorm.DB, token APIToken, now time.Time, ip string) {
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < apiTokenUseInterval && token.LastUsedIP == ip {
+		return
+	}
+	err := db.Model(&APIToken{}).Where("id = ?", token.ID).Updates(map[string]interface{}{
+		"last_used_at": now,
+		"last_used_ip": ip,
+	}).Error
+	if err != nil {
+		klog.Errorf("Error recording use of API token %d: %v", token.ID, err)
+	}
+}
+
+func RevokeAPIToken(db *gorm.DB, id uint) error {
+	return db.Model(&APIToken{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,81 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestGenerateAPIToken(t *testing.T) {
+	token, hash, hint, err := models.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, models.APITokenPrefix) || !strings.HasPrefix(token, hint) {
+		t.Errorf("Unexpected token %s with hint %s", token, hint)
+	}
+	if hash != models.HashAPIToken(token) || strings.Contains(hash, token) {
+		t.Error("Token hash does not match the token")
+	}
+	other, _, _, err := models.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Error("Generated the same token twice")
+	}
+}
+
+func TestAPITokenActive(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	if !(models.APIToken{}).Active(now) {
+		t.Error("Token without an expiry should be active")
+	}
+	if !(models.APIToken{ExpiresAt: &future}).Active(now) {
+		t.Error("Token expiring later should be active")
+	}
+	if (models.APIToken{ExpiresAt: &past}).Active(now) {
+		t.Error("Expired token should not be active")
+	}
+	if (models.APIToken{RevokedAt: &past}).Active(now) {
+		t.Error("Revoked token should not be active")
+	}
+}
+
+func TestAPITokenAllows(t *testing.T) {
+	lastheard := models.APIToken{Scopes: []string{models.APITokenScopeLastheard}}
+	repeaters := models.APIToken{Scopes: []string{models.APITokenScopeRepeaters}}
+	admin := models.APIToken{Scopes: []string{models.APITokenScopeAdmin}}
+	tests := []struct {
+		token  models.APIToken
+		method string
+		route  string
+		allow  bool
+	}{
+		{lastheard, "GET", "/api/v1/lastheard", true},
+		{lastheard, "GET", "/api/v1/lastheard/talkgroup/:id", true},
+		{lastheard, "GET", "/api/v1/users/me", true},
+		{lastheard, "GET", "/api/v1/repeaters/my", false},
+		{lastheard, "POST", "/api/v1/users/suspend/:id", false},
+		{repeaters, "POST", "/api/v1/repeaters/:id/link/:type/:slot/:target", true},
+		{repeaters, "DELETE", "/api/v1/repeaters/:id", true},
+		{repeaters, "GET", "/api/v1/lastheard", false},
+		{admin, "POST", "/api/v1/users/suspend/:id", true},
+		{admin, "POST", "/api/v1/tokens", false},
+		{admin, "DELETE", "/api/v1/tokens/:id", false},
+		{admin, "DELETE", "/api/v1/users/me/totp", false},
+		{admin, "DELETE", "/api/v1/users/me/sessions/:id", false},
+		{admin, "DELETE", "/api/v1/users/:id/totp", false},
+		{admin, "DELETE", "/api/v1/users/:id/sessions", false},
+		{admin, "PATCH", "/api/v1/users/:id", true},
+	}
+	for _, test := range tests {
+		if got := test.token.Allows(test.method, test.route); got != test.allow {
+			t.Errorf("%v %s %s: expected %v, got %v", test.token.Scopes, test.method, test.route, test.allow, got)
+		}
+	}
+}
@@ -1,15 +1,158 @@
 package models
 
 import (
+	"context"
+	"sync"
 	"time"
 
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"k8s.io/klog/v2"
 )
 
+// AppSettingsReloadChannel is published to whenever the settings are changed
+const AppSettingsReloadChannel = "settings:reload"
+
+const (
+	DefaultNetworkName = "DMRHub"
+	DefaultParrotDelay = 3 * time.Second
+)
+
+// Who can see the network's lastheard
+const (
+	// LastheardPublic shows recent calls to anyone
+	LastheardPublic = "public"
+	// LastheardUsers only shows recent calls to logged in users
+	LastheardUsers = "users"
+)
+
+func IsValidLastheardVisibility(visibility string) bool {
+	return visibility == LastheardPublic || visibility == LastheardUsers
+}
+
+// How new users get onto the network
+const (
+	// RegistrationModeApproval has every registration wait for an admin
+	RegistrationModeApproval = "approval"
+	// RegistrationModeAutoApprove approves registrations that check out against the DMR user database
+	RegistrationModeAutoApprove = "auto_approve"
+	// RegistrationModeInvite only takes registrations with an invite code
+	RegistrationModeInvite = "invite"
+	// RegistrationModeClosed takes no registrations
+	RegistrationModeClosed = "closed"
+)
+
+func IsValidRegistrationMode(mode string) bool {
+	switch mode {
+	case RegistrationModeApproval, RegistrationModeAutoApprove, RegistrationModeInvite, RegistrationModeClosed:
+		return true
+	}
+	return false
+}
+
 type AppSettings struct {
-	ID        uint `gorm:"primaryKey"`
-	HasSeeded bool
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	ID        uint `json:"-" gorm:"primaryKey"`
+	HasSeeded bool `json:"-"`
+	// HasSeededRoles is separate from HasSeeded since roles came after most networks were set up
+	HasSeededRoles bool `json:"-"`
+	// RequireAdminTwoFactor keeps admins out of admin routes until they've logged in with a second factor
+	RequireAdminTwoFactor bool `json:"require_admin_two_factor"`
+	// RegistrationMode is one of the RegistrationMode constants
+	RegistrationMode string `json:"registration_mode" gorm:"default:approval"`
+	NetworkName      string `json:"network_name"`
+	// ParrotDelay is how many seconds the parrot waits before playing a call back, nil for the default
+	ParrotDelay *uint `json:"parrot_delay"`
+	// DynamicTalkgroupTimeout is in minutes, nil to use the DYNAMIC_TALKGROUP_TIMEOUT environment variable
+	DynamicTalkgroupTimeout *uint  `json:"dynamic_talkgroup_timeout"`
+	LastheardVisibility     string `json:"lastheard_visibility" gorm:"default:public"`
+	// MaintenanceMessage is shown to everyone using the site while it's set
+	MaintenanceMessage string         `json:"maintenance_message"`
+	CreatedAt          time.Time      `json:"-"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Registration is the registration mode in effect, falling back to admin approval
+func (a AppSettings) Registration() string {
+	if !IsValidRegistrationMode(a.RegistrationMode) {
+		return RegistrationModeApproval
+	}
+	return a.RegistrationMode
+}
+
+// Network is the network's name, for places like emails and authenticator apps
+func (a AppSettings) Network() string {
+	if a.NetworkName == "" {
+		return DefaultNetworkName
+	}
+	return a.NetworkName
+}
+
+func (a AppSettings) ParrotDelayDuration() time.Duration {
+	if a.ParrotDelay == nil {
+		return DefaultParrotDelay
+	}
+	return time.Duration(*a.ParrotDelay) * time.Second
+}
+
+// DynamicTalkgroupTimeoutDuration is the network default for unlinking dynamic talkgroups, zero to never unlink
+func (a AppSettings) DynamicTalkgroupTimeoutDuration() time.Duration {
+	if a.DynamicTalkgroupTimeout == nil {
+		return config.GetConfig().DynamicTalkgroupTimeout
+	}
+	return time.Duration(*a.DynamicTalkgroupTimeout) * time.Minute
+}
+
+// LastheardIsPublic reports whether people who aren't logged in can see recent calls
+func (a AppSettings) LastheardIsPublic() bool {
+	return a.LastheardVisibility != LastheardUsers
+}
+
+// GetAppSettings returns the first (and only) AppSettings record
+func GetAppSettings(db *gorm.DB) AppSettings {
+	var appSettings AppSettings
+	err := db.First(&appSettings).Error
+	if err != nil {
+		klog.Errorf("Error loading app settings: %v", err)
+	}
+	return appSettings
+}
+
+var (
+	currentAppSettingsLock sync.RWMutex
+	currentAppSettings     AppSettings
+)
+
+// CurrentAppSettings returns the settings as of the last reload, for hot paths that can't go to the database
+func CurrentAppSettings() AppSettings {
+	currentAppSettingsLock.RLock()
+	defer currentAppSettingsLock.RUnlock()
+	return currentAppSettings
+}
+
+// ReloadAppSettings reads the settings from the database into CurrentAppSettings
+func ReloadAppSettings(db *gorm.DB) {
+	appSettings := GetAppSettings(db)
+	if appSettings.ID == 0 {
+		return
+	}
+	currentAppSettingsLock.Lock()
+	currentAppSettings = appSettings
+	currentAppSettingsLock.Unlock()
+}
+
+// WatchAppSettings reloads the settings whenever any instance changes them
+func WatchAppSettings(ctx context.Context, db *gorm.DB, redis *redis.Client) {
+	WatchReload(ctx, redis, AppSettingsReloadChannel, ReloadInterval, func() {
+		ReloadAppSettings(db)
+	})
+}
+
+// PublishAppSettingsReload tells every instance to reload the settings
+func PublishAppSettingsReload(ctx context.Context, redis *redis.Client) {
+	_, err := redis.Publish(ctx, AppSettingsReloadChannel, "reload").Result()
+	if err != nil {
+		klog.Errorf("Error publishing settings reload: %v", err)
+	}
 }
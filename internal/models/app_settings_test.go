@@ -0,0 +1,62 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestAppSettingsRegistration(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", models.RegistrationModeApproval},
+		{"bogus", models.RegistrationModeApproval},
+		{models.RegistrationModeAutoApprove, models.RegistrationModeAutoApprove},
+		{models.RegistrationModeInvite, models.RegistrationModeInvite},
+		{models.RegistrationModeClosed, models.RegistrationModeClosed},
+	}
+	for _, tt := range tests {
+		if got := (models.AppSettings{RegistrationMode: tt.mode}).Registration(); got != tt.want {
+			t.Errorf("Registration() with mode %q = %s, want %s", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestAppSettingsDefaults(t *testing.T) {
+	var appSettings models.AppSettings
+	if got := appSettings.Network(); got != models.DefaultNetworkName {
+		t.Errorf("Network() = %s, want %s", got, models.DefaultNetworkName)
+	}
+	if got := appSettings.ParrotDelayDuration(); got != models.DefaultParrotDelay {
+		t.Errorf("ParrotDelayDuration() = %s, want %s", got, models.DefaultParrotDelay)
+	}
+	if !appSettings.LastheardIsPublic() {
+		t.Error("LastheardIsPublic() = false, want true")
+	}
+}
+
+func TestAppSettingsOverrides(t *testing.T) {
+	parrotDelay := uint(5)
+	timeout := uint(0)
+	appSettings := models.AppSettings{
+		NetworkName:             "Test Net",
+		ParrotDelay:             &parrotDelay,
+		DynamicTalkgroupTimeout: &timeout,
+		LastheardVisibility:     models.LastheardUsers,
+	}
+	if got := appSettings.Network(); got != "Test Net" {
+		t.Errorf("Network() = %s, want Test Net", got)
+	}
+	if got := appSettings.ParrotDelayDuration(); got != 5*time.Second {
+		t.Errorf("ParrotDelayDuration() = %s, want 5s", got)
+	}
+	if got := appSettings.DynamicTalkgroupTimeoutDuration(); got != 0 {
+		t.Errorf("DynamicTalkgroupTimeoutDuration() = %s, want 0s", got)
+	}
+	if appSettings.LastheardIsPublic() {
+		t.Error("LastheardIsPublic() = true, want false")
+	}
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// Audit actions
+const (
+	AuditUserCreate         = "user.create"
+	AuditUserUpdate         = "user.update"
+	AuditUserDelete         = "user.delete"
+	AuditUserPromote        = "user.promote"
+	AuditUserDemote         = "user.demote"
+	AuditUserApprove        = "user.approve"
+	AuditUserSuspend        = "user.suspend"
+	AuditUserUnsuspend      = "user.unsuspend"
+	AuditUserTwoFactorReset = "user.two_factor.reset"
+	AuditUserRadioVerify    = "user.radio_verify"
+	AuditUserForceLogout    = "user.force_logout"
+	AuditTalkgroupCreate    = "talkgroup.create"
+	AuditTalkgroupUpdate    = "talkgroup.update"
+	AuditTalkgroupDelete    = "talkgroup.delete"
+	AuditTalkgroupAdmins    = "talkgroup.admins"
+	AuditTalkgroupNCOs      = "talkgroup.ncos"
+	AuditRepeaterCreate     = "repeater.create"
+	AuditRepeaterUpdate     = "repeater.update"
+	AuditRepeaterDelete     = "repeater.delete"
+	AuditRepeaterTalkgroups = "repeater.talkgroups"
+	AuditRepeaterLink       = "repeater.link"
+	AuditRepeaterUnlink     = "repeater.unlink"
+	AuditRewriteCreate      = "rewrite.create"
+	AuditRewriteDelete      = "rewrite.delete"
+	AuditBridgeCreate       = "bridge.create"
+	AuditBridgeUpdate       = "bridge.update"
+	AuditBridgeDelete       = "bridge.delete"
+	AuditAnnouncementCreate = "announcement.create"
+	AuditAnnouncementDelete = "announcement.delete"
+	AuditAnnouncementAudio  = "announcement.audio"
+	AuditAnnouncementPlay   = "announcement.play"
+	AuditScheduleCreate     = "announcement.schedule.create"
+	AuditScheduleDelete     = "announcement.schedule.delete"
+	AuditNetStart           = "net.start"
+	AuditNetStop            = "net.stop"
+	AuditCheckInUpdate      = "net.checkin.update"
+	AuditCheckInDelete      = "net.checkin.delete"
+	AuditAPITokenCreate     = "api_token.create"
+	AuditAPITokenRevoke     = "api_token.revoke"
+	AuditSettingsUpdate     = "settings.update"
+	AuditRoleCreate         = "role.create"
+	AuditRoleUpdate         = "role.update"
+	AuditRoleDelete         = "role.delete"
+	AuditUserRoles          = "user.roles"
+	AuditInviteCreate       = "invite.create"
+	AuditInviteDelete       = "invite.delete"
+)
+
+// Kinds of audit targets
+const (
+	AuditTargetUser         = "user"
+	AuditTargetTalkgroup    = "talkgroup"
+	AuditTargetRepeater     = "repeater"
+	AuditTargetRewrite      = "rewrite"
+	AuditTargetBridge       = "bridge"
+	AuditTargetAnnouncement = "announcement"
+	AuditTargetSchedule     = "announcement_schedule"
+	AuditTargetNet          = "net"
+	AuditTargetCheckIn      = "net_checkin"
+	AuditTargetAPIToken     = "api_token"
+	AuditTargetSettings     = "settings"
+	AuditTargetRole         = "role"
+	AuditTargetInvite       = "invite"
+)
+
+// Where an audited change came from
+const (
+	AuditSourceAPI    = "api"
+	AuditSourceOnAir  = "on-air"
+	AuditSourceSystem = "system"
+)
+
+var ErrAuditLogAppendOnly = errors.New("the audit log is append-only")
+
+// AuditValue is a JSON snapshot of a target before or after a change
+type AuditValue json.RawMessage
+
+func NewAuditValue(value interface{}) AuditValue {
+	if value == nil {
+		return nil
+	}
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		klog.Errorf("Error marshalling audit value: %v", err)
+		return nil
+	}
+	return AuditValue(valueJSON)
+}
+
+func (v AuditValue) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return string(v), nil
+}
+
+func (v *AuditValue) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*v = nil
+	case string:
+		*v = AuditValue(src)
+	case []byte:
+		*v = append(AuditValue(nil), src...)
+	default:
+		return fmt.Errorf("unsupported audit value type %T", src)
+	}
+	return nil
+}
+
+func (v AuditValue) MarshalJSON() ([]byte, error) {
+	if len(v) == 0 {
+		return []byte("null"), nil
+	}
+	return v, nil
+}
+
+func (v *AuditValue) UnmarshalJSON(data []byte) error {
+	*v = append(AuditValue(nil), data...)
+	return nil
+}
+
+// AuditLink is the before or after value of a talkgroup link or unlink
+type AuditLink struct {
+	Type        string `json:"type"`
+	Slot        uint   `json:"slot"`
+	TalkgroupID uint   `json:"talkgroup_id"`
+}
+
+// AuditLog is one privileged change. Entries are never updated or deleted.
+type AuditLog struct {
+	ID            uint       `json:"id" gorm:"primarykey"`
+	Time          time.Time  `json:"time" gorm:"index"`
+	ActorID       *uint      `json:"actor_id" gorm:"index"`
+	ActorCallsign string     `json:"actor_callsign"`
+	Source        string     `json:"source"`
+	Action        string     `json:"action" gorm:"index"`
+	TargetType    string     `json:"target_type" gorm:"index:idx_audit_target"`
+	TargetID      uint       `json:"target_id" gorm:"index:idx_audit_target"`
+	Before        AuditValue `json:"before" gorm:"type:jsonb"`
+	After         AuditValue `json:"after" gorm:"type:jsonb"`
+	IP            string     `json:"ip,omitempty"`
+}
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+func RecordAudit(db *gorm.DB, entry AuditLog) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		klog.Errorf("Error recording audit log %s on %s %d: %v", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
+
+// AuditFilter narrows down the audit log, zero values match everything
+type AuditFilter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   uint
+}
+
+func (f AuditFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.ActorID != 0 {
+		db = db.Where("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		db = db.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		db = db.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != 0 {
+		db = db.Where("target_id = ?", f.TargetID)
+	}
+	return db
+}
+
+func FindAuditLogs(db *gorm.DB, filter AuditFilter) []AuditLog {
+	var logs []AuditLog
+	filter.apply(db).Order("time desc, id desc").Find(&logs)
+	return logs
+}
+
+func CountAuditLogs(db *gorm.DB, filter AuditFilter) int {
+	var count int64
+	filter.apply(db.Model(&AuditLog{})).Count(&count)
+	return int(count)
+}
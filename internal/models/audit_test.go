@@ -0,0 +1,57 @@
+package models_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestAuditValueRoundTrip(t *testing.T) {
+	value := models.NewAuditValue(models.AuditLink{Type: "dynamic", Slot: 2, TalkgroupID: 91})
+	stored, err := value.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanned models.AuditValue
+	if err := scanned.Scan([]byte(stored.(string))); err != nil {
+		t.Fatal(err)
+	}
+	var link models.AuditLink
+	if err := json.Unmarshal(scanned, &link); err != nil {
+		t.Fatal(err)
+	}
+	if link.Type != "dynamic" || link.Slot != 2 || link.TalkgroupID != 91 {
+		t.Errorf("Unexpected link %+v", link)
+	}
+}
+
+func TestAuditValueEmpty(t *testing.T) {
+	value := models.NewAuditValue(nil)
+	stored, err := value.Value()
+	if err != nil || stored != nil {
+		t.Errorf("Expected an empty value to be stored as NULL, got %v, %v", stored, err)
+	}
+	entryJSON, err := json.Marshal(models.AuditLog{Action: models.AuditUserDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(entryJSON, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["before"] != nil || entry["after"] != nil {
+		t.Errorf("Expected empty values to marshal as null, got %s", entryJSON)
+	}
+}
+
+func TestAuditLogAppendOnly(t *testing.T) {
+	var entry models.AuditLog
+	if err := entry.BeforeUpdate(nil); !errors.Is(err, models.ErrAuditLogAppendOnly) {
+		t.Errorf("Expected updates to be refused, got %v", err)
+	}
+	if err := entry.BeforeDelete(nil); !errors.Is(err, models.ErrAuditLogAppendOnly) {
+		t.Errorf("Expected deletes to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// BridgesReloadChannel is published to whenever bridge rules are changed
+const BridgesReloadChannel = "bridges:reload"
+
+// Bridge patches traffic from one talkgroup onto another
+type Bridge struct {
+	ID                     uint           `json:"id" gorm:"primaryKey"`
+	Name                   string         `json:"name"`
+	SourceTalkgroupID      uint           `json:"-"`
+	SourceTalkgroup        Talkgroup      `json:"source_talkgroup" gorm:"foreignKey:SourceTalkgroupID"`
+	DestinationTalkgroupID uint           `json:"-"`
+	DestinationTalkgroup   Talkgroup      `json:"destination_talkgroup" gorm:"foreignKey:DestinationTalkgroupID"`
+	Bidirectional          bool           `json:"bidirectional"`
+	Enabled                bool           `json:"enabled"`
+	StartsAt               *time.Time     `json:"starts_at"`
+	EndsAt                 *time.Time     `json:"ends_at"`
+	CreatedAt              time.Time      `json:"created_at"`
+	UpdatedAt              time.Time      `json:"-"`
+	DeletedAt              gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// ActiveAt reports whether the bridge should carry traffic at the given time
+func (b Bridge) ActiveAt(t time.Time) bool {
+	if !b.Enabled {
+		return false
+	}
+	if b.StartsAt != nil && t.Before(*b.StartsAt) {
+		return false
+	}
+	if b.EndsAt != nil && !t.Before(*b.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// Target returns the talkgroup that traffic on talkgroupID should be copied to
+func (b Bridge) Target(talkgroupID uint) (uint, bool) {
+	if b.SourceTalkgroupID == b.DestinationTalkgroupID {
+		return 0, false
+	}
+	if talkgroupID == b.SourceTalkgroupID {
+		return b.DestinationTalkgroupID, true
+	}
+	if b.Bidirectional && talkgroupID == b.DestinationTalkgroupID {
+		return b.SourceTalkgroupID, true
+	}
+	return 0, false
+}
+
+func ListBridges(db *gorm.DB) []Bridge {
+	var bridges []Bridge
+	db.Preload("SourceTalkgroup").Preload("DestinationTalkgroup").Order("id asc").Find(&bridges)
+	return bridges
+}
+
+func CountBridges(db *gorm.DB) int {
+	var count int64
+	db.Model(&Bridge{}).Count(&count)
+	return int(count)
+}
+
+func ListEnabledBridges(db *gorm.DB) []Bridge {
+	var bridges []Bridge
+	db.Where("enabled = ?", true).Order("id asc").Find(&bridges)
+	return bridges
+}
+
+func BridgeIDExists(db *gorm.DB, id uint) bool {
+	var count int64
+	db.Model(&Bridge{}).Where("id = ?", id).Limit(1).Count(&count)
+	return count > 0
+}
+
+func FindBridgeByID(db *gorm.DB, ID uint) Bridge {
+	var bridge Bridge
+	db.Preload("SourceTalkgroup").Preload("DestinationTalkgroup").First(&bridge, ID)
+	return bridge
+}
+
+func DeleteBridge(db *gorm.DB, id uint) {
+	db.Unscoped().Delete(&Bridge{ID: id})
+}
+
+// PublishBridgesReload tells every DMR server instance to reload its bridge rules
+func PublishBridgesReload(ctx context.Context, redis *redis.Client) {
+	_, err := redis.Publish(ctx, BridgesReloadChannel, "reload").Result()
+	if err != nil {
+		klog.Errorf("Error publishing bridge reload: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestBridgeActiveAt(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		bridge models.Bridge
+		want   bool
+	}{
+		{"disabled", models.Bridge{Enabled: false}, false},
+		{"no window", models.Bridge{Enabled: true}, true},
+		{"started", models.Bridge{Enabled: true, StartsAt: &before}, true},
+		{"not started", models.Bridge{Enabled: true, StartsAt: &after}, false},
+		{"ended", models.Bridge{Enabled: true, EndsAt: &before}, false},
+		{"not ended", models.Bridge{Enabled: true, EndsAt: &after}, true},
+		{"within window", models.Bridge{Enabled: true, StartsAt: &before, EndsAt: &after}, true},
+		{"ends now", models.Bridge{Enabled: true, StartsAt: &before, EndsAt: &now}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.bridge.ActiveAt(now); got != tt.want {
+			t.Errorf("%s: ActiveAt() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBridgeTarget(t *testing.T) {
+	oneWay := models.Bridge{SourceTalkgroupID: 3100, DestinationTalkgroupID: 31}
+	if tg, ok := oneWay.Target(3100); !ok || tg != 31 {
+		t.Errorf("Expected one-way bridge to target 31, got %d, %v", tg, ok)
+	}
+	if _, ok := oneWay.Target(31); ok {
+		t.Error("Expected one-way bridge not to carry traffic back to the source")
+	}
+	if _, ok := oneWay.Target(1); ok {
+		t.Error("Expected bridge not to match an unrelated talkgroup")
+	}
+
+	twoWay := models.Bridge{SourceTalkgroupID: 3100, DestinationTalkgroupID: 31, Bidirectional: true}
+	if tg, ok := twoWay.Target(31); !ok || tg != 3100 {
+		t.Errorf("Expected bidirectional bridge to target 3100, got %d, %v", tg, ok)
+	}
+
+	self := models.Bridge{SourceTalkgroupID: 1, DestinationTalkgroupID: 1, Bidirectional: true}
+	if _, ok := self.Target(1); ok {
+		t.Error("Expected a bridge onto its own talkgroup to be ignored")
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// CacheInvalidationChannel tells every instance to drop a cached repeater, user or talkgroup
+const CacheInvalidationChannel = "cache-invalidate"
+
+const (
+	CacheKindRepeater  = "repeater"
+	CacheKindUser      = "user"
+	CacheKindTalkgroup = "talkgroup"
+)
+
+type CacheInvalidation struct {
+	Kind string `json:"kind"`
+	ID   uint   `json:"id"`
+}
+
+func publishCacheInvalidation(ctx context.Context, redis *redis.Client, kind string, id uint) {
+	invalidationJSON, err := json.Marshal(CacheInvalidation{Kind: kind, ID: id})
+	if err != nil {
+		klog.Errorf("Error marshalling cache invalidation: %v", err)
+		return
+	}
+	_, err = redis.Publish(ctx, CacheInvalidationChannel, invalidationJSON).Result()
+	if err != nil {
+		klog.Errorf("Error publishing %s %d cache invalidation: %v", kind, id, err)
+	}
+}
+
+// InvalidateRepeaterCache should be called after a repeater, its talkgroups or its rewrites change
+func InvalidateRepeaterCache(ctx context.Context, redis *redis.Client, id uint) {
+	publishCacheInvalidation(ctx, redis, CacheKindRepeater, id)
+}
+
+func InvalidateUserCache(ctx context.Context, redis *redis.Client, id uint) {
+	publishCacheInvalidation(ctx, redis, CacheKindUser, id)
+}
+
+func InvalidateTalkgroupCache(ctx context.Context, redis *redis.Client, id uint) {
+	publishCacheInvalidation(ctx, redis, CacheKindTalkgroup, id)
+}
@@ -15,7 +15,7 @@ type Call struct {
 	User           User           `json:"user" gorm:"foreignKey:UserID"`
 	UserID         uint           `json:"-"`
 	Repeater       Repeater       `json:"repeater" gorm:"foreignKey:RepeaterID"`
-	RepeaterID     uint           `json:"-"`
+	RepeaterID     *uint          `json:"-"`
 	TimeSlot       bool           `json:"time_slot"`
 	GroupCall      bool           `json:"group_call"`
 	IsToTalkgroup  bool           `json:"is_to_talkgroup"`
@@ -32,13 +32,22 @@ type Call struct {
 	LostSequences  uint           `json:"-"`
 	Loss           float32        `json:"loss"`
 	Jitter         float32        `json:"jitter"`
+	JitterP95      float32        `json:"jitter_p95"`
+	JitterMax      float32        `json:"jitter_max"`
 	LastFrameNum   uint           `json:"-"`
 	BER            float32        `json:"ber"`
 	RSSI           float32        `json:"rssi"`
+	RSSIMin        float32        `json:"rssi_min"`
 	TotalBits      uint           `json:"-"`
+	ErroredBits    uint           `json:"-"`
+	Quality        CallQuality    `json:"-" gorm:"-"`
 	LastPacketTime time.Time      `json:"-"`
 	HasHeader      bool           `json:"-"`
 	HasTerm        bool           `json:"-"`
+	Blocked        uint           `json:"blocked"`
+	Preempted      uint           `json:"preempted"`
+	Rejected       bool           `json:"rejected"`
+	TimedOut       bool           `json:"timed_out"`
 	CreatedAt      time.Time      `json:"-"`
 	UpdatedAt      time.Time      `json:"-"`
 	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
@@ -99,6 +108,12 @@ func CountTalkgroupCalls(db *gorm.DB, talkgroupID uint) int {
 	return int(count)
 }
 
+func FindCallByID(db *gorm.DB, id uint) (Call, error) {
+	var call Call
+	err := db.Preload("User").Preload("Repeater").Preload("ToTalkgroup").Preload("ToUser").Preload("ToRepeater").First(&call, id).Error
+	return call, err
+}
+
 func FindActiveCall(db *gorm.DB, streamID uint, src uint, dst uint, slot bool, groupCall bool) (Call, error) {
 	var call Call
 	db.Preload("User").Preload("Repeater").Preload("ToTalkgroup").Preload("ToUser").Preload("ToRepeater").Where("stream_id = ? AND active = ? AND user_id = ? AND destination_id = ? AND time_slot = ? AND group_call = ?", streamID, true, src, dst, slot, groupCall).First(&call)
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// VoiceFrameBits is the number of bits in a voice burst the repeater counts errors against
+const VoiceFrameBits = 141
+
+// jitterBuckets holds jitter in 1ms steps, anything at or past the last bucket lands in it
+const jitterBuckets = 250
+
+// QualitySampleInterval is how much of a call each stored quality sample covers
+const QualitySampleInterval = 5 * time.Second
+
+// CallQuality accumulates the quality of a call as its packets arrive.
+// Jitter is how far each packet's arrival strayed from the 60ms DMR frame time.
+// RSSI is kept as the repeater reports it, the magnitude of a negative dBm value,
+// so RSSIMin, the weakest signal heard, is the largest value.
+type CallQuality struct {
+	JitterCount     uint                `json:"jitter_count"`
+	JitterSum       float64             `json:"jitter_sum"`
+	JitterMax       float32             `json:"jitter_max"`
+	JitterHistogram [jitterBuckets]uint `json:"jitter_histogram"`
+	ErroredBits     uint                `json:"errored_bits"`
+	TotalBits       uint                `json:"total_bits"`
+	RSSICount       uint                `json:"rssi_count"`
+	RSSISum         float64             `json:"rssi_sum"`
+	RSSIMin         float32             `json:"rssi_min"`
+	Samples         []CallQualitySample `json:"samples"`
+	Window          CallQualityWindow   `json:"window"`
+}
+
+// CallQualityWindow is where the running totals stood when the current sample started
+type CallQualityWindow struct {
+	Start         time.Time `json:"start"`
+	JitterCount   uint      `json:"jitter_count"`
+	JitterSum     float64   `json:"jitter_sum"`
+	ErroredBits   uint      `json:"errored_bits"`
+	TotalBits     uint      `json:"total_bits"`
+	RSSICount     uint      `json:"rssi_count"`
+	RSSISum       float64   `json:"rssi_sum"`
+	TotalPackets  uint      `json:"total_packets"`
+	LostSequences uint      `json:"lost_sequences"`
+}
+
+// CallQualitySample is the quality of one stretch of a call, kept per call and per source repeater
+type CallQualitySample struct {
+	ID         uint      `json:"-" gorm:"primarykey"`
+	CallID     uint      `json:"call_id" gorm:"index"`
+	RepeaterID *uint     `json:"-" gorm:"index"`
+	Time       time.Time `json:"time" gorm:"index"`
+	Jitter     float32   `json:"jitter"`
+	Loss       float32   `json:"loss"`
+	BER        float32   `json:"ber"`
+	RSSI       float32   `json:"rssi"`
+}
+
+// AddJitter records how long after the previous packet this one arrived
+func (q *CallQuality) AddJitter(elapsed time.Duration) {
+	jitter := math.Abs(float64(elapsed-60*time.Millisecond) / float64(time.Millisecond))
+	q.JitterCount++
+	q.JitterSum += jitter
+	if float32(jitter) > q.JitterMax {
+		q.JitterMax = float32(jitter)
+	}
+	bucket := int(jitter)
+	if bucket >= jitterBuckets {
+		bucket = jitterBuckets - 1
+	}
+	q.JitterHistogram[bucket]++
+}
+
+// AddBits records a voice burst and the number of its bits the repeater found in error
+func (q *CallQuality) AddBits(erroredBits uint) {
+	q.TotalBits += VoiceFrameBits
+	q.ErroredBits += erroredBits
+}
+
+func (q *CallQuality) AddRSSI(rssi int) {
+	q.RSSICount++
+	q.RSSISum += float64(rssi)
+	if float32(rssi) > q.RSSIMin {
+		q.RSSIMin = float32(rssi)
+	}
+}
+
+func (q *CallQuality) JitterMean() float32 {
+	if q.JitterCount == 0 {
+		return 0
+	}
+	return float32(q.JitterSum / float64(q.JitterCount))
+}
+
+// JitterP95 is the 95th percentile jitter, to the nearest millisecond
+func (q *CallQuality) JitterP95() float32 {
+	if q.JitterCount == 0 {
+		return 0
+	}
+	target := uint(math.Ceil(float64(q.JitterCount) * 0.95))
+	var seen uint
+	for bucket, count := range q.JitterHistogram {
+		seen += count
+		if seen >= target {
+			return float32(bucket)
+		}
+	}
+	return float32(jitterBuckets - 1)
+}
+
+// BER is the fraction of voice bits received in error
+func (q *CallQuality) BER() float32 {
+	if q.TotalBits == 0 {
+		return 0
+	}
+	return float32(q.ErroredBits) / float32(q.TotalBits)
+}
+
+func (q *CallQuality) RSSIAverage() float32 {
+	if q.RSSICount == 0 {
+		return 0
+	}
+	return float32(q.RSSISum / float64(q.RSSICount))
+}
+
+// Summarize copies the accumulated quality onto the call's stored metrics
+func (c *Call) Summarize() {
+	c.Jitter = c.Quality.JitterMean()
+	c.JitterP95 = c.Quality.JitterP95()
+	c.JitterMax = c.Quality.JitterMax
+	c.TotalBits = c.Quality.TotalBits
+	c.ErroredBits = c.Quality.ErroredBits
+	c.BER = c.Quality.BER()
+	c.RSSI = c.Quality.RSSIAverage()
+	c.RSSIMin = c.Quality.RSSIMin
+	if c.TotalPackets > 0 {
+		c.Loss = float32(c.LostSequences) / float32(c.TotalPackets)
+	}
+}
+
+// Sample closes the current window into a sample if it has run for QualitySampleInterval,
+// or unconditionally if force is set, as it is at the end of a call
+func (c *Call) Sample(now time.Time, force bool) {
+	q := &c.Quality
+	w := q.Window
+	if w.Start.IsZero() {
+		q.Window.Start = now
+		return
+	}
+	if !force && now.Sub(w.Start) < QualitySampleInterval {
+		return
+	}
+	if c.TotalPackets == w.TotalPackets {
+		// Nothing was heard in this window
+		q.Window.Start = now
+		return
+	}
+
+	sample := CallQualitySample{
+		CallID:     c.ID,
+		RepeaterID: c.RepeaterID,
+		Time:       w.Start,
+		Loss:       float32(c.LostSequences-w.LostSequences) / float32(c.TotalPackets-w.TotalPackets),
+	}
+	if jitterCount := q.JitterCount - w.JitterCount; jitterCount > 0 {
+		sample.Jitter = float32((q.JitterSum - w.JitterSum) / float64(jitterCount))
+	}
+	if totalBits := q.TotalBits - w.TotalBits; totalBits > 0 {
+		sample.BER = float32(q.ErroredBits-w.ErroredBits) / float32(totalBits)
+	}
+	if rssiCount := q.RSSICount - w.RSSICount; rssiCount > 0 {
+		sample.RSSI = float32((q.RSSISum - w.RSSISum) / float64(rssiCount))
+	}
+	q.Samples = append(q.Samples, sample)
+
+	q.Window = CallQualityWindow{
+		Start:         now,
+		JitterCount:   q.JitterCount,
+		JitterSum:     q.JitterSum,
+		ErroredBits:   q.ErroredBits,
+		TotalBits:     q.TotalBits,
+		RSSICount:     q.RSSICount,
+		RSSISum:       q.RSSISum,
+		TotalPackets:  c.TotalPackets,
+		LostSequences: c.LostSequences,
+	}
+}
+
+// RepeaterQuality summarizes the calls a repeater has sent over a period
+type RepeaterQuality struct {
+	Calls     int64   `json:"calls"`
+	Loss      float32 `json:"loss"`
+	Jitter    float32 `json:"jitter"`
+	JitterP95 float32 `json:"jitter_p95"`
+	JitterMax float32 `json:"jitter_max"`
+	BER       float32 `json:"ber"`
+	RSSI      float32 `json:"rssi"`
+	RSSIMin   float32 `json:"rssi_min"`
+}
+
+func FindRepeaterQuality(db *gorm.DB, repeaterID uint, since time.Time) RepeaterQuality {
+	var quality RepeaterQuality
+	db.Model(&Call{}).
+		Select("COUNT(*) AS calls, "+
+			"COALESCE(SUM(lost_sequences)::float / NULLIF(SUM(total_packets), 0), 0) AS loss, "+
+			"COALESCE(AVG(jitter), 0) AS jitter, "+
+			"COALESCE(AVG(jitter_p95), 0) AS jitter_p95, "+
+			"COALESCE(MAX(jitter_max), 0) AS jitter_max, "+
+			"COALESCE(SUM(errored_bits)::float / NULLIF(SUM(total_bits), 0), 0) AS ber, "+
+			"COALESCE(AVG(NULLIF(rssi, 0)), 0) AS rssi, "+
+			"COALESCE(MAX(rssi_min), 0) AS rssi_min").
+		Where("repeater_id = ? AND active = ? AND start_time >= ?", repeaterID, false, since).
+		Scan(&quality)
+	return quality
+}
+
+func FindRepeaterQualitySamples(db *gorm.DB, repeaterID uint, since time.Time) []CallQualitySample {
+	var samples []CallQualitySample
+	db.Where("repeater_id = ? AND time >= ?", repeaterID, since).Order("time asc").Find(&samples)
+	return samples
+}
@@ -0,0 +1,108 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestCallQualityJitter(t *testing.T) {
+	var quality models.CallQuality
+	// Early and late arrivals both count as jitter
+	quality.AddJitter(55 * time.Millisecond)
+	quality.AddJitter(65 * time.Millisecond)
+	for i := 0; i < 18; i++ {
+		quality.AddJitter(60 * time.Millisecond)
+	}
+	if mean := quality.JitterMean(); mean != 0.5 {
+		t.Errorf("Expected a mean jitter of 0.5ms, got %f", mean)
+	}
+	if p95 := quality.JitterP95(); p95 != 5 {
+		t.Errorf("Expected a p95 jitter of 5ms, got %f", p95)
+	}
+	if quality.JitterMax != 5 {
+		t.Errorf("Expected a max jitter of 5ms, got %f", quality.JitterMax)
+	}
+
+	// Stalls past the histogram still count at its top
+	quality.AddJitter(time.Second)
+	if quality.JitterMax != 940 {
+		t.Errorf("Expected a max jitter of 940ms, got %f", quality.JitterMax)
+	}
+	if p95 := quality.JitterP95(); p95 != 5 {
+		t.Errorf("Expected a p95 jitter of 5ms, got %f", p95)
+	}
+}
+
+func TestCallQualityBERCountsCleanFrames(t *testing.T) {
+	var quality models.CallQuality
+	quality.AddBits(14)
+	for i := 0; i < 9; i++ {
+		quality.AddBits(0)
+	}
+	want := float32(14) / float32(10*models.VoiceFrameBits)
+	if ber := quality.BER(); ber != want {
+		t.Errorf("Expected a BER of %f, got %f", want, ber)
+	}
+}
+
+func TestCallQualityRSSI(t *testing.T) {
+	var quality models.CallQuality
+	quality.AddRSSI(70)
+	quality.AddRSSI(90)
+	if rssi := quality.RSSIAverage(); rssi != 80 {
+		t.Errorf("Expected an average RSSI of 80, got %f", rssi)
+	}
+	if quality.RSSIMin != 90 {
+		t.Errorf("Expected the weakest RSSI to be 90, got %f", quality.RSSIMin)
+	}
+}
+
+func TestCallSummarizeLoss(t *testing.T) {
+	call := models.Call{TotalPackets: 200, LostSequences: 5}
+	call.Summarize()
+	if call.Loss != 0.025 {
+		t.Errorf("Expected a loss of 0.025, got %f", call.Loss)
+	}
+}
+
+func TestCallSampleWindows(t *testing.T) {
+	repeaterID := uint(311860)
+	call := models.Call{ID: 7, RepeaterID: &repeaterID}
+	start := time.Now()
+	call.Sample(start, false)
+
+	call.TotalPackets = 10
+	call.LostSequences = 1
+	call.Quality.AddJitter(62 * time.Millisecond)
+	call.Quality.AddBits(0)
+	call.Quality.AddRSSI(80)
+	call.Sample(start.Add(time.Second), false)
+	if len(call.Quality.Samples) != 0 {
+		t.Fatal("Sampled before the window was over")
+	}
+	call.Sample(start.Add(models.QualitySampleInterval), false)
+	if len(call.Quality.Samples) != 1 {
+		t.Fatalf("Expected 1 sample, got %d", len(call.Quality.Samples))
+	}
+	sample := call.Quality.Samples[0]
+	if sample.CallID != 7 || sample.RepeaterID == nil || *sample.RepeaterID != repeaterID || !sample.Time.Equal(start) {
+		t.Errorf("Sample %+v is not for the call's first window", sample)
+	}
+	if sample.Loss != 0.1 || sample.Jitter != 2 || sample.RSSI != 80 {
+		t.Errorf("Unexpected sample %+v", sample)
+	}
+
+	// A quiet window is skipped, and the end of the call closes a short one
+	call.Sample(start.Add(2*models.QualitySampleInterval), false)
+	call.TotalPackets = 20
+	call.Quality.AddBits(7)
+	call.Sample(start.Add(2*models.QualitySampleInterval+time.Second), true)
+	if len(call.Quality.Samples) != 2 {
+		t.Fatalf("Expected 2 samples, got %d", len(call.Quality.Samples))
+	}
+	if sample := call.Quality.Samples[1]; sample.Loss != 0 || sample.BER != float32(7)/models.VoiceFrameBits {
+		t.Errorf("Unexpected sample %+v", sample)
+	}
+}
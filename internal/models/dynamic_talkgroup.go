@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+func dynamicTalkgroupActivityKey(repeaterID uint, slot bool) string {
+	return fmt.Sprintf("dynamic-talkgroup:%d:%d", repeaterID, SlotNumber(slot))
+}
+
+// TouchDynamicTalkgroup records local activity on a repeater's slot, restarting its dynamic talkgroup timeout
+func TouchDynamicTalkgroup(ctx context.Context, redis *redis.Client, repeaterID uint, slot bool) {
+	err := redis.Set(ctx, dynamicTalkgroupActivityKey(repeaterID, slot), time.Now().Unix(), 0).Err()
+	if err != nil {
+		klog.Errorf("Error recording dynamic talkgroup activity for %d: %v", repeaterID, err)
+	}
+}
+
+// ClearDynamicTalkgroupActivity forgets the activity on a repeater's slot once its dynamic talkgroup is unlinked
+func ClearDynamicTalkgroupActivity(ctx context.Context, redis *redis.Client, repeaterID uint, slot bool) {
+	redis.Del(ctx, dynamicTalkgroupActivityKey(repeaterID, slot))
+}
+
+// DynamicTalkgroupLastActivity returns when a repeater's slot last had local activity, if it has been recorded
+func DynamicTalkgroupLastActivity(ctx context.Context, redisClient *redis.Client, repeaterID uint, slot bool) (time.Time, bool) {
+	lastActivityStr, err := redisClient.Get(ctx, dynamicTalkgroupActivityKey(repeaterID, slot)).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			klog.Errorf("Error getting dynamic talkgroup activity for %d: %v", repeaterID, err)
+		}
+		return time.Time{}, false
+	}
+	lastActivity, err := strconv.ParseInt(lastActivityStr, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(lastActivity, 0), true
+}
+
+// EffectiveDynamicTalkgroupTimeout picks the repeater's TIMER= option, then its
+// own override, then the network default. Zero means never unlink.
+func (p Repeater) EffectiveDynamicTalkgroupTimeout(optionsTimer *uint) time.Duration {
+	if optionsTimer != nil {
+		return time.Duration(*optionsTimer) * time.Minute
+	}
+	if p.DynamicTalkgroupTimeout != nil {
+		return time.Duration(*p.DynamicTalkgroupTimeout) * time.Minute
+	}
+	return CurrentAppSettings().DynamicTalkgroupTimeoutDuration()
+}
+
+// dynamicTalkgroupRemaining returns the seconds left before a slot's dynamic talkgroup is unlinked,
+// or nil when nothing is linked or the link never times out
+func (p Repeater) dynamicTalkgroupRemaining(ctx context.Context, redis *redis.Client, slot bool, optionsTimer *uint) *uint {
+	if (slot && p.TS2DynamicTalkgroupID == nil) || (!slot && p.TS1DynamicTalkgroupID == nil) {
+		return nil
+	}
+	timeout := p.EffectiveDynamicTalkgroupTimeout(optionsTimer)
+	if timeout == 0 {
+		return nil
+	}
+	remaining := timeout
+	if lastActivity, ok := DynamicTalkgroupLastActivity(ctx, redis, p.RadioID, slot); ok {
+		remaining = timeout - time.Since(lastActivity)
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	seconds := uint(remaining.Seconds())
+	return &seconds
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What an email token is good for
+const (
+	EmailTokenVerify        = "verify"
+	EmailTokenPasswordReset = "password_reset"
+)
+
+const (
+	EmailVerificationTTL = 48 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+var ErrEmailTokenInvalid = errors.New("token is invalid, expired or already used")
+
+// EmailToken is a single use token sent to a user by email. Only its hash is stored.
+type EmailToken struct {
+	ID      uint   `gorm:"primarykey"`
+	UserID  uint   `gorm:"index"`
+	Purpose string `gorm:"index"`
+	Hash    string `gorm:"uniqueIndex"`
+	// Email is the address the token was sent to, a verification only counts for that address
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func hashEmailToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateEmailToken makes a new token for the user, returning the token to put in the email.
+// Earlier unused tokens for the same purpose stop working.
+func CreateEmailToken(db *gorm.DB, userID uint, purpose string, email string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&EmailToken{}).Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&EmailToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			Hash:      hashEmailToken(token),
+			Email:     email,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeEmailToken uses up a token, failing if it was already used, has expired or is for something else
+func ConsumeEmailToken(db *gorm.DB, token string, purpose string) (EmailToken, error) {
+	var emailToken EmailToken
+	now := time.Now()
+	result := db.Model(&EmailToken{}).
+		Where("hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hashEmailToken(token), purpose, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return emailToken, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return emailToken, ErrEmailTokenInvalid
+	}
+	db.Where("hash = ?", hashEmailToken(token)).Limit(1).Find(&emailToken)
+	return emailToken, nil
+}
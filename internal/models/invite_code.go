@@ -0,0 +1,92 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// inviteCodeAlphabet leaves out characters that are easy to mix up when read aloud or copied by hand
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var ErrInviteCodeInvalid = errors.New("invite code is invalid, used up or expired")
+
+// InviteCode lets someone register while registration is invite only
+type InviteCode struct {
+	ID   uint   `json:"id" gorm:"primarykey"`
+	Code string `json:"code" gorm:"uniqueIndex"`
+	Note string `json:"note"`
+	// MaxUses is how many registrations the code is good for, 0 for no limit
+	MaxUses     uint       `json:"max_uses"`
+	Uses        uint       `json:"uses"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedByID uint       `json:"created_by_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the code can still be redeemed
+func (i InviteCode) Usable(now time.Time) bool {
+	if i.MaxUses != 0 && i.Uses >= i.MaxUses {
+		return false
+	}
+	return i.ExpiresAt == nil || now.Before(*i.ExpiresAt)
+}
+
+// GenerateInviteCode returns a random code formatted like XXXX-XXXX-XXXX
+func GenerateInviteCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(inviteCodeAlphabet)))
+	for i := 0; i < 12; i++ {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(inviteCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// NormalizeInviteCode lets people type codes in lowercase or with stray spaces
+func NormalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func ListInviteCodes(db *gorm.DB) []InviteCode {
+	var inviteCodes []InviteCode
+	db.Order("created_at desc").Find(&inviteCodes)
+	return inviteCodes
+}
+
+func CountInviteCodes(db *gorm.DB) int {
+	var count int64
+	db.Model(&InviteCode{}).Count(&count)
+	return int(count)
+}
+
+func FindInviteCodeByID(db *gorm.DB, id uint) InviteCode {
+	var inviteCode InviteCode
+	db.Find(&inviteCode, "id = ?", id)
+	return inviteCode
+}
+
+// RedeemInviteCode uses up one registration from the code. The check and the count happen in one
+// update, so two people can't both take the last use.
+func RedeemInviteCode(db *gorm.DB, code string, now time.Time) error {
+	result := db.Model(&InviteCode{}).
+		Where("code = ? AND (max_uses = 0 OR uses < max_uses) AND (expires_at IS NULL OR expires_at > ?)", NormalizeInviteCode(code), now).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return ErrInviteCodeInvalid
+	}
+	return nil
+}
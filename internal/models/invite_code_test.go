@@ -0,0 +1,44 @@
+package models_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestGenerateInviteCode(t *testing.T) {
+	code, err := models.GenerateInviteCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[A-Z2-9]{4}-[A-Z2-9]{4}-[A-Z2-9]{4}$`).MatchString(code) {
+		t.Errorf("Unexpected invite code %s", code)
+	}
+	if models.NormalizeInviteCode(" "+code+"\n") != code {
+		t.Error("Normalizing a code changed it")
+	}
+}
+
+func TestInviteCodeUsable(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	tests := []struct {
+		name   string
+		invite models.InviteCode
+		want   bool
+	}{
+		{"unlimited", models.InviteCode{Uses: 50}, true},
+		{"single use unused", models.InviteCode{MaxUses: 1}, true},
+		{"single use used", models.InviteCode{MaxUses: 1, Uses: 1}, false},
+		{"not yet expired", models.InviteCode{MaxUses: 5, Uses: 4, ExpiresAt: &future}, true},
+		{"expired", models.InviteCode{ExpiresAt: &past}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.invite.Usable(now); got != tt.want {
+			t.Errorf("%s: Usable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// An account is locked for LoginLockoutWindow once it has LoginLockoutAttempts failed
+// logins within that window, no matter which address they come from.
+const (
+	LoginLockoutAttempts = 10
+	LoginLockoutWindow   = 15 * time.Minute
+)
+
+const loginFailuresPrefix = "login-failures:"
+
+func loginFailuresKey(userID uint) string {
+	return fmt.Sprintf("%s%d", loginFailuresPrefix, userID)
+}
+
+// LoginLocked reports whether the account has too many recent failed logins to try again
+func LoginLocked(ctx context.Context, redis *redis.Client, userID uint) bool {
+	failures, err := redis.Get(ctx, loginFailuresKey(userID)).Int()
+	if err != nil {
+		return false
+	}
+	return failures >= LoginLockoutAttempts
+}
+
+// RecordLoginFailure counts a failed login against the account. The window starts at the first failure.
+func RecordLoginFailure(ctx context.Context, redis *redis.Client, userID uint) {
+	key := loginFailuresKey(userID)
+	failures, err := redis.Incr(ctx, key).Result()
+	if err == nil && failures == 1 {
+		err = redis.Expire(ctx, key, LoginLockoutWindow).Err()
+	}
+	if err != nil {
+		klog.Errorf("Error recording failed login for user %d: %v", userID, err)
+		return
+	}
+	if failures == LoginLockoutAttempts {
+		klog.Infof("User %d is locked out after %d failed logins", userID, LoginLockoutAttempts)
+	}
+}
+
+// ClearLoginFailures resets the count after a successful login
+func ClearLoginFailures(ctx context.Context, redis *redis.Client, userID uint) {
+	err := redis.Del(ctx, loginFailuresKey(userID)).Err()
+	if err != nil {
+		klog.Errorf("Error clearing failed logins for user %d: %v", userID, err)
+	}
+}
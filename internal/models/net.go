@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// Net is a net control session opened by a net control operator on a talkgroup
+type Net struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	TalkgroupID uint           `json:"-"`
+	Talkgroup   Talkgroup      `json:"talkgroup" gorm:"foreignKey:TalkgroupID"`
+	StartedByID uint           `json:"-"`
+	StartedBy   User           `json:"started_by" gorm:"foreignKey:StartedByID"`
+	Description string         `json:"description"`
+	StartTime   time.Time      `json:"start_time"`
+	EndTime     *time.Time     `json:"end_time"`
+	Active      bool           `json:"active"`
+	CheckIns    []NetCheckIn   `json:"-" gorm:"foreignKey:NetID"`
+	CreatedAt   time.Time      `json:"-"`
+	UpdatedAt   time.Time      `json:"-"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// NetCheckIn is a station heard on the talkgroup while a net was active
+type NetCheckIn struct {
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	NetID            uint           `json:"net_id" gorm:"index"`
+	UserID           uint           `json:"user_id"`
+	Callsign         string         `json:"callsign"`
+	Name             string         `json:"name"`
+	RepeaterID       uint           `json:"repeater_id"`
+	RepeaterCallsign string         `json:"repeater_callsign"`
+	Calls            uint           `json:"calls"`
+	FirstHeard       time.Time      `json:"first_heard"`
+	LastHeard        time.Time      `json:"last_heard"`
+	Notes            string         `json:"notes"`
+	CreatedAt        time.Time      `json:"-"`
+	UpdatedAt        time.Time      `json:"-"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Net event types published on the "nets:<id>" Redis channel
+const (
+	NetEventStarted       = "started"
+	NetEventCheckIn       = "check_in"
+	NetEventCheckInUpdate = "check_in_update"
+	NetEventCheckInDelete = "check_in_delete"
+	NetEventClosed        = "closed"
+)
+
+// NetEvent is published to Redis whenever a net's check-in log changes
+type NetEvent struct {
+	Type    string      `json:"type"`
+	NetID   uint        `json:"net_id"`
+	CheckIn *NetCheckIn `json:"check_in,omitempty"`
+}
+
+func PublishNetEvent(ctx context.Context, redis *redis.Client, event NetEvent) {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		klog.Errorf("Error marshalling net event: %v", err)
+		return
+	}
+	_, err = redis.Publish(ctx, fmt.Sprintf("nets:%d", event.NetID), eventJSON).Result()
+	if err != nil {
+		klog.Errorf("Error publishing net event: %v", err)
+	}
+}
+
+func ListNets(db *gorm.DB) []Net {
+	var nets []Net
+	db.Preload("Talkgroup").Preload("StartedBy").Order("start_time desc").Find(&nets)
+	return nets
+}
+
+func CountNets(db *gorm.DB) int {
+	var count int64
+	db.Model(&Net{}).Count(&count)
+	return int(count)
+}
+
+func ListActiveNets(db *gorm.DB) []Net {
+	var nets []Net
+	db.Preload("Talkgroup").Preload("StartedBy").Where("active = ?", true).Order("start_time desc").Find(&nets)
+	return nets
+}
+
+func CountActiveNets(db *gorm.DB) int {
+	var count int64
+	db.Model(&Net{}).Where("active = ?", true).Count(&count)
+	return int(count)
+}
+
+func NetIDExists(db *gorm.DB, id uint) bool {
+	var count int64
+	db.Model(&Net{}).Where("id = ?", id).Limit(1).Count(&count)
+	return count > 0
+}
+
+func FindNetByID(db *gorm.DB, ID uint) Net {
+	var net Net
+	db.Preload("Talkgroup").Preload("StartedBy").First(&net, ID)
+	return net
+}
+
+func ActiveNetExistsForTalkgroup(db *gorm.DB, talkgroupID uint) bool {
+	var count int64
+	db.Model(&Net{}).Where("talkgroup_id = ? AND active = ?", talkgroupID, true).Limit(1).Count(&count)
+	return count > 0
+}
+
+func FindActiveNetForTalkgroup(db *gorm.DB, talkgroupID uint) Net {
+	var net Net
+	db.Preload("Talkgroup").Preload("StartedBy").Where("talkgroup_id = ? AND active = ?", talkgroupID, true).First(&net)
+	return net
+}
+
+func FindNetCheckIns(db *gorm.DB, netID uint) []NetCheckIn {
+	var checkIns []NetCheckIn
+	db.Where("net_id = ?", netID).Order("first_heard asc").Find(&checkIns)
+	return checkIns
+}
+
+func CountNetCheckIns(db *gorm.DB, netID uint) int {
+	var count int64
+	db.Model(&NetCheckIn{}).Where("net_id = ?", netID).Count(&count)
+	return int(count)
+}
+
+func FindNetCheckIn(db *gorm.DB, netID uint, ID uint) NetCheckIn {
+	var checkIn NetCheckIn
+	db.Where("net_id = ?", netID).First(&checkIn, ID)
+	return checkIn
+}
+
+func FindNetCheckInByUser(db *gorm.DB, netID uint, userID uint) NetCheckIn {
+	var checkIn NetCheckIn
+	db.Where("net_id = ? AND user_id = ?", netID, userID).First(&checkIn)
+	return checkIn
+}
+
+func deleteNets(tx *gorm.DB, where string, args ...interface{}) {
+	var nets []Net
+	tx.Unscoped().Where(where, args...).Find(&nets)
+	for _, net := range nets {
+		tx.Unscoped().Where("net_id = ?", net.ID).Delete(&NetCheckIn{})
+		tx.Unscoped().Delete(&Net{ID: net.ID})
+	}
+}
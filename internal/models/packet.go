@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 
+	"github.com/USA-RedDragon/DMRHub/internal/dmr/lc"
 	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
 )
 
@@ -151,3 +152,9 @@ func (p *Packet) Encode() []byte {
 	}
 	return data
 }
+
+// UpdateLC re-encodes the link control in the burst to match the packet's
+// source and destination, after either has been rewritten
+func (p *Packet) UpdateLC() {
+	lc.Rewrite(&p.DMRData, p.FrameType, p.DTypeOrVSeq, p.GroupCall, p.Src, p.Dst)
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Radio verification codes are 8 digit private call IDs that still fit in a 24 bit DMR ID.
+// Calls to them are never routed, users have 7 digit IDs and repeaters 6 or 9 digits.
+const (
+	RadioVerificationMinID = 10000000
+	RadioVerificationMaxID = 16777215
+	RadioVerificationTTL   = 30 * time.Minute
+)
+
+const (
+	radioVerificationPrefix     = "radio-verification:"
+	radioVerificationUserPrefix = "radio-verification-user:"
+)
+
+var ErrRadioVerificationCode = errors.New("could not find a free radio verification code")
+
+func IsRadioVerificationID(id uint) bool {
+	return id >= RadioVerificationMinID && id <= RadioVerificationMaxID
+}
+
+// CreateRadioVerification gives the user a new code to private call from their radio, replacing any earlier one
+func CreateRadioVerification(ctx context.Context, redis *redis.Client, userID uint) (uint, error) {
+	userKey := fmt.Sprintf("%s%d", radioVerificationUserPrefix, userID)
+	if previous, err := redis.Get(ctx, userKey).Result(); err == nil {
+		redis.Del(ctx, radioVerificationPrefix+previous)
+	}
+	span := big.NewInt(RadioVerificationMaxID - RadioVerificationMinID + 1)
+	for i := 0; i < 10; i++ {
+		n, err := rand.Int(rand.Reader, span)
+		if err != nil {
+			return 0, err
+		}
+		code := uint(n.Int64()) + RadioVerificationMinID
+		ok, err := redis.SetNX(ctx, fmt.Sprintf("%s%d", radioVerificationPrefix, code), userID, RadioVerificationTTL).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			err = redis.Set(ctx, userKey, code, RadioVerificationTTL).Err()
+			if err != nil {
+				return 0, err
+			}
+			return code, nil
+		}
+	}
+	return 0, ErrRadioVerificationCode
+}
+
+// ClaimRadioVerification uses up the code if it was handed out to src.
+// Only one caller gets true, even with every instance seeing the same call.
+func ClaimRadioVerification(ctx context.Context, redis *redis.Client, code uint, src uint) bool {
+	key := fmt.Sprintf("%s%d", radioVerificationPrefix, code)
+	owner, err := redis.Get(ctx, key).Result()
+	if err != nil || owner != strconv.FormatUint(uint64(src), 10) {
+		return false
+	}
+	deleted, err := redis.Del(ctx, key).Result()
+	if err != nil || deleted != 1 {
+		return false
+	}
+	redis.Del(ctx, fmt.Sprintf("%s%d", radioVerificationUserPrefix, src))
+	return true
+}
+
+// MarkRadioVerified records that the user proved they control their DMR ID, which approves them too
+func MarkRadioVerified(db *gorm.DB, userID uint) error {
+	return db.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"radio_verified": true,
+		"approved":       true,
+	}).Error
+}
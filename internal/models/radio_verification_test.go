@@ -0,0 +1,40 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/USA-RedDragon/DMRHub/internal/repeaterdb"
+	"github.com/USA-RedDragon/DMRHub/internal/userdb"
+)
+
+func TestIsRadioVerificationID(t *testing.T) {
+	tests := []struct {
+		id   uint
+		want bool
+	}{
+		{9999999, false},
+		{models.RadioVerificationMinID, true},
+		{12345678, true},
+		{models.RadioVerificationMaxID, true},
+		{models.RadioVerificationMaxID + 1, false},
+		{311860, false},
+		{311860101, false},
+	}
+	for _, tt := range tests {
+		if got := models.IsRadioVerificationID(tt.id); got != tt.want {
+			t.Errorf("IsRadioVerificationID(%d) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestRadioVerificationIDsAreNotRoutable(t *testing.T) {
+	for _, id := range []uint{models.RadioVerificationMinID, models.RadioVerificationMaxID} {
+		if userdb.IsValidUserID(id) {
+			t.Errorf("Radio verification ID %d is a valid user ID", id)
+		}
+		if repeaterdb.IsValidRepeaterID(id) {
+			t.Errorf("Radio verification ID %d is a valid repeater ID", id)
+		}
+	}
+}
@@ -7,4 +7,6 @@ type RawDMRPacket struct {
 	Data       []byte `msg:"data"`
 	RemoteIP   string `msg:"remote_ip"`
 	RemotePort int    `msg:"remote_port"`
+	// BridgedFrom is the talkgroup this packet was copied from by a bridge, or 0
+	BridgedFrom uint `msg:"bridged_from"`
 }
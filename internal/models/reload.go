@@ -0,0 +1,37 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// ReloadInterval is how often anything kept in memory is reloaded in case a reload message was missed
+const ReloadInterval = 5 * time.Minute
+
+// WatchReload calls reload whenever a message is published to the channel, and on the interval.
+// It returns once the context is done.
+func WatchReload(ctx context.Context, redis *redis.Client, channel string, interval time.Duration, reload func()) {
+	pubsub := redis.Subscribe(ctx, channel)
+	defer func() {
+		err := pubsub.Close()
+		if err != nil {
+			klog.Errorf("Error closing pubsub: %v", err)
+		}
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pubsubChannel := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pubsubChannel:
+			reload()
+		case <-ticker.C:
+			reload()
+		}
+	}
+}
@@ -18,47 +18,67 @@ import (
 //
 //go:generate msgp
 type Repeater struct {
-	RadioID               uint           `json:"id" gorm:"primaryKey" msg:"radio_id"`
-	Connection            string         `json:"-" gorm:"-" msg:"connection"`
-	Connected             time.Time      `json:"connected_time" msg:"connected"`
-	PingsReceived         uint           `json:"-" gorm:"-" msg:"pings_received"`
-	LastPing              time.Time      `json:"last_ping_time" msg:"last_ping"`
-	IP                    string         `json:"-" gorm:"-" msg:"ip"`
-	Port                  int            `json:"-" gorm:"-" msg:"port"`
-	Salt                  uint32         `json:"-" gorm:"-" msg:"salt"`
-	Callsign              string         `json:"callsign" msg:"callsign"`
-	RXFrequency           uint           `json:"rx_frequency" msg:"rx_frequency"`
-	TXFrequency           uint           `json:"tx_frequency" msg:"tx_frequency"`
-	TXPower               uint           `json:"tx_power" msg:"tx_power"`
-	ColorCode             uint           `json:"color_code" msg:"color_code"`
-	Latitude              float32        `json:"latitude" msg:"latitude"`
-	Longitude             float32        `json:"longitude" msg:"longitude"`
-	Height                int            `json:"height" msg:"height"`
-	Location              string         `json:"location" msg:"location"`
-	Description           string         `json:"description" msg:"description"`
-	Slots                 uint           `json:"slots" msg:"slots"`
-	URL                   string         `json:"url" msg:"url"`
-	SoftwareID            string         `json:"software_id" msg:"software_id"`
-	PackageID             string         `json:"package_id" msg:"package_id"`
-	Password              string         `json:"-" msg:"-"`
-	TS1StaticTalkgroups   []Talkgroup    `json:"ts1_static_talkgroups" gorm:"many2many:repeater_ts1_static_talkgroups;" msg:"-"`
-	TS2StaticTalkgroups   []Talkgroup    `json:"ts2_static_talkgroups" gorm:"many2many:repeater_ts2_static_talkgroups;" msg:"-"`
-	TS1DynamicTalkgroupID *uint          `json:"-" msg:"-"`
-	TS2DynamicTalkgroupID *uint          `json:"-" msg:"-"`
-	TS1DynamicTalkgroup   Talkgroup      `json:"ts1_dynamic_talkgroup" gorm:"foreignKey:TS1DynamicTalkgroupID" msg:"-"`
-	TS2DynamicTalkgroup   Talkgroup      `json:"ts2_dynamic_talkgroup" gorm:"foreignKey:TS2DynamicTalkgroupID" msg:"-"`
-	Owner                 User           `json:"owner" gorm:"foreignKey:OwnerID" msg:"-"`
-	OwnerID               uint           `json:"-" msg:"-"`
-	Hotspot               bool           `json:"hotspot" msg:"hotspot"`
-	CreatedAt             time.Time      `json:"created_at" msg:"-"`
-	UpdatedAt             time.Time      `json:"-" msg:"-"`
-	DeletedAt             gorm.DeletedAt `json:"-" gorm:"index" msg:"-"`
+	RadioID                      uint              `json:"id" gorm:"primaryKey" msg:"radio_id"`
+	Connection                   string            `json:"-" gorm:"-" msg:"connection"`
+	Connected                    time.Time         `json:"connected_time" msg:"connected"`
+	PingsReceived                uint              `json:"-" gorm:"-" msg:"pings_received"`
+	LastPing                     time.Time         `json:"last_ping_time" msg:"last_ping"`
+	IP                           string            `json:"-" gorm:"-" msg:"ip"`
+	Port                         int               `json:"-" gorm:"-" msg:"port"`
+	Salt                         uint32            `json:"-" gorm:"-" msg:"salt"`
+	Callsign                     string            `json:"callsign" msg:"callsign"`
+	RXFrequency                  uint              `json:"rx_frequency" msg:"rx_frequency"`
+	TXFrequency                  uint              `json:"tx_frequency" msg:"tx_frequency"`
+	TXPower                      uint              `json:"tx_power" msg:"tx_power"`
+	ColorCode                    uint              `json:"color_code" msg:"color_code"`
+	Latitude                     float32           `json:"latitude" msg:"latitude"`
+	Longitude                    float32           `json:"longitude" msg:"longitude"`
+	Height                       int               `json:"height" msg:"height"`
+	Location                     string            `json:"location" msg:"location"`
+	Description                  string            `json:"description" msg:"description"`
+	Slots                        uint              `json:"slots" msg:"slots"`
+	URL                          string            `json:"url" msg:"url"`
+	SoftwareID                   string            `json:"software_id" msg:"software_id"`
+	PackageID                    string            `json:"package_id" msg:"package_id"`
+	Password                     string            `json:"-" msg:"-"`
+	TS1StaticTalkgroups          []Talkgroup       `json:"ts1_static_talkgroups" gorm:"many2many:repeater_ts1_static_talkgroups;" msg:"-"`
+	TS2StaticTalkgroups          []Talkgroup       `json:"ts2_static_talkgroups" gorm:"many2many:repeater_ts2_static_talkgroups;" msg:"-"`
+	TS1DynamicTalkgroupID        *uint             `json:"-" msg:"-"`
+	TS2DynamicTalkgroupID        *uint             `json:"-" msg:"-"`
+	TS1DynamicTalkgroup          Talkgroup         `json:"ts1_dynamic_talkgroup" gorm:"foreignKey:TS1DynamicTalkgroupID" msg:"-"`
+	TS2DynamicTalkgroup          Talkgroup         `json:"ts2_dynamic_talkgroup" gorm:"foreignKey:TS2DynamicTalkgroupID" msg:"-"`
+	DynamicTalkgroupTimeout      *uint             `json:"dynamic_talkgroup_timeout" msg:"-"`
+	TS1DynamicTalkgroupRemaining *uint             `json:"ts1_dynamic_talkgroup_remaining,omitempty" gorm:"-" msg:"-"`
+	TS2DynamicTalkgroupRemaining *uint             `json:"ts2_dynamic_talkgroup_remaining,omitempty" gorm:"-" msg:"-"`
+	OptionsTimer                 *uint             `json:"-" gorm:"-" msg:"options_timer"`
+	Owner                        User              `json:"owner" gorm:"foreignKey:OwnerID" msg:"-"`
+	OwnerID                      uint              `json:"-" msg:"-"`
+	Hotspot                      bool              `json:"hotspot" msg:"hotspot"`
+	Rewrites                     []RepeaterRewrite `json:"rewrites" gorm:"foreignKey:RepeaterID" msg:"-"`
+	State                        *RepeaterState    `json:"state,omitempty" gorm:"-" msg:"-"`
+	CreatedAt                    time.Time         `json:"created_at" msg:"-"`
+	UpdatedAt                    time.Time         `json:"-" msg:"-"`
+	DeletedAt                    gorm.DeletedAt    `json:"-" gorm:"index" msg:"-"`
 }
 
 var talkgroupSubscriptions = make(map[uint]map[uint]context.CancelFunc)
 var talkgroupSubscriptionsMutex = &sync.RWMutex{}
 var subscriptionCancelMutex = make(map[uint]map[uint]*sync.RWMutex)
 
+// Rewrite rules are kept outside of the subscription goroutines' copies of the
+// repeater so that rule changes apply to subscriptions that are already running.
+// ListenForCalls refreshes them, the DMR server calls it again whenever the
+// repeater is invalidated on any instance.
+var repeaterRewrites = make(map[uint][]RepeaterRewrite)
+var repeaterRewritesMutex = &sync.RWMutex{}
+
+// ListeningForCalls reports whether this instance has subscriptions running for the repeater
+func ListeningForCalls(repeaterID uint) bool {
+	talkgroupSubscriptionsMutex.RLock()
+	defer talkgroupSubscriptionsMutex.RUnlock()
+	return len(talkgroupSubscriptions[repeaterID]) > 0
+}
+
 func (p Repeater) CancelSubscription(talkgroupID uint) {
 	talkgroupSubscriptionsMutex.RLock()
 	subscriptionCancelMutex[p.RadioID][talkgroupID].RLock()
@@ -84,6 +104,11 @@ func (p Repeater) CancelSubscription(talkgroupID uint) {
 				return
 			}
 		}
+		for _, rewrite := range p.Rewrites {
+			if rewrite.NetworkTalkgroupID == talkgroupID {
+				return
+			}
+		}
 		talkgroupSubscriptionsMutex.Lock()
 		subscriptionCancelMutex[p.RadioID][talkgroupID].Lock()
 		delete(talkgroupSubscriptions[p.RadioID], talkgroupID)
@@ -131,6 +156,10 @@ func (p Repeater) ListenForCalls(ctx context.Context, redis *redis.Client) {
 	// This channel is used to get private calls headed to this repeater
 	// When a packet is received, we need to publish it to "outgoing" channel
 	// with the destination repeater ID as this one
+	repeaterRewritesMutex.Lock()
+	repeaterRewrites[p.RadioID] = p.Rewrites
+	repeaterRewritesMutex.Unlock()
+
 	talkgroupSubscriptionsMutex.RLock()
 	_, ok := talkgroupSubscriptions[p.RadioID]
 	talkgroupSubscriptionsMutex.RUnlock()
@@ -194,6 +223,24 @@ func (p Repeater) ListenForCalls(ctx context.Context, redis *redis.Client) {
 			go p.subscribeTG(newCtx, redis, tg.ID)
 		}
 	}
+	for _, rewrite := range p.Rewrites {
+		talkgroupSubscriptionsMutex.RLock()
+		_, ok := talkgroupSubscriptions[p.RadioID][rewrite.NetworkTalkgroupID]
+		talkgroupSubscriptionsMutex.RUnlock()
+		if !ok {
+			newCtx, cancel := context.WithCancel(context.Background())
+			talkgroupSubscriptionsMutex.Lock()
+			_, ok = subscriptionCancelMutex[p.RadioID][rewrite.NetworkTalkgroupID]
+			if !ok {
+				subscriptionCancelMutex[p.RadioID][rewrite.NetworkTalkgroupID] = &sync.RWMutex{}
+			}
+			subscriptionCancelMutex[p.RadioID][rewrite.NetworkTalkgroupID].Lock()
+			talkgroupSubscriptions[p.RadioID][rewrite.NetworkTalkgroupID] = cancel
+			subscriptionCancelMutex[p.RadioID][rewrite.NetworkTalkgroupID].Unlock()
+			talkgroupSubscriptionsMutex.Unlock()
+			go p.subscribeTG(newCtx, redis, rewrite.NetworkTalkgroupID)
+		}
+	}
 	if p.TS1DynamicTalkgroupID != nil {
 		talkgroupSubscriptionsMutex.RLock()
 		_, ok := talkgroupSubscriptions[p.RadioID][*p.TS1DynamicTalkgroupID]
@@ -275,6 +322,9 @@ func (p *Repeater) subscribeRepeater(ctx context.Context, redis *redis.Client) {
 			}
 			// This packet is already for us and we don't want to modify the slot
 			packet := UnpackPacket(rawPacket.Data)
+			if !ClaimSlot(ctx, redis, p.RadioID, packet, false) {
+				continue
+			}
 			packet.Repeater = p.RadioID
 			redis.Publish(ctx, "outgoing:noaddr", packet.Encode())
 		}
@@ -332,12 +382,34 @@ func (p *Repeater) subscribeTG(ctx context.Context, redis *redis.Client, tg uint
 				continue
 			}
 
+			if rawPacket.BridgedFrom != 0 {
+				// If we're also linked to the talkgroup this was bridged from, we already
+				// receive the original stream and would otherwise get it twice
+				original := packet
+				original.Dst = rawPacket.BridgedFrom
+				if wantOriginal, _ := p.WantRX(original); wantOriginal {
+					continue
+				}
+			}
+
+			if p.RewriteEgress(&packet) {
+				if !ClaimSlot(ctx, redis, p.RadioID, packet, false) {
+					continue
+				}
+				packet.Repeater = p.RadioID
+				redis.Publish(ctx, "outgoing:noaddr", packet.Encode())
+				continue
+			}
+
 			want, slot := p.WantRX(packet)
 			if want {
 				// This packet is for the repeater's dynamic talkgroup
 				// We need to send it to the repeater
 				packet.Repeater = p.RadioID
 				packet.Slot = slot
+				if !ClaimSlot(ctx, redis, p.RadioID, packet, false) {
+					continue
+				}
 				redis.Publish(ctx, "outgoing:noaddr", packet.Encode())
 			} else {
 				// We're subscribed but don't want this packet? With a talkgroup that can only mean we're unlinked, so we should unsubscribe
@@ -366,7 +438,7 @@ func (p *Repeater) String() string {
 
 func ListRepeaters(db *gorm.DB) []Repeater {
 	var repeaters []Repeater
-	db.Preload("Owner").Preload("TS1DynamicTalkgroup").Preload("TS2DynamicTalkgroup").Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Order("radio_id asc").Find(&repeaters)
+	db.Preload("Owner").Preload("TS1DynamicTalkgroup").Preload("TS2DynamicTalkgroup").Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Preload("Rewrites").Order("radio_id asc").Find(&repeaters)
 	return repeaters
 }
 
@@ -376,9 +448,15 @@ func CountRepeaters(db *gorm.DB) int {
 	return int(count)
 }
 
+func ListRepeatersWithDynamicTalkgroups(db *gorm.DB) []Repeater {
+	var repeaters []Repeater
+	db.Preload("Owner").Preload("TS1DynamicTalkgroup").Preload("TS2DynamicTalkgroup").Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Preload("Rewrites").Where("ts1_dynamic_talkgroup_id IS NOT NULL OR ts2_dynamic_talkgroup_id IS NOT NULL").Find(&repeaters)
+	return repeaters
+}
+
 func GetUserRepeaters(db *gorm.DB, ID uint) []Repeater {
 	var repeaters []Repeater
-	db.Preload("Owner").Preload("TS1DynamicTalkgroup").Preload("TS2DynamicTalkgroup").Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Where("owner_id = ?", ID).Order("radio_id asc").Find(&repeaters)
+	db.Preload("Owner").Preload("TS1DynamicTalkgroup").Preload("TS2DynamicTalkgroup").Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Preload("Rewrites").Where("owner_id = ?", ID).Order("radio_id asc").Find(&repeaters)
 	return repeaters
 }
 
@@ -390,7 +468,7 @@ func CountUserRepeaters(db *gorm.DB, ID uint) int {
 
 func FindRepeaterByID(db *gorm.DB, ID uint) Repeater {
 	var repeater Repeater
-	db.Preload("Owner").Preload("TS1DynamicTalkgroup").Preload("TS2DynamicTalkgroup").Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").First(&repeater, ID)
+	db.Preload("Owner").Preload("TS1DynamicTalkgroup").Preload("TS2DynamicTalkgroup").Preload("TS1StaticTalkgroups").Preload("TS2StaticTalkgroups").Preload("Rewrites").First(&repeater, ID)
 	return repeater
 }
 
@@ -409,6 +487,9 @@ func RepeaterIDExists(db *gorm.DB, id uint) bool {
 func DeleteRepeater(db *gorm.DB, id uint) {
 	err := db.Transaction(func(tx *gorm.DB) error {
 		tx.Unscoped().Where("(is_to_repeater = ? AND to_repeater_id = ?) OR repeater_id = ?", true, id, id).Delete(&Call{})
+		tx.Unscoped().Where("repeater_id = ?", id).Delete(&RepeaterRewrite{})
+		tx.Unscoped().Where("repeater_id = ?", id).Delete(&CallQualitySample{})
+		tx.Unscoped().Where("repeater_id = ?", id).Delete(&RepeaterConnectionLog{})
 		tx.Unscoped().Select(clause.Associations, "TS1StaticTalkgroups").Select(clause.Associations, "TS2StaticTalkgroups").Delete(&Repeater{RadioID: id})
 		return nil
 	})
@@ -443,6 +524,42 @@ func (p *Repeater) WantRX(packet Packet) (bool, bool) {
 	return false, false
 }
 
+// RewriteIngress maps a group call keyed up locally on the repeater to the
+// network talkgroup it is rewritten to, returning true if a rule matched
+func (p *Repeater) RewriteIngress(packet *Packet) bool {
+	if !packet.GroupCall {
+		return false
+	}
+	for _, rewrite := range p.Rewrites {
+		if rewrite.LocalTalkgroupID == packet.Dst && rewrite.TimeSlot == packet.Slot {
+			packet.Dst = rewrite.NetworkTalkgroupID
+			packet.UpdateLC()
+			return true
+		}
+	}
+	return false
+}
+
+// RewriteEgress maps a network talkgroup packet to the local talkgroup and
+// timeslot the repeater expects it on, returning true if a rule matched
+func (p *Repeater) RewriteEgress(packet *Packet) bool {
+	if !packet.GroupCall {
+		return false
+	}
+	repeaterRewritesMutex.RLock()
+	rewrites := repeaterRewrites[p.RadioID]
+	repeaterRewritesMutex.RUnlock()
+	for _, rewrite := range rewrites {
+		if rewrite.NetworkTalkgroupID == packet.Dst {
+			packet.Dst = rewrite.LocalTalkgroupID
+			packet.Slot = rewrite.TimeSlot
+			packet.UpdateLC()
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Repeater) InTS2StaticTalkgroups(dest uint) bool {
 	for _, tg := range p.TS2StaticTalkgroups {
 		if dest == tg.ID {
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// RepeaterPresenceChannel tells every instance to tear down or restore the talkgroup subscriptions
+// of a repeater that went offline or came back
+const RepeaterPresenceChannel = "repeater-presence"
+
+// Repeater connection log events
+const (
+	RepeaterConnectionConnect    = "connect"
+	RepeaterConnectionDisconnect = "disconnect"
+	RepeaterConnectionTimeout    = "timeout"
+)
+
+// RepeaterConnectionLog is one connect or disconnect of a repeater
+type RepeaterConnectionLog struct {
+	ID         uint      `json:"-" gorm:"primarykey"`
+	RepeaterID uint      `json:"repeater_id" gorm:"index"`
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time" gorm:"index"`
+	Connection string    `json:"connection,omitempty"`
+}
+
+func RecordRepeaterConnection(db *gorm.DB, repeaterID uint, event string, connection string) {
+	err := db.Create(&RepeaterConnectionLog{
+		RepeaterID: repeaterID,
+		Event:      event,
+		Time:       time.Now(),
+		Connection: connection,
+	}).Error
+	if err != nil {
+		klog.Errorf("Error recording repeater %d %s: %v", repeaterID, event, err)
+	}
+}
+
+func FindRepeaterConnectionLogs(db *gorm.DB, repeaterID uint, since time.Time) []RepeaterConnectionLog {
+	var logs []RepeaterConnectionLog
+	db.Where("repeater_id = ? AND time >= ?", repeaterID, since).Order("time desc").Find(&logs)
+	return logs
+}
+
+// CountRepeaterDrops counts the disconnects and timeouts of a repeater since the given time
+func CountRepeaterDrops(db *gorm.DB, repeaterID uint, since time.Time) int64 {
+	var count int64
+	db.Model(&RepeaterConnectionLog{}).
+		Where("repeater_id = ? AND event IN ? AND time >= ?", repeaterID, []string{RepeaterConnectionDisconnect, RepeaterConnectionTimeout}, since).
+		Count(&count)
+	return count
+}
+
+type RepeaterPresence struct {
+	RepeaterID uint `json:"repeater_id"`
+	Online     bool `json:"online"`
+}
+
+func PublishRepeaterPresence(ctx context.Context, redis *redis.Client, repeaterID uint, online bool) {
+	presenceJSON, err := json.Marshal(RepeaterPresence{RepeaterID: repeaterID, Online: online})
+	if err != nil {
+		klog.Errorf("Error marshalling repeater presence: %v", err)
+		return
+	}
+	_, err = redis.Publish(ctx, RepeaterPresenceChannel, presenceJSON).Result()
+	if err != nil {
+		klog.Errorf("Error publishing repeater %d presence: %v", repeaterID, err)
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// Repeater event types published on the "repeater-events:<id>" Redis channel
+const (
+	RepeaterEventLogin         = "login"
+	RepeaterEventAuthenticated = "authenticated"
+	RepeaterEventAuthFailed    = "auth_failed"
+	RepeaterEventConfig        = "config"
+	RepeaterEventPing          = "ping"
+	RepeaterEventDisconnect    = "disconnect"
+	RepeaterEventTimeout       = "timeout"
+	RepeaterEventLink          = "link"
+	RepeaterEventUnlink        = "unlink"
+	RepeaterEventTXStart       = "tx_start"
+	RepeaterEventTXEnd         = "tx_end"
+	RepeaterEventRejected      = "rejected"
+	RepeaterEventTXTimeout     = "tx_timeout"
+	RepeaterEventFlapping      = "flapping"
+)
+
+// RepeaterEventsChannelPattern matches the event channels of every repeater
+const RepeaterEventsChannelPattern = "repeater-events:*"
+
+// RepeaterEvent is a change in a repeater's connection or on-air activity
+type RepeaterEvent struct {
+	Type       string    `json:"type"`
+	RepeaterID uint      `json:"repeater_id"`
+	Time       time.Time `json:"time"`
+	Connection string    `json:"connection,omitempty"`
+	// Slot is 1 or 2 for talkgroup and transmit events
+	Slot          uint   `json:"slot,omitempty"`
+	TalkgroupID   uint   `json:"talkgroup_id,omitempty"`
+	SourceID      uint   `json:"source_id,omitempty"`
+	DestinationID uint   `json:"destination_id,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
+
+func RepeaterEventsChannel(repeaterID uint) string {
+	return fmt.Sprintf("repeater-events:%d", repeaterID)
+}
+
+// SlotNumber converts a packet or call timeslot flag into the 1 or 2 shown to users
+func SlotNumber(slot bool) uint {
+	if slot {
+		return 2
+	}
+	return 1
+}
+
+func PublishRepeaterEvent(ctx context.Context, redis *redis.Client, event RepeaterEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		klog.Errorf("Error marshalling repeater event: %v", err)
+		return
+	}
+	_, err = redis.Publish(ctx, RepeaterEventsChannel(event.RepeaterID), eventJSON).Result()
+	if err != nil {
+		klog.Errorf("Error publishing repeater event: %v", err)
+	}
+}
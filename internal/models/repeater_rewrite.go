@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RepeaterRewrite maps a network talkgroup to a different talkgroup number
+// and/or timeslot on a single repeater
+type RepeaterRewrite struct {
+	ID                 uint           `json:"id" gorm:"primaryKey"`
+	RepeaterID         uint           `json:"-" gorm:"index"`
+	NetworkTalkgroupID uint           `json:"network_talkgroup_id"`
+	LocalTalkgroupID   uint           `json:"local_talkgroup_id"`
+	TimeSlot           bool           `json:"time_slot"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"-"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func FindRepeaterRewrites(db *gorm.DB, repeaterID uint) []RepeaterRewrite {
+	var rewrites []RepeaterRewrite
+	db.Where("repeater_id = ?", repeaterID).Order("id asc").Find(&rewrites)
+	return rewrites
+}
+
+func FindRepeaterRewrite(db *gorm.DB, repeaterID uint, ID uint) RepeaterRewrite {
+	var rewrite RepeaterRewrite
+	db.Where("repeater_id = ?", repeaterID).First(&rewrite, ID)
+	return rewrite
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// RepeaterConnectionEstablished is the connection stage of a repeater that has completed login and configuration
+const RepeaterConnectionEstablished = "YES"
+
+// RepeaterState is the live connection state of a repeater as tracked by the DMR server in Redis
+type RepeaterState struct {
+	Online        bool      `json:"online"`
+	Connection    string    `json:"connection"`
+	Connected     time.Time `json:"connected_time"`
+	LastPing      time.Time `json:"last_ping_time"`
+	PingsReceived uint      `json:"pings_received"`
+	Uptime        uint64    `json:"uptime"`
+	// RemoteAddress is only filled in for the repeater's owner and admins
+	RemoteAddress string `json:"remote_address,omitempty"`
+}
+
+// ConnectedRepeater is the public view of a repeater that is currently connected
+type ConnectedRepeater struct {
+	RadioID     uint          `json:"id"`
+	Callsign    string        `json:"callsign"`
+	Owner       string        `json:"owner"`
+	Location    string        `json:"location"`
+	RXFrequency uint          `json:"rx_frequency"`
+	TXFrequency uint          `json:"tx_frequency"`
+	ColorCode   uint          `json:"color_code"`
+	Hotspot     bool          `json:"hotspot"`
+	SoftwareID  string        `json:"software_id"`
+	State       RepeaterState `json:"state"`
+}
+
+// GetRepeaterState reads the live state of a repeater from Redis.
+// A repeater without a Redis entry is reported as offline.
+func GetRepeaterState(ctx context.Context, redisClient *redis.Client, repeaterID uint, showAddress bool) RepeaterState {
+	live, err := getLiveRepeater(ctx, redisClient, repeaterID)
+	if err != nil {
+		return RepeaterState{Connection: "NO"}
+	}
+	return live.liveState(showAddress)
+}
+
+// LoadLiveState fills in the repeater's live connection state and the time left on its dynamic talkgroups
+func (p *Repeater) LoadLiveState(ctx context.Context, redisClient *redis.Client, showAddress bool) {
+	state := RepeaterState{Connection: "NO"}
+	var optionsTimer *uint
+	live, err := getLiveRepeater(ctx, redisClient, p.RadioID)
+	if err == nil {
+		state = live.liveState(showAddress)
+		optionsTimer = live.OptionsTimer
+	}
+	p.State = &state
+	p.TS1DynamicTalkgroupRemaining = p.dynamicTalkgroupRemaining(ctx, redisClient, false, optionsTimer)
+	p.TS2DynamicTalkgroupRemaining = p.dynamicTalkgroupRemaining(ctx, redisClient, true, optionsTimer)
+}
+
+// LoadRepeaterStates fills in the live state of each repeater
+func LoadRepeaterStates(ctx context.Context, redisClient *redis.Client, repeaters []Repeater, showAddress bool) {
+	for i := range repeaters {
+		repeaters[i].LoadLiveState(ctx, redisClient, showAddress)
+	}
+}
+
+func getLiveRepeater(ctx context.Context, redisClient *redis.Client, repeaterID uint) (Repeater, error) {
+	repeaterBytes, err := redisClient.Get(ctx, fmt.Sprintf("repeater:%d", repeaterID)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			klog.Errorf("Error getting repeater %d state from redis: %v", repeaterID, err)
+		}
+		return Repeater{}, err
+	}
+	var repeater Repeater
+	_, err = repeater.UnmarshalMsg(repeaterBytes)
+	if err != nil {
+		klog.Errorf("Error unmarshalling repeater %d state: %v", repeaterID, err)
+		return Repeater{}, err
+	}
+	return repeater, nil
+}
+
+func (p Repeater) liveState(showAddress bool) RepeaterState {
+	state := RepeaterState{
+		Online:        p.Connection == RepeaterConnectionEstablished,
+		Connection:    p.Connection,
+		Connected:     p.Connected,
+		LastPing:      p.LastPing,
+		PingsReceived: p.PingsReceived,
+	}
+	if state.Online && !p.Connected.IsZero() {
+		state.Uptime = uint64(time.Since(p.Connected).Seconds())
+	}
+	if showAddress && p.IP != "" {
+		state.RemoteAddress = MaskAddress(p.IP, p.Port)
+	}
+	return state
+}
+
+// ListConnectedRepeaterIDs returns the IDs of all repeaters that have a live Redis entry
+func ListConnectedRepeaterIDs(ctx context.Context, redisClient *redis.Client) ([]uint, error) {
+	var cursor uint64
+	var repeaterIDs []uint
+	for {
+		keys, next, err := redisClient.Scan(ctx, cursor, "repeater:*", 0).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			repeaterID, err := strconv.ParseUint(strings.TrimPrefix(key, "repeater:"), 10, 32)
+			if err != nil {
+				continue
+			}
+			repeaterIDs = append(repeaterIDs, uint(repeaterID))
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return repeaterIDs, nil
+}
+
+// ListConnectedRepeaters returns the public view of every repeater that is fully connected
+func ListConnectedRepeaters(ctx context.Context, db *gorm.DB, redisClient *redis.Client) ([]ConnectedRepeater, error) {
+	repeaterIDs, err := ListConnectedRepeaterIDs(ctx, redisClient)
+	if err != nil {
+		return nil, err
+	}
+	connected := []ConnectedRepeater{}
+	if len(repeaterIDs) == 0 {
+		return connected, nil
+	}
+
+	var repeaters []Repeater
+	db.Preload("Owner").Where("radio_id IN ?", repeaterIDs).Order("radio_id asc").Find(&repeaters)
+	for _, repeater := range repeaters {
+		state := GetRepeaterState(ctx, redisClient, repeater.RadioID, false)
+		if !state.Online {
+			continue
+		}
+		connected = append(connected, ConnectedRepeater{
+			RadioID:     repeater.RadioID,
+			Callsign:    repeater.Callsign,
+			Owner:       repeater.Owner.Callsign,
+			Location:    repeater.Location,
+			RXFrequency: repeater.RXFrequency,
+			TXFrequency: repeater.TXFrequency,
+			ColorCode:   repeater.ColorCode,
+			Hotspot:     repeater.Hotspot,
+			SoftwareID:  repeater.SoftwareID,
+			State:       state,
+		})
+	}
+	return connected, nil
+}
+
+// MaskAddress hides the host part of a repeater's remote address,
+// keeping enough to recognize the network it is connecting from
+func MaskAddress(ip string, port int) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.x:%d", v4[0], v4[1], v4[2], port)
+	}
+	masked := parsed.Mask(net.CIDRMask(48, 128))
+	return fmt.Sprintf("[%sx]:%d", strings.TrimSuffix(masked.String(), ":"), port)
+}
@@ -0,0 +1,25 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestMaskAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		port int
+		want string
+	}{
+		{"203.0.113.45", 62031, "203.0.113.x:62031"},
+		{"::ffff:198.51.100.7", 62031, "198.51.100.x:62031"},
+		{"2001:db8:1234:5678::1", 62031, "[2001:db8:1234:x]:62031"},
+		{"not an ip", 62031, ""},
+	}
+	for _, tt := range tests {
+		if got := models.MaskAddress(tt.ip, tt.port); got != tt.want {
+			t.Errorf("MaskAddress(%q, %d) = %q, want %q", tt.ip, tt.port, got, tt.want)
+		}
+	}
+}
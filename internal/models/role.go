@@ -0,0 +1,208 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// Permissions a role can grant
+const (
+	// PermissionLogin is held by every approved user who isn't suspended
+	PermissionLogin              = "login"
+	PermissionUsersRead          = "users:read"
+	PermissionUsersApprove       = "users:approve"
+	PermissionUsersSuspend       = "users:suspend"
+	PermissionUsersManage        = "users:manage"
+	PermissionUsersAdmin         = "users:admin"
+	PermissionUsersDelete        = "users:delete"
+	PermissionRepeatersRead      = "repeaters:read"
+	PermissionRepeatersManage    = "repeaters:manage"
+	PermissionTalkgroupsManage   = "talkgroups:manage"
+	PermissionNetsManage         = "nets:manage"
+	PermissionBridgesManage      = "bridges:manage"
+	PermissionAnnouncementManage = "announcements:manage"
+	PermissionSettingsManage     = "settings:manage"
+	PermissionRolesManage        = "roles:manage"
+	PermissionAuditRead          = "audit:read"
+)
+
+// Permissions lists everything a role can grant
+var Permissions = []string{
+	PermissionUsersRead,
+	PermissionUsersApprove,
+	PermissionUsersSuspend,
+	PermissionUsersManage,
+	PermissionUsersAdmin,
+	PermissionUsersDelete,
+	PermissionRepeatersRead,
+	PermissionRepeatersManage,
+	PermissionTalkgroupsManage,
+	PermissionNetsManage,
+	PermissionBridgesManage,
+	PermissionAnnouncementManage,
+	PermissionSettingsManage,
+	PermissionRolesManage,
+	PermissionAuditRead,
+}
+
+// superAdminPermissions are left out of what the admin flag grants, they used to be the super admin's alone
+var superAdminPermissions = []string{
+	PermissionUsersAdmin,
+	PermissionUsersDelete,
+	PermissionSettingsManage,
+	PermissionRolesManage,
+	PermissionAuditRead,
+}
+
+// Role is a named set of permissions that can be given to users on top of what they already have
+type Role struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"uniqueIndex"`
+	Description string         `json:"description"`
+	Permissions []string       `json:"permissions" gorm:"serializer:json"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"-"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// DefaultRoles are created once, super admins can change or remove them afterwards
+var DefaultRoles = []Role{
+	{
+		Name:        "User Approver",
+		Description: "Approves new users",
+		Permissions: []string{PermissionUsersRead, PermissionUsersApprove},
+	},
+	{
+		Name:        "Talkgroup Manager",
+		Description: "Creates and manages talkgroups and their nets",
+		Permissions: []string{PermissionTalkgroupsManage, PermissionNetsManage},
+	},
+	{
+		Name:        "Repeater Technician",
+		Description: "Looks after every repeater on the network",
+		Permissions: []string{PermissionRepeatersRead, PermissionRepeatersManage},
+	},
+	{
+		Name:        "Auditor",
+		Description: "Reads the audit log, users and repeaters without changing anything",
+		Permissions: []string{PermissionAuditRead, PermissionUsersRead, PermissionRepeatersRead},
+	},
+}
+
+func IsValidPermission(permission string) bool {
+	return containsString(Permissions, permission)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the user holds the permission, through being the super admin,
+// the admin flag, or one of their roles. The user's roles need to be loaded.
+func (u User) HasPermission(permission string) bool {
+	if !u.Approved || u.Suspended {
+		return false
+	}
+	if permission == PermissionLogin || u.ID == 999999 {
+		return true
+	}
+	if u.Admin && !containsString(superAdminPermissions, permission) {
+		return true
+	}
+	for _, role := range u.Roles {
+		if containsString(role.Permissions, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions lists the permissions the user holds, besides PermissionLogin
+func (u User) Permissions() []string {
+	permissions := []string{}
+	for _, permission := range Permissions {
+		if u.HasPermission(permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// Privileged reports whether the user holds any permission beyond logging in
+func (u User) Privileged() bool {
+	return len(u.Permissions()) > 0
+}
+
+// FindUserWithRoles loads the user along with their roles, ready for permission checks
+func FindUserWithRoles(db *gorm.DB, id uint) User {
+	var user User
+	db.Preload("Roles").Find(&user, "id = ?", id)
+	return user
+}
+
+// LoadUserRoles fills in the roles of a user that was loaded without them
+func LoadUserRoles(db *gorm.DB, user *User) {
+	err := db.Model(user).Association("Roles").Find(&user.Roles)
+	if err != nil {
+		klog.Errorf("Error loading roles for user %d: %v", user.ID, err)
+	}
+}
+
+// SetUserRoles replaces the user's roles
+func SetUserRoles(db *gorm.DB, user *User, roles []Role) error {
+	return db.Model(user).Association("Roles").Replace(roles)
+}
+
+// UserHasPermission looks up the user and checks their permission
+func UserHasPermission(db *gorm.DB, userID uint, permission string) bool {
+	return FindUserWithRoles(db, userID).HasPermission(permission)
+}
+
+func ListRoles(db *gorm.DB) []Role {
+	var roles []Role
+	db.Order("name asc").Find(&roles)
+	return roles
+}
+
+func FindRoleByID(db *gorm.DB, id uint) Role {
+	var role Role
+	db.Find(&role, "id = ?", id)
+	return role
+}
+
+func RoleNameExists(db *gorm.DB, name string, exceptID uint) bool {
+	var count int64
+	db.Model(&Role{}).Where("name = ? AND id != ?", name, exceptID).Count(&count)
+	return count > 0
+}
+
+// DeleteRole removes the role and takes it away from everyone who had it
+func DeleteRole(db *gorm.DB, id uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// The join table has no soft delete, so this can't go through the Role model
+		err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&Role{}, id).Error
+	})
+}
+
+// SeedRoles creates the default roles the first time the server runs with roles
+func SeedRoles(db *gorm.DB) error {
+	for _, role := range DefaultRoles {
+		role := role
+		err := db.Where(Role{Name: role.Name}).FirstOrCreate(&role).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package models_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/DMRHub/internal/dbtest"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+func TestUserHasPermission(t *testing.T) {
+	approver := models.Role{Name: "Approver", Permissions: []string{models.PermissionUsersApprove}}
+	tests := []struct {
+		name       string
+		user       models.User
+		permission string
+		want       bool
+	}{
+		{"user can log in", models.User{ID: 1000001, Approved: true}, models.PermissionLogin, true},
+		{"unapproved user cannot log in", models.User{ID: 1000001}, models.PermissionLogin, false},
+		{"suspended admin has nothing", models.User{ID: 1000001, Approved: true, Suspended: true, Admin: true}, models.PermissionUsersRead, false},
+		{"user has no privileges", models.User{ID: 1000001, Approved: true}, models.PermissionUsersApprove, false},
+		{"admin manages talkgroups", models.User{ID: 1000001, Approved: true, Admin: true}, models.PermissionTalkgroupsManage, true},
+		{"admin cannot manage roles", models.User{ID: 1000001, Approved: true, Admin: true}, models.PermissionRolesManage, false},
+		{"super admin manages roles", models.User{ID: 999999, Approved: true}, models.PermissionRolesManage, true},
+		{"role grants its permission", models.User{ID: 1000001, Approved: true, Roles: []models.Role{approver}}, models.PermissionUsersApprove, true},
+		{"role grants nothing else", models.User{ID: 1000001, Approved: true, Roles: []models.Role{approver}}, models.PermissionUsersSuspend, false},
+	}
+	for _, tt := range tests {
+		if got := tt.user.HasPermission(tt.permission); got != tt.want {
+			t.Errorf("%s: HasPermission(%s) = %v, want %v", tt.name, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestUserPermissions(t *testing.T) {
+	user := models.User{ID: 1000001, Approved: true}
+	if user.Privileged() || len(user.Permissions()) != 0 {
+		t.Errorf("Plain user has permissions %v", user.Permissions())
+	}
+	user.Roles = []models.Role{{Permissions: []string{models.PermissionAuditRead}}}
+	permissions := user.Permissions()
+	if len(permissions) != 1 || permissions[0] != models.PermissionAuditRead || !user.Privileged() {
+		t.Errorf("Unexpected permissions %v", permissions)
+	}
+}
+
+func TestDefaultRolesAreValid(t *testing.T) {
+	for _, role := range models.DefaultRoles {
+		for _, permission := range role.Permissions {
+			if !models.IsValidPermission(permission) {
+				t.Errorf("Role %s has invalid permission %s", role.Name, permission)
+			}
+		}
+	}
+	if models.IsValidPermission(models.PermissionLogin) {
+		t.Error("Roles should not be able to grant logging in")
+	}
+}
+
+func TestDeleteAssignedRole(t *testing.T) {
+	db, recorder, err := dbtest.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The join table only has the two IDs, like the one Postgres has
+	recorder.Fail = func(query string) error {
+		if strings.Contains(query, "user_roles") && strings.Contains(query, "deleted_at") {
+			return errors.New(`column "deleted_at" does not exist`)
+		}
+		return nil
+	}
+	role := models.Role{ID: 3, Name: "Approver", Permissions: []string{models.PermissionUsersApprove}}
+	user := models.User{ID: 1000001}
+	if err := models.SetUserRoles(db, &user, []models.Role{role}); err != nil {
+		t.Fatalf("Error assigning role: %v", err)
+	}
+	if len(recorder.Matching(`INSERT INTO "user_roles"`)) != 1 {
+		t.Fatalf("Role was not assigned: %v", recorder.Statements())
+	}
+
+	recorder.Reset()
+	if err := models.DeleteRole(db, role.ID); err != nil {
+		t.Fatalf("Error deleting role: %v", err)
+	}
+	unassigned := recorder.Matching("DELETE FROM", "user_roles", "role_id")
+	if len(unassigned) != 1 || unassigned[0].Args[0].Value != int64(role.ID) {
+		t.Errorf("Role was not taken away from its users: %v", recorder.Statements())
+	}
+	if len(recorder.Matching(`DELETE FROM "roles"`)) != 1 {
+		t.Errorf("Role was not deleted: %v", recorder.Statements())
+	}
+}
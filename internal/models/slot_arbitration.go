@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// A stream that hasn't sent a packet in this long is treated as ended even without a terminator
+const slotStreamIdle = 1 * time.Second
+
+// Contention statistics are kept long enough for the call tracker to pick them up at the end of the call
+const contentionStatsExpiry = 10 * time.Minute
+
+// Results of claiming a slot
+const (
+	SlotGranted   = "granted"
+	SlotBlocked   = "blocked"
+	SlotPreempted = "preempted"
+)
+
+// claimSlotScript atomically decides whether a stream may use a timeslot.
+//
+// KEYS[1] is the slot's hash. ARGV is the stream ID, destination, whether the stream
+// is local to the repeater, whether the packet is a terminator, the current time,
+// the hang time, the idle stream timeout and the key expiry, all times in milliseconds.
+//
+// Local traffic always wins the slot, preempting any network stream on it. Network
+// streams are blocked while another stream is active, and during hang time unless
+// they are for the same destination as the stream that just ended.
+var claimSlotScript = redis.NewScript(`
+local owner = redis.call('HMGET', KEYS[1], 'stream', 'dst', 'local', 'last', 'ended')
+local now = tonumber(ARGV[5])
+local result = 'granted'
+if owner[1] and owner[1] ~= ARGV[1] then
+	local since = now - tonumber(owner[4])
+	local active = owner[5] ~= '1' and since < tonumber(ARGV[7])
+	if ARGV[3] == '1' then
+		if active and owner[3] ~= '1' then
+			result = 'preempted'
+		end
+	elseif active then
+		return {'blocked', owner[1]}
+	elseif since < tonumber(ARGV[6]) and owner[2] ~= ARGV[2] then
+		return {'blocked', owner[1]}
+	end
+end
+redis.call('HSET', KEYS[1], 'stream', ARGV[1], 'dst', ARGV[2], 'local', ARGV[3], 'last', ARGV[5], 'ended', ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[8])
+return {result, owner[1] or ''}
+`)
+
+func slotKey(repeaterID uint, slot bool) string {
+	return fmt.Sprintf("slot:%d:%d", repeaterID, SlotNumber(slot))
+}
+
+func contentionStatsKey(streamID string, result string) string {
+	return fmt.Sprintf("call-stats:%s:%s", streamID, result)
+}
+
+func boolArg(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// ClaimSlot arbitrates a repeater's timeslot between streams, returning whether the
+// packet may be sent on air. local is true for traffic originated on the repeater itself.
+func ClaimSlot(ctx context.Context, redisClient *redis.Client, repeaterID uint, packet Packet, local bool) bool {
+	hangTime := config.GetConfig().HangTime
+	expiry := hangTime
+	if expiry < slotStreamIdle {
+		expiry = slotStreamIdle
+	}
+	expiry += time.Second
+	terminator := packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm
+
+	res, err := claimSlotScript.Run(ctx, redisClient, []string{slotKey(repeaterID, packet.Slot)},
+		packet.StreamID,
+		packet.Dst,
+		boolArg(local),
+		boolArg(terminator),
+		time.Now().UnixMilli(),
+		hangTime.Milliseconds(),
+		slotStreamIdle.Milliseconds(),
+		expiry.Milliseconds(),
+	).StringSlice()
+	if err != nil {
+		// Don't take the repeater off the air because Redis hiccuped
+		klog.Errorf("Error claiming slot %d on repeater %d: %v", SlotNumber(packet.Slot), repeaterID, err)
+		return true
+	}
+
+	switch res[0] {
+	case SlotBlocked:
+		recordContention(ctx, redisClient, fmt.Sprint(packet.StreamID), SlotBlocked, repeaterID)
+		if config.GetConfig().Debug {
+			klog.Infof("Blocked stream %d on repeater %d slot %d, held by stream %s", packet.StreamID, repeaterID, SlotNumber(packet.Slot), res[1])
+		}
+		return false
+	case SlotPreempted:
+		recordContention(ctx, redisClient, res[1], SlotPreempted, repeaterID)
+		if config.GetConfig().Debug {
+			klog.Infof("Local stream %d preempted stream %s on repeater %d slot %d", packet.StreamID, res[1], repeaterID, SlotNumber(packet.Slot))
+		}
+	}
+	return true
+}
+
+func recordContention(ctx context.Context, redisClient *redis.Client, streamID string, result string, repeaterID uint) {
+	key := contentionStatsKey(streamID, result)
+	pipe := redisClient.Pipeline()
+	pipe.SAdd(ctx, key, repeaterID)
+	pipe.Expire(ctx, key, contentionStatsExpiry)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		klog.Errorf("Error recording %s stream %s: %v", result, streamID, err)
+	}
+}
+
+// StreamContention returns how many repeaters blocked a stream and how many preempted it
+func StreamContention(ctx context.Context, redisClient *redis.Client, streamID uint) (uint, uint) {
+	blocked, err := redisClient.SCard(ctx, contentionStatsKey(fmt.Sprint(streamID), SlotBlocked)).Result()
+	if err != nil {
+		klog.Errorf("Error getting blocked count for stream %d: %v", streamID, err)
+	}
+	preempted, err := redisClient.SCard(ctx, contentionStatsKey(fmt.Sprint(streamID), SlotPreempted)).Result()
+	if err != nil {
+		klog.Errorf("Error getting preempted count for stream %d: %v", streamID, err)
+	}
+	return uint(blocked), uint(preempted)
+}
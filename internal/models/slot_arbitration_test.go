@@ -0,0 +1,89 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+)
+
+const testRepeater = 311860
+
+func TestClaimSlotBlocksNetworkStream(t *testing.T) {
+	ctx := context.Background()
+	client := newContentionRedis(t)
+	first := streamPacket(1, 3191868, 91)
+	second := streamPacket(2, 3191869, 92)
+
+	if !models.ClaimSlot(ctx, client, testRepeater, first, false) {
+		t.Fatal("the first stream on an idle slot was blocked")
+	}
+	if models.ClaimSlot(ctx, client, testRepeater, second, false) {
+		t.Fatal("a network stream was granted a busy slot")
+	}
+	if !models.ClaimSlot(ctx, client, testRepeater, first, false) {
+		t.Error("the owning stream lost its slot")
+	}
+	second.Slot = true
+	if !models.ClaimSlot(ctx, client, testRepeater, second, false) {
+		t.Error("a stream on the other slot was blocked")
+	}
+	if blocked, preempted := models.StreamContention(ctx, client, second.StreamID); blocked != 1 || preempted != 0 {
+		t.Errorf("StreamContention = %d blocked, %d preempted, want 1 blocked", blocked, preempted)
+	}
+}
+
+func TestClaimSlotLocalPreemptsNetwork(t *testing.T) {
+	ctx := context.Background()
+	client := newContentionRedis(t)
+	network := streamPacket(1, 3191868, 91)
+	local := streamPacket(2, 3191869, 92)
+
+	models.ClaimSlot(ctx, client, testRepeater, network, false)
+	if !models.ClaimSlot(ctx, client, testRepeater, local, true) {
+		t.Fatal("local traffic was blocked by a network stream")
+	}
+	if models.ClaimSlot(ctx, client, testRepeater, network, false) {
+		t.Error("the preempted network stream got its slot back")
+	}
+	if blocked, preempted := models.StreamContention(ctx, client, network.StreamID); preempted != 1 {
+		t.Errorf("StreamContention = %d blocked, %d preempted, want 1 preempted", blocked, preempted)
+	}
+}
+
+func TestClaimSlotLocalDoesNotPreemptLocal(t *testing.T) {
+	ctx := context.Background()
+	client := newContentionRedis(t)
+	first := streamPacket(1, 3191868, 91)
+	second := streamPacket(2, 3191869, 92)
+
+	models.ClaimSlot(ctx, client, testRepeater, first, true)
+	if !models.ClaimSlot(ctx, client, testRepeater, second, true) {
+		t.Fatal("local traffic was blocked")
+	}
+	if blocked, preempted := models.StreamContention(ctx, client, first.StreamID); blocked != 0 || preempted != 0 {
+		t.Errorf("StreamContention = %d blocked, %d preempted, want none", blocked, preempted)
+	}
+}
+
+func TestClaimSlotHangTime(t *testing.T) {
+	ctx := context.Background()
+	client := newContentionRedis(t)
+	ended := streamPacket(1, 3191868, 91)
+
+	models.ClaimSlot(ctx, client, testRepeater, ended, false)
+	models.ClaimSlot(ctx, client, testRepeater, terminator(ended), false)
+	if models.ClaimSlot(ctx, client, testRepeater, streamPacket(2, 3191869, 92), false) {
+		t.Error("a network stream for another talkgroup was granted the slot during hang time")
+	}
+	if !models.ClaimSlot(ctx, client, testRepeater, streamPacket(3, 3191869, 91), false) {
+		t.Fatal("a network stream for the same talkgroup was blocked during hang time")
+	}
+
+	models.ClaimSlot(ctx, client, testRepeater, terminator(streamPacket(3, 3191869, 91)), false)
+	time.Sleep(testHangTime + 50*time.Millisecond)
+	if !models.ClaimSlot(ctx, client, testRepeater, streamPacket(4, 3191869, 92), false) {
+		t.Error("a network stream for another talkgroup was blocked after hang time")
+	}
+}
@@ -10,14 +10,15 @@ import (
 )
 
 type Talkgroup struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Admins      []User         `json:"admins" gorm:"many2many:talkgroup_admins;"`
-	NCOs        []User         `json:"ncos" gorm:"many2many:talkgroup_ncos;"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"-"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	Name            string         `json:"name"`
+	Description     string         `json:"description"`
+	Admins          []User         `json:"admins" gorm:"many2many:talkgroup_admins;"`
+	NCOs            []User         `json:"ncos" gorm:"many2many:talkgroup_ncos;"`
+	TransmitTimeout *uint          `json:"transmit_timeout"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"-"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func ListTalkgroups(db *gorm.DB) []Talkgroup {
@@ -48,6 +49,10 @@ func DeleteTalkgroup(db *gorm.DB, id uint) {
 	err := db.Transaction(func(tx *gorm.DB) error {
 		// Delete calls where IsToTalkgroup is true and IsToTalkgroupID is id
 		tx.Unscoped().Where("is_to_talkgroup = ? AND to_talkgroup_id = ?", true, id).Delete(&Call{})
+		// Delete any nets run on the talkgroup along with their check-ins
+		deleteNets(tx, "talkgroup_id = ?", id)
+		// Delete any bridges to or from the talkgroup
+		tx.Unscoped().Where("source_talkgroup_id = ? OR destination_talkgroup_id = ?", id, id).Delete(&Bridge{})
 		// Find repeaters with TS1DynamicTalkgroup or TS2DynamicTalkgroup set to id
 		var repeaters []Repeater
 		tx.Where("ts1_dynamic_talkgroup_id = ? OR ts2_dynamic_talkgroup_id = ?", id, id).Find(&repeaters)
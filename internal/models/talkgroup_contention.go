@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// claimTalkgroupScript atomically grants a talkgroup to the first stream keyed up on it.
+//
+// KEYS[1] is the talkgroup's hash. ARGV is the stream ID, the source ID, whether the
+// packet is a terminator, the current time, the hang time, the idle stream timeout and
+// the key expiry, all times in milliseconds.
+//
+// Any other stream is rejected while the owner is active and for the hang time after it ends.
+var claimTalkgroupScript = redis.NewScript(`
+local owner = redis.call('HMGET', KEYS[1], 'stream', 'src', 'last', 'ended')
+local now = tonumber(ARGV[4])
+if owner[1] and owner[1] ~= ARGV[1] then
+	local since = now - tonumber(owner[3])
+	local active = owner[4] ~= '1' and since < tonumber(ARGV[6])
+	if active or since < tonumber(ARGV[5]) then
+		return {'rejected', owner[1], owner[2]}
+	end
+end
+redis.call('HSET', KEYS[1], 'stream', ARGV[1], 'src', ARGV[2], 'last', ARGV[4], 'ended', ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[7])
+return {'granted', '', ''}
+`)
+
+// TalkgroupClaim is the outcome of claiming a talkgroup for a stream
+type TalkgroupClaim struct {
+	Granted bool
+	// FirstRejection is true for the first packet of a stream that was turned away
+	FirstRejection bool
+	// OwnerSrc is the source ID of the stream holding the talkgroup when rejected
+	OwnerSrc uint
+}
+
+func talkgroupClaimKey(talkgroupID uint) string {
+	return fmt.Sprintf("talkgroup-claim:%d", talkgroupID)
+}
+
+// ClaimTalkgroup decides whether a stream may be routed to its talkgroup
+func ClaimTalkgroup(ctx context.Context, redisClient *redis.Client, packet Packet) TalkgroupClaim {
+	granted, ownerSrc := claimTalkgroup(ctx, redisClient, packet)
+	if granted {
+		return TalkgroupClaim{Granted: true}
+	}
+
+	firstRejection, err := redisClient.SetNX(ctx, contentionStatsKey(fmt.Sprint(packet.StreamID), "rejected"), ownerSrc, contentionStatsExpiry).Result()
+	if err != nil {
+		klog.Errorf("Error recording rejected stream %d: %v", packet.StreamID, err)
+	}
+	return TalkgroupClaim{FirstRejection: firstRejection, OwnerSrc: ownerSrc}
+}
+
+// ClaimTalkgroupCopy decides whether packets copied onto a talkgroup, like bridged streams
+// and announcements, may be sent to it. Unlike ClaimTalkgroup a refusal isn't recorded
+// against the stream, as a bridged stream's own call still went through.
+func ClaimTalkgroupCopy(ctx context.Context, redisClient *redis.Client, packet Packet) bool {
+	granted, _ := claimTalkgroup(ctx, redisClient, packet)
+	return granted
+}
+
+// claimTalkgroup runs the claim script, returning the owner's source ID when refused
+func claimTalkgroup(ctx context.Context, redisClient *redis.Client, packet Packet) (bool, uint) {
+	hangTime := config.GetConfig().TalkgroupHangTime
+	expiry := hangTime
+	if expiry < slotStreamIdle {
+		expiry = slotStreamIdle
+	}
+	expiry += time.Second
+	terminator := packet.FrameType == dmrconst.FrameDataSync && dmrconst.DataType(packet.DTypeOrVSeq) == dmrconst.DTypeVoiceTerm
+
+	res, err := claimTalkgroupScript.Run(ctx, redisClient, []string{talkgroupClaimKey(packet.Dst)},
+		packet.StreamID,
+		packet.Src,
+		boolArg(terminator),
+		time.Now().UnixMilli(),
+		hangTime.Milliseconds(),
+		slotStreamIdle.Milliseconds(),
+		expiry.Milliseconds(),
+	).StringSlice()
+	if err != nil {
+		klog.Errorf("Error claiming talkgroup %d: %v", packet.Dst, err)
+		return true, 0
+	}
+	if res[0] != "rejected" {
+		return true, 0
+	}
+	ownerSrc, err := strconv.ParseUint(res[2], 10, 32)
+	if err != nil {
+		return false, 0
+	}
+	return false, uint(ownerSrc)
+}
+
+// StreamRejected reports whether a stream was turned away from its talkgroup
+func StreamRejected(ctx context.Context, redisClient *redis.Client, streamID uint) bool {
+	return redisClient.Exists(ctx, contentionStatsKey(fmt.Sprint(streamID), "rejected")).Val() == 1
+}
@@ -0,0 +1,135 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+	"github.com/USA-RedDragon/DMRHub/internal/dmrconst"
+	"github.com/USA-RedDragon/DMRHub/internal/models"
+	"github.com/USA-RedDragon/DMRHub/internal/redistest"
+	"github.com/redis/go-redis/v9"
+)
+
+const testHangTime = 300 * time.Millisecond
+
+// newContentionRedis starts a Redis server and shortens the hang times for the test
+func newContentionRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting redis: %v", err)
+	}
+	client := server.Client()
+	t.Cleanup(func() {
+		_ = client.Close()
+		server.Close()
+	})
+
+	cfg := config.GetConfig()
+	hangTime, talkgroupHangTime := cfg.HangTime, cfg.TalkgroupHangTime
+	cfg.HangTime, cfg.TalkgroupHangTime = testHangTime, testHangTime
+	t.Cleanup(func() {
+		cfg.HangTime, cfg.TalkgroupHangTime = hangTime, talkgroupHangTime
+	})
+	return client
+}
+
+func streamPacket(stream uint, src uint, dst uint) models.Packet {
+	return models.Packet{
+		Signature: "DMRD",
+		StreamID:  stream,
+		Src:       src,
+		Dst:       dst,
+		GroupCall: true,
+		FrameType: dmrconst.FrameVoice,
+		BER:       -1,
+		RSSI:      -1,
+	}
+}
+
+func terminator(packet models.Packet) models.Packet {
+	packet.FrameType = dmrconst.FrameDataSync
+	packet.DTypeOrVSeq = uint(dmrconst.DTypeVoiceTerm)
+	return packet
+}
+
+func TestClaimTalkgroupFirstStreamWins(t *testing.T) {
+	ctx := context.Background()
+	client := newContentionRedis(t)
+	first := streamPacket(1, 3191868, 91)
+	second := streamPacket(2, 3191869, 91)
+
+	if !models.ClaimTalkgroup(ctx, client, first).Granted {
+		t.Fatal("the first stream on an idle talkgroup was refused")
+	}
+	claim := models.ClaimTalkgroup(ctx, client, second)
+	if claim.Granted {
+		t.Fatal("a second stream was granted a busy talkgroup")
+	}
+	if !claim.FirstRejection {
+		t.Error("the first rejection of a stream wasn't reported as such")
+	}
+	if claim.OwnerSrc != first.Src {
+		t.Errorf("OwnerSrc = %d, want %d", claim.OwnerSrc, first.Src)
+	}
+	if models.ClaimTalkgroup(ctx, client, second).FirstRejection {
+		t.Error("a stream's later rejections were reported as its first")
+	}
+	if !models.ClaimTalkgroup(ctx, client, first).Granted {
+		t.Error("the owning stream lost its talkgroup")
+	}
+	if !models.StreamRejected(ctx, client, second.StreamID) {
+		t.Error("the rejected stream wasn't recorded")
+	}
+	if models.StreamRejected(ctx, client, first.StreamID) {
+		t.Error("the owning stream was recorded as rejected")
+	}
+	if !models.ClaimTalkgroup(ctx, client, streamPacket(3, 3191869, 92)).Granted {
+		t.Error("a stream on another talkgroup was refused")
+	}
+}
+
+func TestClaimTalkgroupHangTime(t *testing.T) {
+	ctx := context.Background()
+	client := newContentionRedis(t)
+	first := streamPacket(1, 3191868, 91)
+	second := streamPacket(2, 3191869, 91)
+
+	models.ClaimTalkgroup(ctx, client, first)
+	if !models.ClaimTalkgroup(ctx, client, terminator(first)).Granted {
+		t.Fatal("the owning stream's terminator was refused")
+	}
+	if models.ClaimTalkgroup(ctx, client, second).Granted {
+		t.Fatal("another stream was granted the talkgroup during hang time")
+	}
+	time.Sleep(testHangTime + 50*time.Millisecond)
+	if !models.ClaimTalkgroup(ctx, client, second).Granted {
+		t.Fatal("another stream was refused the talkgroup after hang time")
+	}
+	if models.ClaimTalkgroup(ctx, client, streamPacket(3, 3191868, 91)).Granted {
+		t.Error("a new stream took the talkgroup from the stream that won it")
+	}
+}
+
+func TestClaimTalkgroupCopy(t *testing.T) {
+	ctx := context.Background()
+	client := newContentionRedis(t)
+	owner := streamPacket(1, 3191868, 91)
+	bridged := streamPacket(2, 3191869, 91)
+
+	models.ClaimTalkgroup(ctx, client, owner)
+	if models.ClaimTalkgroupCopy(ctx, client, bridged) {
+		t.Fatal("a copied stream was granted a busy talkgroup")
+	}
+	if models.StreamRejected(ctx, client, bridged.StreamID) {
+		t.Error("refusing a copied stream was recorded against the stream")
+	}
+	if !models.ClaimTalkgroupCopy(ctx, client, streamPacket(2, 3191869, 92)) {
+		t.Fatal("a copied stream was refused an idle talkgroup")
+	}
+	if models.ClaimTalkgroup(ctx, client, streamPacket(3, 3191868, 92)).Granted {
+		t.Error("a copied stream didn't hold the talkgroup it was granted")
+	}
+}
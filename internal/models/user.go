@@ -23,6 +23,22 @@ type User struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"-"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	// OIDCSubject links the account to a user at the single sign-on provider
+	OIDCSubject *string `json:"-" gorm:"uniqueIndex"`
+	// TOTPSecret is kept while enrolling, TOTPEnabled is only set once a code from it has been confirmed
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPLastStep is the time step of the last accepted code, so a code can't be replayed
+	TOTPLastStep int64 `json:"-"`
+	// TOTPRecoveryCodes are hashes of the recovery codes not yet used
+	TOTPRecoveryCodes []string `json:"-" gorm:"serializer:json"`
+	// Email is kept out of the user's JSON, which shows up in public places like lastheard
+	Email         string `json:"-" gorm:"index"`
+	EmailVerified bool   `json:"-"`
+	// RadioVerified is set once the user keys up a private call to their radio verification code
+	RadioVerified bool `json:"radio_verified"`
+	// Roles grant permissions beyond what Admin does, they're only loaded when asked for
+	Roles []Role `json:"roles,omitempty" gorm:"many2many:user_roles;"`
 }
 
 func (u User) TableName() string {
@@ -47,6 +63,32 @@ func FindUserByID(db *gorm.DB, ID uint) User {
 	return user
 }
 
+func FindUserByOIDCSubject(db *gorm.DB, subject string) User {
+	var user User
+	db.Where("oidc_subject = ?", subject).Limit(1).Find(&user)
+	return user
+}
+
+func FindUserByCallsign(db *gorm.DB, callsign string) User {
+	var user User
+	db.Where("callsign = ?", callsign).Limit(1).Find(&user)
+	return user
+}
+
+// FindUserByVerifiedEmail only matches addresses the user has proven they own
+func FindUserByVerifiedEmail(db *gorm.DB, email string) User {
+	var user User
+	db.Where("LOWER(email) = LOWER(?) AND email_verified = ?", email, true).Limit(1).Find(&user)
+	return user
+}
+
+// FindAdminEmails lists the verified email addresses of admins who can approve users
+func FindAdminEmails(db *gorm.DB) []string {
+	var emails []string
+	db.Model(&User{}).Where("admin = ? AND approved = ? AND suspended = ? AND email_verified = ?", true, true, false, true).Pluck("email", &emails)
+	return emails
+}
+
 func ListUsers(db *gorm.DB) []User {
 	var users []User
 	db.Preload("Repeaters").Find(&users)
@@ -138,6 +180,9 @@ func DeleteUser(db *gorm.DB, id uint) {
 			tx.Unscoped().Table("talkgroup_admins").Where("user_id = ?", id).Delete(&Talkgroup{})
 			tx.Unscoped().Table("talkgroup_ncos").Where("user_id = ?", id).Delete(&Talkgroup{})
 		}
+		deleteNets(tx, "started_by_id = ?", id)
+		tx.Unscoped().Where("user_id = ?", id).Delete(&APIToken{})
+		tx.Unscoped().Where("user_id = ?", id).Delete(&EmailToken{})
 		tx.Unscoped().Select(clause.Associations, "Repeaters").Delete(&User{ID: id})
 		return nil
 	})
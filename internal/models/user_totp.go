@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/USA-RedDragon/DMRHub/internal/totp"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// VerifyTwoFactor checks a TOTP code, falling back to the user's recovery codes, and uses it up
+func VerifyTwoFactor(db *gorm.DB, user *User, code string) bool {
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		// Only one request can move the last step forward, so a code can't be used twice in a race
+		result := db.Model(&User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+		if result.Error != nil {
+			klog.Errorf("Error saving TOTP step for user %d: %v", user.ID, result.Error)
+			return false
+		}
+		user.TOTPLastStep = step
+		return result.RowsAffected == 1
+	}
+	remaining, ok := totp.UseRecoveryCode(user.TOTPRecoveryCodes, code)
+	if !ok {
+		return false
+	}
+	err := db.Model(user).Select("totp_recovery_codes").Updates(User{TOTPRecoveryCodes: remaining}).Error
+	if err != nil {
+		klog.Errorf("Error using recovery code for user %d: %v", user.ID, err)
+		return false
+	}
+	user.TOTPRecoveryCodes = remaining
+	klog.Infof("User %d used a recovery code, %d left", user.ID, len(remaining))
+	return true
+}
+
+// DisableTOTP turns off two-factor authentication and forgets the secret and recovery codes
+func DisableTOTP(db *gorm.DB, userID uint) error {
+	return db.Model(&User{}).Where("id = ?", userID).Select("totp_secret", "totp_enabled", "totp_last_step", "totp_recovery_codes").
+		Updates(User{}).Error
+}
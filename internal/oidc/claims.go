@@ -0,0 +1,73 @@
+package oidc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Claims are the claims of a verified ID token
+type Claims map[string]interface{}
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// String returns a string claim, or "" if it's missing or not a string
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Strings returns a claim holding a list of strings, such as groups. A single string is treated as a list of one.
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Uint returns a claim holding a positive number, which providers may send as a number or a string
+func (c Claims) Uint(name string) uint {
+	switch value := c[name].(type) {
+	case float64:
+		if value > 0 {
+			return uint(value)
+		}
+	case string:
+		parsed, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		if err == nil {
+			return uint(parsed)
+		}
+	}
+	return 0
+}
+
+// InAnyGroup reports whether the groups claim contains any of the given groups
+func (c Claims) InAnyGroup(claim string, groups []string) bool {
+	for _, member := range c.Strings(claim) {
+		for _, group := range groups {
+			if strings.TrimSpace(group) == member {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c Claims) hasAudience(clientID string) bool {
+	for _, aud := range c.Strings("aud") {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/USA-RedDragon/DMRHub/internal/config"
+)
+
+var ErrNotConfigured = errors.New("single sign-on is not configured")
+
+var (
+	defaultLock     sync.Mutex
+	defaultProvider *Provider
+)
+
+// Default returns the configured provider, discovering it on first use.
+// A failed discovery is retried on the next call in case the provider was down.
+func Default(ctx context.Context) (*Provider, error) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	if defaultProvider != nil {
+		return defaultProvider, nil
+	}
+	cfg := config.GetConfig()
+	if cfg.OIDCIssuerURL == "" {
+		return nil, ErrNotConfigured
+	}
+	provider, err := Discover(ctx, cfg.OIDCIssuerURL, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL)
+	if err != nil {
+		return nil, err
+	}
+	defaultProvider = provider
+	return defaultProvider, nil
+}
@@ -0,0 +1,185 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// mockIdP is a minimal identity provider that hands out an ID token with the claims it's given for any code
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		idp.writeJSON(w, map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		idp.writeJSON(w, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "dmrhub" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		idp.writeJSON(w, map[string]string{"id_token": idp.sign("test", idp.claims)})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *mockIdP) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		idp.t.Error(err)
+	}
+}
+
+func (idp *mockIdP) sign(kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (idp *mockIdP) validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":      idp.server.URL,
+		"aud":      "dmrhub",
+		"sub":      "user-1",
+		"exp":      time.Now().Add(time.Hour).Unix(),
+		"nonce":    "nonce",
+		"callsign": "n0call",
+		"dmr_id":   3191868,
+		"groups":   []string{"members", "dmr-admins"},
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+	idp.claims = idp.validClaims()
+
+	provider, err := Discover(context.Background(), idp.server.URL, "dmrhub", "secret", "http://localhost/api/v1/auth/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := provider.Exchange(context.Background(), "good-code", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject() != "user-1" || claims.String("callsign") != "n0call" || claims.Uint("dmr_id") != 3191868 {
+		t.Errorf("Unexpected claims %v", claims)
+	}
+	if !claims.InAnyGroup("groups", []string{"dmr-admins"}) || claims.InAnyGroup("groups", []string{"other"}) {
+		t.Errorf("Unexpected groups %v", claims.Strings("groups"))
+	}
+
+	if _, err := provider.Exchange(context.Background(), "bad-code", "nonce"); err == nil {
+		t.Error("Expected a rejected code to fail")
+	}
+	if _, err := provider.Exchange(context.Background(), "good-code", "other-nonce"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a nonce mismatch to fail, got %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+	provider, err := Discover(context.Background(), idp.server.URL, "dmrhub", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	expired := idp.validClaims()
+	expired["exp"] = now.Add(-time.Hour).Unix()
+	wrongAudience := idp.validClaims()
+	wrongAudience["aud"] = []string{"another-client"}
+	wrongIssuer := idp.validClaims()
+	wrongIssuer["iss"] = "https://evil.example.com"
+	noSubject := idp.validClaims()
+	delete(noSubject, "sub")
+
+	tests := map[string]string{
+		"expired":        idp.sign("test", expired),
+		"wrong audience": idp.sign("test", wrongAudience),
+		"wrong issuer":   idp.sign("test", wrongIssuer),
+		"no subject":     idp.sign("test", noSubject),
+		"malformed":      "not-a-token",
+	}
+	for name, token := range tests {
+		if _, err := provider.Verify(context.Background(), token, "nonce", now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected an invalid token error, got %v", name, err)
+		}
+	}
+
+	if _, err := provider.Verify(context.Background(), idp.sign("rotated", idp.validClaims()), "nonce", now); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected an unknown key error, got %v", err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger := &mockIdP{t: t, key: otherKey}
+	if _, err := provider.Verify(context.Background(), forger.sign("test", idp.validClaims()), "nonce", now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a forged signature to fail, got %v", err)
+	}
+
+	if _, err := provider.Verify(context.Background(), idp.sign("test", idp.validClaims()), "nonce", now); err != nil {
+		t.Errorf("Expected a valid token to pass, got %v", err)
+	}
+}
+
+func TestClaimsUint(t *testing.T) {
+	claims := Claims{"number": float64(3191868), "string": "3191868", "bad": "n0call", "negative": float64(-1)}
+	if claims.Uint("number") != 3191868 || claims.Uint("string") != 3191868 {
+		t.Error("Expected DMR IDs sent as numbers or strings to parse")
+	}
+	if claims.Uint("bad") != 0 || claims.Uint("negative") != 0 || claims.Uint("missing") != 0 {
+		t.Error("Expected invalid DMR IDs to be 0")
+	}
+}
@@ -0,0 +1,934 @@
+package redistest
+
+import (
+	"crypto/sha1" //#nosec G505 -- Redis names scripts by their SHA1
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The interpreter covers locals, assignment, if statements, return, calls, table
+// constructors and indexing, and the arithmetic, comparison, concatenation and logical
+// operators. Values are nil, bool, float64, string, *luaTable and luaFunction.
+
+type luaTable struct {
+	array  []interface{}
+	fields map[string]interface{}
+}
+
+type luaFunction func(args []interface{}) (interface{}, error)
+
+type luaScope struct {
+	vars   map[string]interface{}
+	parent *luaScope
+}
+
+func (scope *luaScope) lookup(name string) (*luaScope, bool) {
+	for ; scope != nil; scope = scope.parent {
+		if _, ok := scope.vars[name]; ok {
+			return scope, true
+		}
+	}
+	return nil, false
+}
+
+type luaExpr func(scope *luaScope) (interface{}, error)
+
+// luaStmt runs a statement, reporting whether it returned
+type luaStmt func(scope *luaScope) (interface{}, bool, error)
+
+func (s *Server) loadScript(script string) string {
+	sum := sha1.Sum([]byte(script)) //#nosec G401 -- Redis names scripts by their SHA1
+	sha := hex.EncodeToString(sum[:])
+	s.scripts[sha] = script
+	return sha
+}
+
+// eval runs a script with EVAL's numkeys key... arg... arguments. The caller must hold s.mu.
+func (s *Server) eval(script string, args []string) reply {
+	s.loadScript(script)
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys < 0 || numKeys > len(args)-1 {
+		return errorf("Number of keys can't be greater than number of args")
+	}
+	keys := &luaTable{}
+	for _, key := range args[1 : 1+numKeys] {
+		keys.array = append(keys.array, key)
+	}
+	argv := &luaTable{}
+	for _, arg := range args[1+numKeys:] {
+		argv.array = append(argv.array, arg)
+	}
+
+	chunk, err := parseLua(script)
+	if err != nil {
+		return errorf("Error compiling script: %v", err)
+	}
+	globals := &luaScope{vars: map[string]interface{}{
+		"KEYS": keys,
+		"ARGV": argv,
+		"redis": &luaTable{fields: map[string]interface{}{
+			"call":  luaFunction(func(args []interface{}) (interface{}, error) { return s.luaCall(args, false) }),
+			"pcall": luaFunction(func(args []interface{}) (interface{}, error) { return s.luaCall(args, true) }),
+		}},
+		"tonumber": luaFunction(func(args []interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return nil, errors.New("bad argument #1 to 'tonumber'")
+			}
+			return luaToNumber(args[0]), nil
+		}),
+		"tostring": luaFunction(func(args []interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return nil, errors.New("bad argument #1 to 'tostring'")
+			}
+			return luaToString(args[0]), nil
+		}),
+	}}
+	value, _, err := runLuaBlock(chunk, &luaScope{vars: map[string]interface{}{}, parent: globals})
+	if err != nil {
+		return errorf("Error running script: %v", err)
+	}
+	return luaToReply(value)
+}
+
+func (s *Server) luaCall(args []interface{}, protected bool) (interface{}, error) {
+	command := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch arg.(type) {
+		case string, float64:
+			command = append(command, luaToString(arg))
+		default:
+			return nil, errors.New("Lua redis() command arguments must be strings or integers")
+		}
+	}
+	r := s.run(command)
+	if err, ok := r.(replyError); ok {
+		if protected {
+			return &luaTable{fields: map[string]interface{}{"err": string(err)}}, nil
+		}
+		return nil, errors.New(string(err))
+	}
+	return replyToLua(r), nil
+}
+
+func replyToLua(r reply) interface{} {
+	switch v := r.(type) {
+	case nil:
+		return false
+	case status:
+		return &luaTable{fields: map[string]interface{}{"ok": string(v)}}
+	case int:
+		return float64(v)
+	case string:
+		return v
+	case []reply:
+		table := &luaTable{}
+		for _, item := range v {
+			table.array = append(table.array, replyToLua(item))
+		}
+		return table
+	}
+	return nil
+}
+
+func luaToReply(value interface{}) reply {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+		return nil
+	case float64:
+		return int(v)
+	case string:
+		return v
+	case *luaTable:
+		if err, ok := v.fields["err"].(string); ok {
+			return replyError(err)
+		}
+		if ok, isStatus := v.fields["ok"].(string); isStatus {
+			return status(ok)
+		}
+		items := []reply{}
+		for _, item := range v.array {
+			if item == nil {
+				break
+			}
+			items = append(items, luaToReply(item))
+		}
+		return items
+	}
+	return nil
+}
+
+func luaTruthy(value interface{}) bool {
+	b, isBool := value.(bool)
+	return value != nil && (!isBool || b)
+}
+
+func luaToNumber(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil
+		}
+		return n
+	}
+	return nil
+}
+
+func luaToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'g', 14, 64)
+	case string:
+		return v
+	case *luaTable:
+		return fmt.Sprintf("table: %p", v)
+	}
+	return "function"
+}
+
+func luaTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *luaTable:
+		return "table"
+	}
+	return "function"
+}
+
+func luaIndex(container interface{}, key interface{}) (interface{}, error) {
+	table, ok := container.(*luaTable)
+	if !ok {
+		return nil, fmt.Errorf("attempt to index a %s value", luaTypeName(container))
+	}
+	switch k := key.(type) {
+	case float64:
+		if k == math.Trunc(k) && k >= 1 && int(k) <= len(table.array) {
+			return table.array[int(k)-1], nil
+		}
+	case string:
+		return table.fields[k], nil
+	}
+	return nil, nil
+}
+
+func luaArithmetic(op string, left, right interface{}) (interface{}, error) {
+	a, aOK := luaToNumber(left).(float64)
+	b, bOK := luaToNumber(right).(float64)
+	if !aOK || !bOK {
+		bad := left
+		if aOK {
+			bad = right
+		}
+		return nil, fmt.Errorf("attempt to perform arithmetic on a %s value", luaTypeName(bad))
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		return a / b, nil
+	case "%":
+		return a - math.Floor(a/b)*b, nil
+	}
+	return math.Pow(a, b), nil
+}
+
+func luaEqual(left, right interface{}) bool {
+	switch a := left.(type) {
+	case nil:
+		return right == nil
+	case bool:
+		b, ok := right.(bool)
+		return ok && a == b
+	case float64:
+		b, ok := right.(float64)
+		return ok && a == b
+	case string:
+		b, ok := right.(string)
+		return ok && a == b
+	case *luaTable:
+		b, ok := right.(*luaTable)
+		return ok && a == b
+	}
+	return false
+}
+
+func luaLess(left, right interface{}, orEqual bool) (bool, error) {
+	switch a := left.(type) {
+	case float64:
+		if b, ok := right.(float64); ok {
+			return a < b || (orEqual && a == b), nil
+		}
+	case string:
+		if b, ok := right.(string); ok {
+			return a < b || (orEqual && a == b), nil
+		}
+	}
+	return false, fmt.Errorf("attempt to compare %s with %s", luaTypeName(left), luaTypeName(right))
+}
+
+func luaBinary(op string, left, right luaExpr) luaExpr {
+	return func(scope *luaScope) (interface{}, error) {
+		a, err := left(scope)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "and":
+			if !luaTruthy(a) {
+				return a, nil
+			}
+			return right(scope)
+		case "or":
+			if luaTruthy(a) {
+				return a, nil
+			}
+			return right(scope)
+		}
+		b, err := right(scope)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "==":
+			return luaEqual(a, b), nil
+		case "~=":
+			return !luaEqual(a, b), nil
+		case "<":
+			return luaLess(a, b, false)
+		case "<=":
+			return luaLess(a, b, true)
+		case ">":
+			return luaLess(b, a, false)
+		case ">=":
+			return luaLess(b, a, true)
+		case "..":
+			for _, v := range []interface{}{a, b} {
+				switch v.(type) {
+				case string, float64:
+				default:
+					return nil, fmt.Errorf("attempt to concatenate a %s value", luaTypeName(v))
+				}
+			}
+			return luaToString(a) + luaToString(b), nil
+		}
+		return luaArithmetic(op, a, b)
+	}
+}
+
+func luaUnary(op string, operand luaExpr) luaExpr {
+	return func(scope *luaScope) (interface{}, error) {
+		v, err := operand(scope)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "not":
+			return !luaTruthy(v), nil
+		case "#":
+			switch t := v.(type) {
+			case string:
+				return float64(len(t)), nil
+			case *luaTable:
+				return float64(len(t.array)), nil
+			}
+			return nil, fmt.Errorf("attempt to get length of a %s value", luaTypeName(v))
+		}
+		return luaArithmetic("-", 0.0, v)
+	}
+}
+
+func runLuaBlock(block []luaStmt, scope *luaScope) (interface{}, bool, error) {
+	for _, stmt := range block {
+		value, returned, err := stmt(scope)
+		if err != nil || returned {
+			return value, returned, err
+		}
+	}
+	return nil, false, nil
+}
+
+const (
+	tokenName = iota
+	tokenNumber
+	tokenString
+	tokenSymbol
+	tokenEOF
+)
+
+type luaToken struct {
+	kind   int
+	text   string
+	number float64
+}
+
+var luaSymbols = []string{"==", "~=", "<=", ">=", "..", "+", "-", "*", "/", "%", "^", "#", "<", ">", "=", "(", ")", "{", "}", "[", "]", ",", ";", "."}
+
+func isLuaLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isLuaDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func tokenizeLua(src string) ([]luaToken, error) {
+	var tokens []luaToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case isLuaLetter(c):
+			j := i
+			for j < len(src) && (isLuaLetter(src[j]) || isLuaDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, luaToken{kind: tokenName, text: src[i:j]})
+			i = j
+		case isLuaDigit(c):
+			j := i
+			for j < len(src) && (isLuaDigit(src[j]) || src[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed number near '%s'", src[i:j])
+			}
+			tokens = append(tokens, luaToken{kind: tokenNumber, text: src[i:j], number: n})
+			i = j
+		case c == '\'' || c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					switch src[j] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(src[j])
+					}
+					continue
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, errors.New("unfinished string")
+			}
+			tokens = append(tokens, luaToken{kind: tokenString, text: sb.String()})
+			i = j + 1
+		default:
+			matched := false
+			for _, symbol := range luaSymbols {
+				if strings.HasPrefix(src[i:], symbol) {
+					tokens = append(tokens, luaToken{kind: tokenSymbol, text: symbol})
+					i += len(symbol)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected symbol near '%c'", c)
+			}
+		}
+	}
+	return append(tokens, luaToken{kind: tokenEOF, text: "<eof>"}), nil
+}
+
+type luaParser struct {
+	tokens []luaToken
+	pos    int
+}
+
+func parseLua(src string) ([]luaStmt, error) {
+	tokens, err := tokenizeLua(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &luaParser{tokens: tokens}
+	block, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("'<eof>' expected near '%s'", p.peek().text)
+	}
+	return block, nil
+}
+
+func (p *luaParser) peek() luaToken {
+	return p.tokens[p.pos]
+}
+
+func (p *luaParser) next() luaToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// check reports whether the next token is the given keyword or symbol
+func (p *luaParser) check(text string) bool {
+	t := p.peek()
+	return (t.kind == tokenName || t.kind == tokenSymbol) && t.text == text
+}
+
+func (p *luaParser) accept(text string) bool {
+	if p.check(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *luaParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("'%s' expected near '%s'", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *luaParser) name() (string, error) {
+	t := p.next()
+	if t.kind != tokenName {
+		return "", fmt.Errorf("<name> expected near '%s'", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *luaParser) blockEnds() bool {
+	return p.peek().kind == tokenEOF || p.check("end") || p.check("else") || p.check("elseif")
+}
+
+func (p *luaParser) block() ([]luaStmt, error) {
+	var block []luaStmt
+	for !p.blockEnds() {
+		if p.accept(";") {
+			continue
+		}
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		block = append(block, stmt)
+	}
+	return block, nil
+}
+
+func (p *luaParser) exprList() ([]luaExpr, error) {
+	var exprs []luaExpr
+	for {
+		expr, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.accept(",") {
+			return exprs, nil
+		}
+	}
+}
+
+func evalLuaList(exprs []luaExpr, scope *luaScope) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(exprs))
+	for _, expr := range exprs {
+		value, err := expr(scope)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (p *luaParser) statement() (luaStmt, error) {
+	switch {
+	case p.accept("local"):
+		return p.localStatement()
+	case p.accept("if"):
+		return p.ifStatement()
+	case p.accept("return"):
+		var exprs []luaExpr
+		if !p.blockEnds() && !p.check(";") {
+			var err error
+			exprs, err = p.exprList()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return func(scope *luaScope) (interface{}, bool, error) {
+			values, err := evalLuaList(exprs, scope)
+			if err != nil || len(values) == 0 {
+				return nil, true, err
+			}
+			return values[0], true, nil
+		}, nil
+	}
+
+	if p.peek().kind == tokenName && p.tokens[p.pos+1].text == "=" && p.tokens[p.pos+1].kind == tokenSymbol {
+		name := p.next().text
+		p.next()
+		value, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(scope *luaScope) (interface{}, bool, error) {
+			v, err := value(scope)
+			if err != nil {
+				return nil, false, err
+			}
+			target, ok := scope.lookup(name)
+			if !ok {
+				target = scope
+				for target.parent != nil {
+					target = target.parent
+				}
+			}
+			target.vars[name] = v
+			return nil, false, nil
+		}, nil
+	}
+
+	start := p.peek()
+	expr, isCall, err := p.suffixed()
+	if err != nil {
+		return nil, err
+	}
+	if !isCall {
+		return nil, fmt.Errorf("syntax error near '%s'", start.text)
+	}
+	return func(scope *luaScope) (interface{}, bool, error) {
+		_, err := expr(scope)
+		return nil, false, err
+	}, nil
+}
+
+func (p *luaParser) localStatement() (luaStmt, error) {
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+	var exprs []luaExpr
+	if p.accept("=") {
+		var err error
+		exprs, err = p.exprList()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func(scope *luaScope) (interface{}, bool, error) {
+		values, err := evalLuaList(exprs, scope)
+		if err != nil {
+			return nil, false, err
+		}
+		for i, name := range names {
+			var value interface{}
+			if i < len(values) {
+				value = values[i]
+			}
+			scope.vars[name] = value
+		}
+		return nil, false, nil
+	}, nil
+}
+
+func (p *luaParser) ifStatement() (luaStmt, error) {
+	var conditions []luaExpr
+	var blocks [][]luaStmt
+	for {
+		condition, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		block, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		blocks = append(blocks, block)
+		if !p.accept("elseif") {
+			break
+		}
+	}
+	var elseBlock []luaStmt
+	if p.accept("else") {
+		var err error
+		elseBlock, err = p.block()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("end"); err != nil {
+		return nil, err
+	}
+	return func(scope *luaScope) (interface{}, bool, error) {
+		for i, condition := range conditions {
+			value, err := condition(scope)
+			if err != nil {
+				return nil, false, err
+			}
+			if luaTruthy(value) {
+				return runLuaBlock(blocks[i], &luaScope{vars: map[string]interface{}{}, parent: scope})
+			}
+		}
+		return runLuaBlock(elseBlock, &luaScope{vars: map[string]interface{}{}, parent: scope})
+	}, nil
+}
+
+// Binary operator precedence, from Lua 5.1. Concatenation and exponentiation are right associative.
+var luaPrecedence = map[string]int{
+	"or": 1, "and": 2,
+	"<": 3, ">": 3, "<=": 3, ">=": 3, "~=": 3, "==": 3,
+	"..": 4, "+": 5, "-": 5, "*": 6, "/": 6, "%": 6, "^": 8,
+}
+
+const luaUnaryPrecedence = 7
+
+func (p *luaParser) expr(limit int) (luaExpr, error) {
+	var left luaExpr
+	if p.check("not") || p.check("-") || p.check("#") {
+		op := p.next().text
+		operand, err := p.expr(luaUnaryPrecedence)
+		if err != nil {
+			return nil, err
+		}
+		left = luaUnary(op, operand)
+	} else {
+		var err error
+		left, err = p.simple()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for {
+		op := p.peek()
+		precedence, ok := luaPrecedence[op.text]
+		if !ok || op.kind == tokenString || precedence <= limit {
+			return left, nil
+		}
+		p.next()
+		rightLimit := precedence
+		if op.text == ".." || op.text == "^" {
+			rightLimit--
+		}
+		right, err := p.expr(rightLimit)
+		if err != nil {
+			return nil, err
+		}
+		left = luaBinary(op.text, left, right)
+	}
+}
+
+func luaConstant(value interface{}) luaExpr {
+	return func(*luaScope) (interface{}, error) {
+		return value, nil
+	}
+}
+
+func (p *luaParser) simple() (luaExpr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenNumber:
+		p.next()
+		return luaConstant(t.number), nil
+	case t.kind == tokenString:
+		p.next()
+		return luaConstant(t.text), nil
+	case p.accept("nil"):
+		return luaConstant(nil), nil
+	case p.accept("true"):
+		return luaConstant(true), nil
+	case p.accept("false"):
+		return luaConstant(false), nil
+	case p.accept("{"):
+		return p.table()
+	}
+	expr, _, err := p.suffixed()
+	return expr, err
+}
+
+func (p *luaParser) table() (luaExpr, error) {
+	var items []luaExpr
+	fields := map[string]luaExpr{}
+	for !p.accept("}") {
+		if p.peek().kind == tokenName && p.tokens[p.pos+1].text == "=" && p.tokens[p.pos+1].kind == tokenSymbol {
+			name := p.next().text
+			p.next()
+			value, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = value
+		} else {
+			item, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		if !p.accept(",") && !p.accept(";") {
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return func(scope *luaScope) (interface{}, error) {
+		values, err := evalLuaList(items, scope)
+		if err != nil {
+			return nil, err
+		}
+		table := &luaTable{array: values, fields: map[string]interface{}{}}
+		for name, expr := range fields {
+			value, err := expr(scope)
+			if err != nil {
+				return nil, err
+			}
+			table.fields[name] = value
+		}
+		return table, nil
+	}, nil
+}
+
+// suffixed parses a name or parenthesized expression followed by any indexing and calls,
+// reporting whether it ends in a call
+func (p *luaParser) suffixed() (luaExpr, bool, error) {
+	var expr luaExpr
+	if p.accept("(") {
+		inner, err := p.expr(0)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, false, err
+		}
+		expr = inner
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, false, err
+		}
+		expr = func(scope *luaScope) (interface{}, error) {
+			if owner, ok := scope.lookup(name); ok {
+				return owner.vars[name], nil
+			}
+			return nil, nil
+		}
+	}
+
+	isCall := false
+	for {
+		switch {
+		case p.accept("."):
+			field, err := p.name()
+			if err != nil {
+				return nil, false, err
+			}
+			expr = luaIndexExpr(expr, luaConstant(field))
+			isCall = false
+		case p.accept("["):
+			key, err := p.expr(0)
+			if err != nil {
+				return nil, false, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, false, err
+			}
+			expr = luaIndexExpr(expr, key)
+			isCall = false
+		case p.accept("("):
+			var args []luaExpr
+			if !p.check(")") {
+				var err error
+				args, err = p.exprList()
+				if err != nil {
+					return nil, false, err
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, false, err
+			}
+			expr = luaCallExpr(expr, args)
+			isCall = true
+		default:
+			return expr, isCall, nil
+		}
+	}
+}
+
+func luaIndexExpr(container, key luaExpr) luaExpr {
+	return func(scope *luaScope) (interface{}, error) {
+		c, err := container(scope)
+		if err != nil {
+			return nil, err
+		}
+		k, err := key(scope)
+		if err != nil {
+			return nil, err
+		}
+		return luaIndex(c, k)
+	}
+}
+
+func luaCallExpr(callee luaExpr, args []luaExpr) luaExpr {
+	return func(scope *luaScope) (interface{}, error) {
+		f, err := callee(scope)
+		if err != nil {
+			return nil, err
+		}
+		fn, ok := f.(luaFunction)
+		if !ok {
+			return nil, fmt.Errorf("attempt to call a %s value", luaTypeName(f))
+		}
+		values, err := evalLuaList(args, scope)
+		if err != nil {
+			return nil, err
+		}
+		return fn(values)
+	}
+}
@@ -0,0 +1,412 @@
+// Package redistest provides a local Redis server for tests. It speaks enough of RESP2 for
+// go-redis and keeps its data in memory, covering the string, set and pub/sub commands the
+// server uses. Published messages are counted rather than delivered.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type entry struct {
+	value   string
+	members map[string]bool
+	fields  map[string]string
+	expires time.Time
+}
+
+// Server is a minimal in-memory Redis server on localhost
+type Server struct {
+	Addr string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu        sync.Mutex
+	data      map[string]*entry
+	published map[string]int
+	scripts   map[string]string
+	commands  map[string]int
+}
+
+// NewServer starts a server on a random local port
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:      listener.Addr().String(),
+		listener:  listener,
+		data:      make(map[string]*entry),
+		published: make(map[string]int),
+		scripts:   make(map[string]string),
+		commands:  make(map[string]int),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Client returns a client connected to the server
+func (s *Server) Client() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: s.Addr})
+}
+
+// Close stops the server and waits for open connections to finish
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+// Published returns how many messages have been published to the channel
+func (s *Server) Published(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.published[channel]
+}
+
+// Commands returns how many times a command has been run, counting those run by scripts
+func (s *Server) Commands(command string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands[strings.ToUpper(command)]
+}
+
+// Keys returns the keys matching a glob pattern
+func (s *Server) Keys(pattern string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys(pattern)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		s.execute(writer, args)
+		// Pipelined commands are answered together
+		if reader.Buffered() == 0 {
+			if writer.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimRight(header, "\r\n")[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:length]))
+	}
+	return args, nil
+}
+
+// reply is a RESP2 reply: nil for a nil bulk string, a string for a bulk string,
+// an int for an integer and a []reply for an array
+type reply interface{}
+
+// status is a simple string reply
+type status string
+
+// replyError is an error reply, including its prefix
+type replyError string
+
+func errorf(format string, args ...interface{}) replyError {
+	return replyError("ERR " + fmt.Sprintf(format, args...))
+}
+
+func writeReply(w *bufio.Writer, r reply) {
+	switch v := r.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case replyError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []reply:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
+
+// get returns a key that hasn't expired. The caller must hold s.mu.
+func (s *Server) get(key string) *entry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+func (s *Server) keys(pattern string) []string {
+	var keys []string
+	for key := range s.data {
+		if s.get(key) == nil {
+			continue
+		}
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (s *Server) execute(w *bufio.Writer, args []string) {
+	s.mu.Lock()
+	r := s.run(args)
+	s.mu.Unlock()
+	writeReply(w, r)
+}
+
+// run executes a command. The caller must hold s.mu.
+func (s *Server) run(args []string) reply {
+	if len(args) == 0 {
+		return errorf("empty command")
+	}
+	command := strings.ToUpper(args[0])
+	s.commands[command]++
+	switch command {
+	case "PING":
+		return status("PONG")
+	case "GET":
+		if e := s.get(args[1]); e != nil && e.members == nil && e.fields == nil {
+			return e.value
+		}
+		return nil
+	case "SET":
+		return s.set(args)
+	case "SETNX":
+		if s.get(args[1]) != nil {
+			return 0
+		}
+		s.data[args[1]] = &entry{value: args[2]}
+		return 1
+	case "DEL", "EXISTS":
+		count := 0
+		for _, key := range args[1:] {
+			if s.get(key) != nil {
+				count++
+				if command == "DEL" {
+					delete(s.data, key)
+				}
+			}
+		}
+		return count
+	case "INCR":
+		e := s.get(args[1])
+		if e == nil {
+			e = &entry{value: "0"}
+			s.data[args[1]] = e
+		}
+		n, err := strconv.Atoi(e.value)
+		if err != nil {
+			return errorf("value is not an integer or out of range")
+		}
+		e.value = strconv.Itoa(n + 1)
+		return n + 1
+	case "EXPIRE", "PEXPIRE":
+		e := s.get(args[1])
+		n, err := strconv.Atoi(args[2])
+		if e == nil || err != nil {
+			return 0
+		}
+		unit := time.Second
+		if command == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		e.expires = time.Now().Add(time.Duration(n) * unit)
+		return 1
+	case "SADD":
+		e := s.get(args[1])
+		if e == nil {
+			e = &entry{members: make(map[string]bool)}
+			s.data[args[1]] = e
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if !e.members[member] {
+				e.members[member] = true
+				added++
+			}
+		}
+		return added
+	case "SCARD":
+		if e := s.get(args[1]); e != nil {
+			return len(e.members)
+		}
+		return 0
+	case "HSET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return errorf("wrong number of arguments for 'hset' command")
+		}
+		e := s.get(args[1])
+		if e == nil {
+			e = &entry{fields: make(map[string]string)}
+			s.data[args[1]] = e
+		}
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := e.fields[args[i]]; !ok {
+				added++
+			}
+			e.fields[args[i]] = args[i+1]
+		}
+		return added
+	case "HGET":
+		if e := s.get(args[1]); e != nil {
+			if value, ok := e.fields[args[2]]; ok {
+				return value
+			}
+		}
+		return nil
+	case "HMGET":
+		e := s.get(args[1])
+		values := make([]reply, 0, len(args)-2)
+		for _, field := range args[2:] {
+			if e == nil {
+				values = append(values, nil)
+				continue
+			}
+			if value, ok := e.fields[field]; ok {
+				values = append(values, value)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		return values
+	case "SCAN":
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		keys := s.keys(pattern)
+		values := make([]reply, 0, len(keys))
+		for _, key := range keys {
+			values = append(values, key)
+		}
+		return []reply{"0", values}
+	case "PUBLISH":
+		s.published[args[1]]++
+		return 0
+	case "EVAL":
+		return s.eval(args[1], args[2:])
+	case "EVALSHA":
+		script, ok := s.scripts[strings.ToLower(args[1])]
+		if !ok {
+			return replyError("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return s.eval(script, args[2:])
+	case "SCRIPT":
+		if len(args) == 3 && strings.ToUpper(args[1]) == "LOAD" {
+			return s.loadScript(args[2])
+		}
+		return errorf("unknown subcommand for 'script'")
+	default:
+		return errorf("unknown command '%s'", args[0])
+	}
+}
+
+// set handles SET key value [EX seconds | PX milliseconds] [NX | XX]
+func (s *Server) set(args []string) reply {
+	if len(args) < 3 {
+		return errorf("wrong number of arguments for 'set' command")
+	}
+	e := &entry{value: args[2]}
+	nx, xx := false, false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errorf("syntax error")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return errorf("value is not an integer or out of range")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			e.expires = time.Now().Add(time.Duration(n) * unit)
+			i++
+		}
+	}
+	exists := s.get(args[1]) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	s.data[args[1]] = e
+	return status("OK")
+}
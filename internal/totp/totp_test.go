@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA1 test vectors from RFC 6238 appendix B, truncated to 6 digits
+func TestCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := Code(secret, Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("At %d expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := Code(secret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, ok := Validate(secret, code, now, 0)
+	if !ok || step != Step(now) {
+		t.Fatal("Expected the current code to validate")
+	}
+	if _, ok := Validate(secret, code, now, step); ok {
+		t.Error("Expected a code to be refused the second time")
+	}
+	if _, ok := Validate(secret, code, now.Add(Period), 0); !ok {
+		t.Error("Expected the previous code to be accepted for clock drift")
+	}
+	if _, ok := Validate(secret, code, now.Add(5*Period), 0); ok {
+		t.Error("Expected an old code to be refused")
+	}
+	if _, ok := Validate(secret, "12345", now, 0); ok {
+		t.Error("Expected a short code to be refused")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("Expected %d codes, got %d", recoveryCodeCount, len(codes))
+	}
+	remaining, ok := UseRecoveryCode(hashes, strings.ToUpper(codes[3]))
+	if !ok || len(remaining) != recoveryCodeCount-1 {
+		t.Fatal("Expected a recovery code to be accepted once")
+	}
+	if _, ok := UseRecoveryCode(remaining, codes[3]); ok {
+		t.Error("Expected a used recovery code to be refused")
+	}
+	if _, ok := UseRecoveryCode(remaining, "aaaaa-bbbbb"); ok {
+		t.Error("Expected an unknown recovery code to be refused")
+	}
+	if len(hashes) != recoveryCodeCount {
+		t.Error("Using a recovery code changed the original hashes")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("DMRHub", "N0CALL", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/DMRHub:N0CALL?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("Unexpected URI %s", uri)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	// Embed the users.json.xz file into the binary
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -151,3 +152,11 @@ func Update() error {
 func GetDate() time.Time {
 	return dmrUsers.Date
 }
+
+func GetUser(id uint) (DMRUser, error) {
+	user, ok := (*GetDMRUsers())[id]
+	if !ok {
+		return DMRUser{}, errors.New("user not found")
+	}
+	return user, nil
+}
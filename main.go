@@ -176,6 +176,23 @@ InitDB:
 		db.Save(&appSettings)
 	}
 
+	// Tables added after the initial schema need to be migrated on existing databases too
+	err = db.AutoMigrate(&models.Call{}, &models.Repeater{}, &models.Talkgroup{}, &models.Net{}, &models.NetCheckIn{}, &models.Bridge{}, &models.RepeaterRewrite{}, &models.Announcement{}, &models.AnnouncementSchedule{}, &models.CallQualitySample{}, &models.RepeaterConnectionLog{}, &models.AuditLog{}, &models.APIToken{}, &models.EmailToken{}, &models.Role{}, &models.User{}, &models.InviteCode{})
+	if err != nil {
+		klog.Exitf("Failed to migrate database: %s", err)
+		return
+	}
+
+	if !appSettings.HasSeededRoles {
+		err = models.SeedRoles(db)
+		if err != nil {
+			klog.Exitf("Failed to seed roles: %s", err)
+			return
+		}
+		appSettings.HasSeededRoles = true
+		db.Save(&appSettings)
+	}
+
 	sqlDB, err := db.DB()
 	if err != nil {
 		klog.Exitf("Failed to open database: %s", err)
@@ -254,6 +271,9 @@ InitDB:
 		}
 	}
 
+	models.ReloadAppSettings(db)
+	go models.WatchAppSettings(ctx, db, redis)
+
 	dmrServer := dmr.MakeServer(db, redis)
 	dmrServer.Listen(ctx)
 	defer dmrServer.Stop(ctx)